@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/jonhadfield/gosn-v2"
 	"github.com/jonhadfield/gosn-v2/cache"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	sndotfiles "github.com/jonhadfield/dotfiles-sn/sn-dotfiles"
@@ -20,16 +25,39 @@ import (
 // overwritten at build time
 var version, versionOutput, tag, sha, buildDate string
 
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// exit codes, so drift can be detected by scripts
+const (
+	exitOK    = 0
+	exitError = 1
+	exitDrift = 2
+)
+
+// exitCode is set by commands that detect drift, and returned once their output has been displayed
+var exitCode = exitOK
+
+// outputFormat is set from the --output flag, or output config key, so errors are rendered to match
+var outputFormat = outputText
+
 type configOptsOutput struct {
-	useStdOut  bool
-	display    bool
-	useSession bool
-	home       string
-	sessKey    string
-	server     string
-	pageSize   int
-	cacheDBDir string
-	debug      bool
+	useStdOut    bool
+	useStdErr    bool
+	display      bool
+	output       string
+	useSession   bool
+	home         string
+	sessKey      string
+	server       string
+	pageSize     int
+	cacheDBDir   string
+	templateVars map[string]string
+	roots        *sndotfiles.Roots
+	debug        bool
 }
 
 func getOpts(c *cli.Context) (out configOptsOutput, err error) {
@@ -67,6 +95,32 @@ func getOpts(c *cli.Context) (out configOptsOutput, err error) {
 
 	out.pageSize = c.GlobalInt("page-size")
 
+	out.templateVars = viper.GetStringMapString("template_vars")
+
+	out.roots, err = sndotfiles.NewRoots(viper.GetStringMapString("roots"), viper.GetString("privilege_helper"))
+	if err != nil {
+		return
+	}
+
+	out.output = outputText
+	if viper.GetString("output") != "" {
+		out.output = viper.GetString("output")
+	}
+
+	if c.GlobalString("output") != "" {
+		out.output = c.GlobalString("output")
+	}
+
+	if !sndotfiles.StringInSlice(out.output, []string{outputText, outputJSON, outputNDJSON}, true) {
+		err = fmt.Errorf("invalid output format '%s'", out.output)
+		return
+	}
+
+	outputFormat = out.output
+
+	// keep stdout clear for machine-readable output
+	out.useStdErr = c.GlobalBool("no-stdout") || out.output != outputText
+
 	out.debug = viper.GetBool("debug")
 	if c.GlobalBool("debug") {
 		out.debug = true
@@ -78,15 +132,20 @@ func getOpts(c *cli.Context) (out configOptsOutput, err error) {
 func main() {
 	msg, display, err := startCLI(os.Args)
 	if err != nil {
-		fmt.Printf("error: %+v\n", err)
-		os.Exit(1)
+		if outputFormat != outputText {
+			fmt.Println(formatError(err))
+		} else {
+			fmt.Printf("error: %+v\n", err)
+		}
+
+		os.Exit(exitError)
 	}
 
 	if display && msg != "" {
 		fmt.Println(msg)
 	}
 
-	os.Exit(0)
+	os.Exit(exitCode)
 }
 
 func startCLI(args []string) (msg string, display bool, err error) {
@@ -117,6 +176,20 @@ func startCLI(args []string) (msg string, display bool, err error) {
 		return "", false, err
 	}
 
+	// load optional config file, e.g. ~/.config/sn-dotfiles/config.yaml
+	if configDir, cErr := os.UserConfigDir(); cErr == nil {
+		viper.SetConfigName("config")
+		viper.AddConfigPath(filepath.Join(configDir, sndotfiles.SNAppName))
+
+		if err = viper.ReadInConfig(); err != nil {
+			if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+				return "", false, err
+			}
+
+			err = nil
+		}
+	}
+
 	if tag != "" && buildDate != "" {
 		versionOutput = fmt.Sprintf("[%s-%s] %s UTC", tag, sha, buildDate)
 	} else {
@@ -148,6 +221,7 @@ func startCLI(args []string) (msg string, display bool, err error) {
 		cli.IntFlag{Name: "page-size", Hidden: true, Value: sndotfiles.DefaultPageSize},
 		cli.BoolFlag{Name: "quiet"},
 		cli.BoolFlag{Name: "no-stdout"},
+		cli.StringFlag{Name: "output", Usage: "output format: text (default), json or ndjson"},
 	}
 	app.CommandNotFound = func(c *cli.Context, command string) {
 		_, _ = fmt.Fprintf(c.App.Writer, "\ninvalid command: \"%s\" \n\n", command)
@@ -156,43 +230,859 @@ func startCLI(args []string) (msg string, display bool, err error) {
 	statusCmd := cli.Command{
 		Name:  "status",
 		Usage: "compare local and remote",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "check",
+				Usage: "print nothing and exit with 0 if in sync, 1 on error or 2 if drifted",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			check := c.Bool("check")
+			if check {
+				display = false
+			}
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession, opts.sessKey, opts.server, opts.debug)
+
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			var diffs []sndotfiles.ItemDiff
+
+			diffs, msg, err = sndotfiles.Status(&session, opts.home, opts.roots, c.Args(), opts.templateVars, opts.pageSize, opts.debug, check, opts.useStdErr)
+			if err != nil {
+				if check {
+					exitCode = exitError
+					return nil
+				}
+
+				return err
+			}
+
+			if sndotfiles.Drifted(diffs) {
+				exitCode = exitDrift
+			}
+
+			if opts.output != outputText {
+				msg, err = formatResults(opts.output, sndotfiles.Results(diffs))
+			}
+
+			return err
+		},
+	}
+
+	syncCmd := cli.Command{
+		Name:  "sync",
+		Usage: "sync dotfiles",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "exlude path from sync",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "show what would be synced without making changes",
+			},
+			cli.BoolFlag{
+				Name:  "interactive, i",
+				Usage: "choose what to do with each changed item and conflict",
+			},
+		},
+		BashComplete: func(c *cli.Context) {
+			syncTasks := []string{"--exclude", "--dry-run", "--interactive"}
+			for _, t := range syncTasks {
+				fmt.Println(t)
+			}
+		},
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server, opts.debug)
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			if c.Bool("interactive") && c.Bool("dry-run") {
+				msg = "error: specifying --interactive and --dry-run does not make sense"
+				_ = cli.ShowCommandHelp(c, "sync")
+				return nil
+			}
+
+			var so sndotfiles.SyncOutput
+			so, err = sndotfiles.Sync(sndotfiles.SNDotfilesSyncInput{
+				Session:      &session,
+				Home:         opts.home,
+				Roots:        opts.roots,
+				Paths:        c.Args(),
+				Exclude:      c.StringSlice("exclude"),
+				TemplateVars: opts.templateVars,
+				PageSize:     opts.pageSize,
+				Debug:        opts.debug,
+				DryRun:       c.Bool("dry-run"),
+				Interactive:  c.Bool("interactive"),
+				Progress:     streamResults(opts),
+			}, opts.useStdErr)
+
+			if err != nil {
+				return err
+			}
+			msg = so.Msg
+
+			if sndotfiles.Failed(so.Results) {
+				exitCode = exitError
+			}
+
+			switch opts.output {
+			case outputNDJSON:
+				// already printed as each change was made
+				msg = ""
+			case outputJSON:
+				msg, err = formatResults(opts.output, so.Results)
+			}
+
+			return err
+		},
+	}
+
+	watchCmd := cli.Command{
+		Name:  "watch",
+		Usage: "sync whenever dotfiles change locally, and regularly to pick up remote changes",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "exlude path from sync",
+			},
+			cli.DurationFlag{
+				Name:  "debounce",
+				Usage: "time to wait for further changes before syncing (defaults to watch_debounce from config, or 2s)",
+			},
+			cli.DurationFlag{
+				Name:  "poll-interval",
+				Usage: "time between syncs to pick up remote changes (defaults to watch_poll_interval from config, or 5m)",
+			},
+		},
+		BashComplete: func(c *cli.Context) {
+			watchTasks := []string{"--exclude", "--debounce", "--poll-interval"}
+			for _, t := range watchTasks {
+				fmt.Println(t)
+			}
+		},
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server, opts.debug)
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			debounce := c.Duration("debounce")
+			if debounce == 0 {
+				debounce = viper.GetDuration("watch_debounce")
+			}
+
+			pollInterval := c.Duration("poll-interval")
+			if pollInterval == 0 {
+				pollInterval = viper.GetDuration("watch_poll_interval")
+			}
+
+			stop := make(chan struct{})
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+			go func() {
+				<-signals
+				close(stop)
+			}()
+
+			err = sndotfiles.Watch(sndotfiles.WatchInput{
+				Session:      &session,
+				Home:         opts.home,
+				Roots:        opts.roots,
+				Exclude:      c.StringSlice("exclude"),
+				TemplateVars: opts.templateVars,
+				Debounce:     debounce,
+				PollInterval: pollInterval,
+				Debug:        opts.debug,
+				Report: func(so sndotfiles.SyncOutput, sErr error) {
+					reportWatchSync(opts, so, sErr)
+				},
+			}, stop)
+
+			return err
+		},
+	}
+
+	daemonCmd := cli.Command{
+		Name:      "daemon",
+		Usage:     "watch and sync with a single session, taking requests over a socket, or send a request to the daemon",
+		ArgsUsage: "[status | sync | push | pull | pause | resume] [path...]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "socket",
+				Usage: "socket to listen, or send requests, on (defaults to daemon_socket from config)",
+			},
+			cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "exlude path from sync",
+			},
+			cli.DurationFlag{
+				Name:  "debounce",
+				Usage: "time to wait for further changes before syncing (defaults to watch_debounce from config, or 2s)",
+			},
+			cli.DurationFlag{
+				Name:  "poll-interval",
+				Usage: "time between syncs to pick up remote changes (defaults to watch_poll_interval from config, or 5m)",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "show what a requested sync, push or pull would do without making changes",
+			},
+		},
+		BashComplete: func(c *cli.Context) {
+			if c.NArg() > 0 {
+				return
+			}
+			daemonTasks := []string{"status", "sync", "push", "pull", "pause", "resume", "--socket", "--exclude",
+				"--debounce", "--poll-interval", "--dry-run"}
+			for _, t := range daemonTasks {
+				fmt.Println(t)
+			}
+		},
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			socket := c.String("socket")
+			if socket == "" {
+				socket = viper.GetString("daemon_socket")
+			}
+
+			if socket == "" {
+				socket, err = sndotfiles.DefaultDaemonSocket(opts.cacheDBDir)
+				if err != nil {
+					return err
+				}
+			}
+
+			// with a command, send it to the running daemon
+			if len(c.Args()) > 0 {
+				var resp sndotfiles.DaemonResponse
+				resp, err = sndotfiles.DaemonCall(socket, sndotfiles.DaemonRequest{
+					Command: c.Args().First(),
+					Paths:   c.Args().Tail(),
+					DryRun:  c.Bool("dry-run"),
+				})
+				if err != nil {
+					return err
+				}
+
+				msg, err = formatDaemonResponse(opts.output, resp)
+
+				return err
+			}
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server, opts.debug)
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			debounce := c.Duration("debounce")
+			if debounce == 0 {
+				debounce = viper.GetDuration("watch_debounce")
+			}
+
+			pollInterval := c.Duration("poll-interval")
+			if pollInterval == 0 {
+				pollInterval = viper.GetDuration("watch_poll_interval")
+			}
+
+			stop := make(chan struct{})
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+			go func() {
+				<-signals
+				close(stop)
+			}()
+
+			err = sndotfiles.Daemon(sndotfiles.DaemonInput{
+				WatchInput: sndotfiles.WatchInput{
+					Session:      &session,
+					Home:         opts.home,
+					Roots:        opts.roots,
+					Exclude:      c.StringSlice("exclude"),
+					TemplateVars: opts.templateVars,
+					Debounce:     debounce,
+					PollInterval: pollInterval,
+					Debug:        opts.debug,
+					Report: func(so sndotfiles.SyncOutput, sErr error) {
+						reportWatchSync(opts, so, sErr)
+					},
+				},
+				Socket: socket,
+			}, stop)
+
+			return err
+		},
+	}
+
+	installServiceCmd := cli.Command{
+		Name:  "install-service",
+		Usage: "install a systemd user service and timer that sync on a schedule",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "schedule",
+				Usage: "when to sync, as a systemd calendar event, e.g. hourly or *:0/15",
+				Value: sndotfiles.DefaultServiceSchedule,
+			},
+			cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "exlude path from sync",
+			},
+			cli.BoolFlag{
+				Name:  "uninstall",
+				Usage: "disable and remove the service and timer",
+			},
+		},
+		BashComplete: func(c *cli.Context) {
+			serviceTasks := []string{"--schedule", "--exclude", "--uninstall"}
+			for _, t := range serviceTasks {
+				fmt.Println(t)
+			}
+		},
 		Action: func(c *cli.Context) error {
 			var opts configOptsOutput
 			opts, err = getOpts(c)
 			if err != nil {
 				return err
 			}
-			display = opts.display
+			display = opts.display
+
+			if c.Bool("uninstall") {
+				msg, err = sndotfiles.UninstallService("")
+				return err
+			}
+
+			// run unattended with the session from the keyring, logging to the journal
+			args := []string{"--use-session", "--quiet", "--no-stdout"}
+			for _, name := range []string{"server", "home-dir"} {
+				if v := c.GlobalString(name); v != "" {
+					args = append(args, "--"+name, v)
+				}
+			}
+
+			msg, err = sndotfiles.InstallService(sndotfiles.ServiceInput{
+				Args:     args,
+				Exclude:  c.StringSlice("exclude"),
+				Schedule: c.String("schedule"),
+			})
+
+			return err
+		},
+	}
+
+	serviceStatusCmd := cli.Command{
+		Name:  "service-status",
+		Usage: "show the state of the sync service and timer, and recent logs",
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			msg, err = sndotfiles.ServiceStatus()
+
+			return err
+		},
+	}
+
+	planCmd := cli.Command{
+		Name:  "plan",
+		Usage: "save the changes a sync would make, to review before applying",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "file, f",
+				Usage: "file to write the plan to",
+			},
+			cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "exlude path from plan",
+			},
+		},
+		BashComplete: func(c *cli.Context) {
+			planTasks := []string{"--file", "--exclude"}
+			for _, t := range planTasks {
+				fmt.Println(t)
+			}
+		},
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			if c.String("file") == "" {
+				msg = "error: specify a file to write the plan to with --file"
+				_ = cli.ShowCommandHelp(c, "plan")
+				return nil
+			}
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server, opts.debug)
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			var po sndotfiles.PlanOutput
+			po, err = sndotfiles.Plan(sndotfiles.PlanInput{
+				Session:      &session,
+				Home:         opts.home,
+				Roots:        opts.roots,
+				Paths:        c.Args(),
+				Exclude:      c.StringSlice("exclude"),
+				TemplateVars: opts.templateVars,
+				Debug:        opts.debug,
+			}, opts.useStdErr)
+			if err != nil {
+				return err
+			}
+
+			if err = sndotfiles.WritePlan(po.Plan, c.String("file")); err != nil {
+				return err
+			}
+
+			msg = fmt.Sprintf("%s\n\nplan written to: %s", po.Msg, c.String("file"))
+
+			return err
+		},
+	}
+
+	applyCmd := cli.Command{
+		Name:      "apply",
+		Usage:     "make the changes saved in a plan",
+		ArgsUsage: "<plan file>",
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			if len(c.Args()) != 1 {
+				msg = "error: specify the plan file to apply"
+				_ = cli.ShowCommandHelp(c, "apply")
+				return nil
+			}
+
+			var plan sndotfiles.SyncPlan
+			plan, err = sndotfiles.ReadPlan(c.Args().First())
+			if err != nil {
+				return err
+			}
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server, opts.debug)
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			var so sndotfiles.SyncOutput
+			so, err = sndotfiles.Apply(sndotfiles.ApplyInput{
+				Session:      &session,
+				Home:         opts.home,
+				Roots:        opts.roots,
+				Plan:         plan,
+				TemplateVars: opts.templateVars,
+				Debug:        opts.debug,
+				Progress:     streamResults(opts),
+			}, opts.useStdErr)
+			if err != nil {
+				return err
+			}
+			msg = so.Msg
+
+			if sndotfiles.Failed(so.Results) {
+				exitCode = exitError
+			}
+
+			switch opts.output {
+			case outputNDJSON:
+				// already printed as each change was made
+				msg = ""
+			case outputJSON:
+				msg, err = formatResults(opts.output, so.Results)
+			}
+
+			return err
+		},
+	}
+
+	addCmd := cli.Command{
+		Name:  "add",
+		Usage: "start tracking file(s)",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "add all dotfiles, to the depth specified",
+			},
+			cli.IntFlag{
+				Name:  "depth",
+				Usage: "levels below home to look for dotfiles with --all",
+				Value: sndotfiles.DefaultAddDepth,
+			},
+			cli.BoolFlag{
+				Name:  "interactive, i",
+				Usage: "choose which of the dotfiles found by --all to add",
+			},
+			cli.BoolFlag{
+				Name:  "list",
+				Usage: "list the dotfiles --all would add, one per line, without adding them",
+			},
+			cli.StringFlag{
+				Name:  "symlinks",
+				Usage: "add symlinks by tracking their target ('track') or the file they point to ('follow')",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "show what would be added without making changes",
+			},
+			cli.BoolFlag{
+				Name:  "template",
+				Usage: "store file(s) as templates, rendered when pulled",
+			},
+			cli.BoolFlag{
+				Name:  "nested-tags",
+				Usage: "create new tags as children of their parent directory's tag",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			if !c.Bool("all") && len(c.Args()) == 0 {
+				msg = "error: either specify paths to add or --all to add everything"
+				_ = cli.ShowCommandHelp(c, "add")
+				return nil
+			}
+
+			if c.Bool("all") && len(c.Args()) > 0 {
+				msg = "error: specifying --all and paths does not make sense"
+				_ = cli.ShowCommandHelp(c, "add")
+				return nil
+			}
+
+			if (c.Bool("interactive") || c.Bool("list")) && !c.Bool("all") {
+				msg = "error: --interactive and --list choose from the dotfiles found by --all"
+				_ = cli.ShowCommandHelp(c, "add")
+				return nil
+			}
+
+			if c.Bool("list") {
+				var paths []string
+				paths, err = sndotfiles.DiscoverDotfiles(opts.home, opts.cacheDBDir, c.Int("depth"), opts.debug)
+				msg = strings.Join(paths, "\n")
+
+				return err
+			}
+
+			args := []string(c.Args())
+			// paths can be piped in, such as those listed by --list
+			if len(args) == 1 && args[0] == "-" {
+				args, err = readPaths(os.Stdin)
+				if err != nil {
+					return err
+				}
+			}
+
+			var absPaths []string
+			for _, path := range args {
+				// quoted patterns aren't expanded by the shell
+				if strings.HasPrefix(path, "~") {
+					path = strings.Replace(path, "~", opts.home, 1)
+				}
+				var ap string
+				ap, err = filepath.Abs(path)
+				if err != nil {
+					return err
+				}
+				// patterns are checked once expanded
+				if !isValidDotfilePath(ap, opts.roots) && !strings.ContainsAny(path, "*?[") {
+					msg = fmt.Sprintf("\"%s\" is not a valid dotfile path", path)
+					return nil
+				}
+				absPaths = append(absPaths, ap)
+			}
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server, opts.debug)
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			ai := sndotfiles.AddInput{Session: &session, Home: opts.home, Roots: opts.roots, Paths: absPaths,
+				PageSize: opts.pageSize, All: c.Bool("all"), Depth: c.Int("depth"),
+				Interactive: c.Bool("interactive"), Symlinks: c.String("symlinks"),
+				NestedTags: c.Bool("nested-tags"), Template: c.Bool("template"),
+				DryRun: c.Bool("dry-run")}
+
+			var ao sndotfiles.AddOutput
+
+			ao, err = sndotfiles.Add(ai, true)
+			if err != nil {
+				return err
+			}
+
+			msg = ao.Msg
+
+			if opts.output != outputText {
+				msg, err = formatResults(opts.output, ao.Results)
+			}
+
+			return err
+		},
+	}
+
+	removeCmd := cli.Command{
+		Name:  "remove",
+		Usage: "delete the remote copies of file(s), which other machines move to the trash when they next sync",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "show what would be removed without making changes",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if len(c.Args()) == 0 {
+				_ = cli.ShowCommandHelp(c, "remove")
+				return nil
+			}
+
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			if len(c.Args()) == 0 {
+				msg = "error: paths not specified"
+				_ = cli.ShowCommandHelp(c, "add")
+				return nil
+			}
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server,
+				opts.debug)
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			ri := sndotfiles.RemoveInput{
+				Session:  &session,
+				Home:     opts.home,
+				Roots:    opts.roots,
+				Paths:    c.Args(),
+				PageSize: opts.pageSize,
+				Debug:    opts.debug,
+				DryRun:   c.Bool("dry-run"),
+			}
+
+			var ro sndotfiles.RemoveOutput
+
+			ro, err = sndotfiles.Remove(ri, opts.useStdErr)
+			if err != nil {
+				return err
+			}
+			msg = ro.Msg
+
+			if opts.output != outputText {
+				msg, err = formatResults(opts.output, ro.Results)
+			}
+
+			return err
+		},
+	}
+
+	diffCmd := cli.Command{
+		Name:  "diff",
+		Usage: "display differences between local and remote",
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "context, U",
+				Usage: "number of unchanged lines to show around each change",
+				Value: sndotfiles.DefaultDiffContext,
+			},
+			cli.BoolFlag{
+				Name:  "stat",
+				Usage: "show the number of changed lines for each path",
+			},
+			cli.BoolFlag{
+				Name:  "name-only",
+				Usage: "show only the paths that differ",
+			},
+			cli.StringFlag{
+				Name:  "tool",
+				Usage: "compare using a tool, e.g. vimdiff, instead (defaults to diff_tool from config)",
+			},
+			cli.BoolFlag{
+				Name:  "no-tool",
+				Usage: "ignore diff_tool from config",
+			},
+		},
+		BashComplete: func(c *cli.Context) {
+			diffTasks := []string{"--context", "--stat", "--name-only", "--tool", "--no-tool"}
+			for _, t := range diffTasks {
+				fmt.Println(t)
+			}
+		},
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server, opts.debug)
+
+			var cacheDBPath string
+
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+
+			session.CacheDBPath = cacheDBPath
+
+			tool := c.String("tool")
+			if tool == "" && !c.Bool("no-tool") {
+				tool = viper.GetString("diff_tool")
+			}
+
+			if tool != "" && opts.output == outputText && !c.Bool("stat") && !c.Bool("name-only") {
+				msg, err = sndotfiles.DiffTool(sndotfiles.DiffToolInput{
+					Session:      &session,
+					Home:         opts.home,
+					Roots:        opts.roots,
+					Paths:        c.Args(),
+					TemplateVars: opts.templateVars,
+					Tool:         tool,
+					Debug:        opts.debug,
+				}, opts.useStdErr)
+
+				return err
+			}
 
-			var session cache.Session
-			session, _, err = cache.GetSession(opts.useSession, opts.sessKey, opts.server, opts.debug)
+			var diffs []sndotfiles.ItemDiff
 
-			var cacheDBPath string
-			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if c.Bool("stat") && c.Bool("name-only") {
+				msg = "error: specify only one of --stat and --name-only"
+				_ = cli.ShowCommandHelp(c, "diff")
+				return nil
+			}
+
+			diffOpts := sndotfiles.DiffOptions{
+				Context:  c.Int("context"),
+				Stat:     c.Bool("stat"),
+				NameOnly: c.Bool("name-only"),
+			}
+
+			diffs, msg, err = sndotfiles.Diff(&session, opts.home, opts.roots, c.Args(), opts.templateVars, opts.pageSize, diffOpts, true, opts.useStdErr)
 			if err != nil {
 				return err
 			}
-			session.CacheDBPath = cacheDBPath
 
-			_, msg, err = sndotfiles.Status(&session, opts.home, c.Args(), opts.pageSize, opts.debug, false)
+			if sndotfiles.Drifted(diffs) {
+				exitCode = exitDrift
+			}
+
+			if opts.output != outputText {
+				msg, err = formatResults(opts.output, sndotfiles.Results(diffs))
+			}
+
 			return err
 		},
 	}
 
-	syncCmd := cli.Command{
-		Name:  "sync",
-		Usage: "sync dotfiles",
+	mergeCmd := cli.Command{
+		Name:  "merge",
+		Usage: "resolve conflicts with a merge tool and push the results",
 		Flags: []cli.Flag{
-			cli.StringSliceFlag{
-				Name:  "exclude",
-				Usage: "exlude path from sync",
+			cli.StringFlag{
+				Name:  "tool",
+				Usage: "merge tool to use, e.g. vimdiff or meld (defaults to merge_tool from config)",
 			},
 		},
 		BashComplete: func(c *cli.Context) {
-			syncTasks := []string{"--exclude"}
-			for _, t := range syncTasks {
-				fmt.Println(t)
-			}
+			fmt.Println("--tool")
 		},
 		Action: func(c *cli.Context) error {
 			var opts configOptsOutput
@@ -202,6 +1092,17 @@ func startCLI(args []string) (msg string, display bool, err error) {
 			}
 			display = opts.display
 
+			tool := c.String("tool")
+			if tool == "" {
+				tool = viper.GetString("merge_tool")
+			}
+
+			if tool == "" {
+				msg = "error: specify a merge tool with --tool or merge_tool in config"
+				_ = cli.ShowCommandHelp(c, "merge")
+				return nil
+			}
+
 			var session cache.Session
 			session, _, err = cache.GetSession(opts.useSession,
 				opts.sessKey, opts.server, opts.debug)
@@ -212,34 +1113,33 @@ func startCLI(args []string) (msg string, display bool, err error) {
 			}
 			session.CacheDBPath = cacheDBPath
 
-			var so sndotfiles.SyncOutput
-			so, err = sndotfiles.Sync(sndotfiles.SNDotfilesSyncInput{
-				Session:  &session,
-				Home:     opts.home,
-				Paths:    c.Args(),
-				Exclude:  c.StringSlice("exclude"),
-				PageSize: opts.pageSize,
-				Debug:    opts.debug,
-			}, c.GlobalBool("no-stdout"))
-
+			var mo sndotfiles.MergeOutput
+			mo, err = sndotfiles.Merge(sndotfiles.MergeInput{
+				Session:      &session,
+				Home:         opts.home,
+				Roots:        opts.roots,
+				Paths:        c.Args(),
+				TemplateVars: opts.templateVars,
+				Tool:         tool,
+				Debug:        opts.debug,
+			}, opts.useStdErr)
 			if err != nil {
 				return err
 			}
-			msg = so.Msg
+			msg = mo.Msg
+
+			if opts.output != outputText {
+				msg, err = formatResults(opts.output, mo.Results)
+			}
 
 			return err
 		},
 	}
 
-	addCmd := cli.Command{
-		Name:  "add",
-		Usage: "start tracking file(s)",
-		Flags: []cli.Flag{
-			cli.BoolFlag{
-				Name:  "all",
-				Usage: "add all dotfiles (non-recursive)",
-			},
-		},
+	restoreBackupCmd := cli.Command{
+		Name:      "restore-backup",
+		Usage:     "list backups of overwritten dotfiles, or restore from one",
+		ArgsUsage: "[<backup name> | latest] [path...]",
 		Action: func(c *cli.Context) error {
 			var opts configOptsOutput
 			opts, err = getOpts(c)
@@ -248,32 +1148,6 @@ func startCLI(args []string) (msg string, display bool, err error) {
 			}
 			display = opts.display
 
-			if !c.Bool("all") && len(c.Args()) == 0 {
-				msg = "error: either specify paths to add or --all to add everything"
-				_ = cli.ShowCommandHelp(c, "add")
-				return nil
-			}
-
-			if c.Bool("all") && len(c.Args()) > 0 {
-				msg = "error: specifying --all and paths does not make sense"
-				_ = cli.ShowCommandHelp(c, "add")
-				return nil
-			}
-
-			var absPaths []string
-			for _, path := range c.Args() {
-				var ap string
-				ap, err = filepath.Abs(path)
-				if err != nil {
-					return err
-				}
-				if !isValidDotfilePath(ap) {
-					msg = fmt.Sprintf("\"%s\" is not a valid dotfile path", path)
-					return nil
-				}
-				absPaths = append(absPaths, ap)
-			}
-
 			var session cache.Session
 			session, _, err = cache.GetSession(opts.useSession,
 				opts.sessKey, opts.server, opts.debug)
@@ -284,31 +1158,44 @@ func startCLI(args []string) (msg string, display bool, err error) {
 			}
 			session.CacheDBPath = cacheDBPath
 
-			ai := sndotfiles.AddInput{Session: &session, Home: opts.home, Paths: absPaths,
-				PageSize: opts.pageSize, All: c.Bool("all")}
+			if len(c.Args()) == 0 {
+				var backups []sndotfiles.Backup
+				backups, err = sndotfiles.ListBackups(&session)
+				if err != nil {
+					return err
+				}
+
+				msg, err = formatBackups(opts.output, backups)
 
-			var ao sndotfiles.AddOutput
+				return err
+			}
 
-			ao, err = sndotfiles.Add(ai, true)
+			var ro sndotfiles.RestoreBackupOutput
+			ro, err = sndotfiles.RestoreBackup(sndotfiles.RestoreBackupInput{
+				Session: &session,
+				Home:    opts.home,
+				Roots:   opts.roots,
+				Backup:  c.Args().First(),
+				Paths:   c.Args().Tail(),
+				Debug:   opts.debug,
+			})
 			if err != nil {
 				return err
 			}
+			msg = ro.Msg
 
-			msg = ao.Msg
+			if opts.output != outputText {
+				msg, err = formatResults(opts.output, ro.Results)
+			}
 
 			return err
 		},
 	}
 
-	removeCmd := cli.Command{
-		Name:  "remove",
-		Usage: "stop tracking file(s)",
+	undoCmd := cli.Command{
+		Name:  "undo",
+		Usage: "revert the changes made by the last sync or merge",
 		Action: func(c *cli.Context) error {
-			if len(c.Args()) == 0 {
-				_ = cli.ShowCommandHelp(c, "remove")
-				return nil
-			}
-
 			var opts configOptsOutput
 			opts, err = getOpts(c)
 			if err != nil {
@@ -316,16 +1203,9 @@ func startCLI(args []string) (msg string, display bool, err error) {
 			}
 			display = opts.display
 
-			if len(c.Args()) == 0 {
-				msg = "error: paths not specified"
-				_ = cli.ShowCommandHelp(c, "add")
-				return nil
-			}
-
 			var session cache.Session
 			session, _, err = cache.GetSession(opts.useSession,
-				opts.sessKey, opts.server,
-				opts.debug)
+				opts.sessKey, opts.server, opts.debug)
 			var cacheDBPath string
 			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
 			if err != nil {
@@ -333,29 +1213,30 @@ func startCLI(args []string) (msg string, display bool, err error) {
 			}
 			session.CacheDBPath = cacheDBPath
 
-			ri := sndotfiles.RemoveInput{
-				Session:  &session,
-				Home:     opts.home,
-				Paths:    c.Args(),
-				PageSize: opts.pageSize,
-				Debug:    opts.debug,
-			}
-
-			var ro sndotfiles.RemoveOutput
-
-			ro, err = sndotfiles.Remove(ri, c.Bool("no-stdout"))
+			var uo sndotfiles.UndoOutput
+			uo, err = sndotfiles.Undo(sndotfiles.UndoInput{
+				Session: &session,
+				Home:    opts.home,
+				Roots:   opts.roots,
+				Debug:   opts.debug,
+			}, opts.useStdErr)
 			if err != nil {
 				return err
 			}
-			msg = ro.Msg
+			msg = uo.Msg
+
+			if opts.output != outputText {
+				msg, err = formatResults(opts.output, uo.Results)
+			}
 
 			return err
 		},
 	}
 
-	diffCmd := cli.Command{
-		Name:  "diff",
-		Usage: "display differences between local and remote",
+	historyCmd := cli.Command{
+		Name:      "history",
+		Usage:     "list the changes recorded for a path by recent syncs and merges",
+		ArgsUsage: "<path>",
 		Action: func(c *cli.Context) error {
 			var opts configOptsOutput
 			opts, err = getOpts(c)
@@ -364,20 +1245,37 @@ func startCLI(args []string) (msg string, display bool, err error) {
 			}
 			display = opts.display
 
+			if len(c.Args()) != 1 {
+				msg = "error: specify the path to show the history of"
+				_ = cli.ShowCommandHelp(c, "history")
+				return nil
+			}
+
 			var session cache.Session
 			session, _, err = cache.GetSession(opts.useSession,
 				opts.sessKey, opts.server, opts.debug)
-
 			var cacheDBPath string
-
 			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
 			if err != nil {
 				return err
 			}
-
 			session.CacheDBPath = cacheDBPath
 
-			_, msg, err = sndotfiles.Diff(&session, opts.home, c.Args(), opts.pageSize, true, c.Bool("no-stdout"))
+			var ho sndotfiles.HistoryOutput
+			ho, err = sndotfiles.History(sndotfiles.HistoryInput{
+				Session: &session,
+				Home:    opts.home,
+				Roots:   opts.roots,
+				Path:    c.Args().First(),
+			})
+			if err != nil {
+				return err
+			}
+			msg = ho.Msg
+
+			if opts.output != outputText {
+				msg, err = formatVersions(opts.output, ho.Versions)
+			}
 
 			return err
 		},
@@ -456,9 +1354,13 @@ func startCLI(args []string) (msg string, display bool, err error) {
 				Name:  "force",
 				Usage: "assume user confirmation",
 			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "show what would be removed without making changes",
+			},
 		},
 		BashComplete: func(c *cli.Context) {
-			tasks := []string{"--force"}
+			tasks := []string{"--force", "--dry-run"}
 			if c.NArg() > 0 {
 				return
 			}
@@ -488,7 +1390,7 @@ func startCLI(args []string) (msg string, display bool, err error) {
 			session.CacheDBPath = cacheDBPath
 
 			var proceed bool
-			if c.Bool("force") {
+			if c.Bool("force") || c.Bool("dry-run") {
 				proceed = true
 			} else {
 				fmt.Printf("wipe all dotfiles for account %s? ", email)
@@ -499,12 +1401,19 @@ func startCLI(args []string) (msg string, display bool, err error) {
 				}
 			}
 			if proceed {
-				var num int
-				num, err = sndotfiles.WipeDotfileTagsAndNotes(&session, opts.pageSize, c.Bool("no-stdout"))
+				var wo sndotfiles.WipeOutput
+				wo, err = sndotfiles.Wipe(sndotfiles.WipeInput{
+					Session:  &session,
+					Home:     opts.home,
+					Roots:    opts.roots,
+					PageSize: opts.pageSize,
+					DryRun:   c.Bool("dry-run"),
+				}, c.Bool("no-stdout"))
 				if err != nil {
 					return err
 				}
-				msg = fmt.Sprintf("%d removed", num)
+
+				msg = wo.Msg
 			} else {
 				return nil
 			}
@@ -513,14 +1422,62 @@ func startCLI(args []string) (msg string, display bool, err error) {
 		},
 	}
 
+	migrateTagsCmd := cli.Command{
+		Name:  "migrate-tags",
+		Usage: "rewrite tags for directories with periods in their names",
+		Action: func(c *cli.Context) error {
+			var opts configOptsOutput
+			opts, err = getOpts(c)
+			if err != nil {
+				return err
+			}
+			display = opts.display
+
+			var session cache.Session
+			session, _, err = cache.GetSession(opts.useSession,
+				opts.sessKey, opts.server, opts.debug)
+			var cacheDBPath string
+			cacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, sndotfiles.SNAppName)
+			if err != nil {
+				return err
+			}
+			session.CacheDBPath = cacheDBPath
+
+			var mo sndotfiles.MigrateTagsOutput
+			mo, err = sndotfiles.MigrateTags(sndotfiles.MigrateTagsInput{
+				Session: &session,
+				Home:    opts.home,
+				Roots:   opts.roots,
+				Debug:   opts.debug,
+			}, c.GlobalBool("no-stdout"))
+			if err != nil {
+				return err
+			}
+			msg = mo.Msg
+
+			return err
+		},
+	}
+
 	app.Commands = []cli.Command{
 		statusCmd,
 		syncCmd,
+		watchCmd,
+		daemonCmd,
+		installServiceCmd,
+		serviceStatusCmd,
+		planCmd,
+		applyCmd,
 		addCmd,
 		removeCmd,
 		diffCmd,
+		mergeCmd,
+		restoreBackupCmd,
+		undoCmd,
+		historyCmd,
 		sessionCmd,
 		wipeCmd,
+		migrateTagsCmd,
 	}
 
 	sort.Sort(cli.FlagsByName(app.Flags))
@@ -528,6 +1485,195 @@ func startCLI(args []string) (msg string, display bool, err error) {
 	return msg, display, app.Run(args)
 }
 
+// formatResults renders results as a single JSON document, or as one JSON object per line
+func formatResults(format string, results []sndotfiles.Result) (string, error) {
+	if results == nil {
+		results = []sndotfiles.Result{}
+	}
+
+	if format == outputNDJSON {
+		lines := make([]string, len(results))
+
+		for i := range results {
+			b, err := json.Marshal(results[i])
+			if err != nil {
+				return "", err
+			}
+
+			lines[i] = string(b)
+		}
+
+		return strings.Join(lines, "\n"), nil
+	}
+
+	b, err := json.MarshalIndent(struct {
+		Results []sndotfiles.Result `json:"results"`
+	}{Results: results}, "", "  ")
+
+	return string(b), err
+}
+
+// streamResults returns a function printing each result on its own line as it's made, for ndjson output,
+// or nil if results are printed once the command finishes
+func streamResults(opts configOptsOutput) func(sndotfiles.Result) {
+	if opts.output != outputNDJSON || !opts.display {
+		return nil
+	}
+
+	return func(result sndotfiles.Result) {
+		if b, err := json.Marshal(result); err == nil {
+			fmt.Println(string(b))
+		}
+	}
+}
+
+// formatBackups renders the backups available to restore from, with the paths in each
+func formatBackups(format string, backups []sndotfiles.Backup) (string, error) {
+	if backups == nil {
+		backups = []sndotfiles.Backup{}
+	}
+
+	switch format {
+	case outputNDJSON:
+		lines := make([]string, len(backups))
+
+		for i := range backups {
+			b, err := json.Marshal(backups[i])
+			if err != nil {
+				return "", err
+			}
+
+			lines[i] = string(b)
+		}
+
+		return strings.Join(lines, "\n"), nil
+	case outputJSON:
+		b, err := json.MarshalIndent(struct {
+			Backups []sndotfiles.Backup `json:"backups"`
+		}{Backups: backups}, "", "  ")
+
+		return string(b), err
+	}
+
+	if len(backups) == 0 {
+		return "no backups found", nil
+	}
+
+	var lines []string
+
+	for _, backup := range backups {
+		lines = append(lines, backup.Name)
+		for _, path := range backup.Paths {
+			lines = append(lines, "  "+path)
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// formatVersions renders the recorded versions of a path as a single JSON document, or as one JSON object per line
+func formatVersions(format string, versions []sndotfiles.Version) (string, error) {
+	if versions == nil {
+		versions = []sndotfiles.Version{}
+	}
+
+	if format == outputNDJSON {
+		lines := make([]string, len(versions))
+
+		for i := range versions {
+			b, err := json.Marshal(versions[i])
+			if err != nil {
+				return "", err
+			}
+
+			lines[i] = string(b)
+		}
+
+		return strings.Join(lines, "\n"), nil
+	}
+
+	b, err := json.MarshalIndent(struct {
+		Versions []sndotfiles.Version `json:"versions"`
+	}{Versions: versions}, "", "  ")
+
+	return string(b), err
+}
+
+// reportWatchSync displays the outcome of each sync made while watching, as it happens
+func reportWatchSync(opts configOptsOutput, so sndotfiles.SyncOutput, err error) {
+	if err != nil {
+		if opts.output != outputText {
+			fmt.Fprintln(os.Stderr, formatError(err))
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "%s error: %s\n", time.Now().Format(time.RFC3339), err)
+
+		return
+	}
+
+	if !opts.display {
+		return
+	}
+
+	if opts.output != outputText {
+		out, fErr := formatResults(outputNDJSON, so.Results)
+		if fErr == nil && out != "" {
+			fmt.Println(out)
+		}
+
+		return
+	}
+
+	fmt.Printf("%s\n%s\n", time.Now().Format(time.RFC3339), so.Msg)
+}
+
+// formatDaemonResponse renders the daemon's reply to a request
+func formatDaemonResponse(format string, resp sndotfiles.DaemonResponse) (string, error) {
+	if format != outputText {
+		b, err := json.Marshal(resp)
+		if format == outputJSON {
+			b, err = json.MarshalIndent(resp, "", "  ")
+		}
+
+		return string(b), err
+	}
+
+	if resp.Msg != "" {
+		return resp.Msg, nil
+	}
+
+	lastSync := "never"
+	if resp.LastSync != nil {
+		lastSync = resp.LastSync.Local().Format(time.RFC3339)
+	}
+
+	lines := []string{
+		fmt.Sprintf("paused: %t", resp.Paused),
+		fmt.Sprintf("tracked: %d", resp.Tracked),
+		fmt.Sprintf("last sync: %s", lastSync),
+	}
+
+	if resp.LastError != "" {
+		lines = append(lines, fmt.Sprintf("last error: %s", resp.LastError))
+	}
+
+	if len(resp.Pending) > 0 {
+		lines = append(lines, fmt.Sprintf("pending: %s", strings.Join(resp.Pending, ", ")))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// formatError renders an error as JSON for machine-readable output
+func formatError(err error) string {
+	b, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+
+	return string(b)
+}
+
 func numTrue(in ...bool) (total int) {
 	for _, i := range in {
 		if i {
@@ -553,7 +1699,7 @@ func stripHome(in, home string) (res string, err error) {
 		return
 	}
 
-	if strings.HasPrefix(in, home) {
+	if strings.HasPrefix(in, home+string(os.PathSeparator)) {
 		return in[len(home)+1:], nil
 	}
 
@@ -570,15 +1716,29 @@ func getHome() string {
 	return home
 }
 
-func isValidDotfilePath(path string) bool {
-	home := getHome()
+// readPaths reads paths one per line, ignoring blank lines and comments
+func readPaths(r io.Reader) (paths []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		paths = append(paths, line)
+	}
+
+	return paths, scanner.Err()
+}
 
-	dir, filename := filepath.Split(path)
+// isValidDotfilePath returns true if path is within home, dotted or not, or within a root
+func isValidDotfilePath(path string, roots *sndotfiles.Roots) bool {
+	home := getHome()
 
-	homeRelPath, err := stripHome(dir+filename, home)
+	homeRelPath, err := stripHome(filepath.Clean(path), home)
 	if err != nil {
 		return false
 	}
 
-	return strings.HasPrefix(homeRelPath, ".")
+	return homeRelPath != "" || roots.Contains(path)
 }
@@ -134,11 +134,18 @@ func TestStripHome(t *testing.T) {
 
 func TestIsValidDotfilePath(t *testing.T) {
 	home := getHome()
-	assert.True(t, isValidDotfilePath(fmt.Sprintf("%s/.test", home)))
-	assert.True(t, isValidDotfilePath(fmt.Sprintf("%s/.test/file.txt", home)))
-	assert.True(t, isValidDotfilePath(fmt.Sprintf("%s/.test/test2/file.txt", home)))
-	assert.False(t, isValidDotfilePath(fmt.Sprintf("%s/test/test2/file.txt", home)))
-	assert.False(t, isValidDotfilePath(fmt.Sprintf("%s/test", home)))
+	assert.True(t, isValidDotfilePath(fmt.Sprintf("%s/.test", home), nil))
+	assert.True(t, isValidDotfilePath(fmt.Sprintf("%s/.test/file.txt", home), nil))
+	assert.True(t, isValidDotfilePath(fmt.Sprintf("%s/.test/test2/file.txt", home), nil))
+	assert.True(t, isValidDotfilePath(fmt.Sprintf("%s/test/test2/file.txt", home), nil))
+	assert.True(t, isValidDotfilePath(fmt.Sprintf("%s/test", home), nil))
+	assert.False(t, isValidDotfilePath(home, nil))
+	assert.False(t, isValidDotfilePath(home+"test", nil))
+	assert.False(t, isValidDotfilePath("/var/lib/test", nil))
+
+	roots, err := sndotfiles2.NewRoots(map[string]string{"lib": "/var/lib"}, "")
+	assert.NoError(t, err)
+	assert.True(t, isValidDotfilePath("/var/lib/test", roots))
 }
 
 func TestAdd(t *testing.T) {
@@ -428,6 +435,96 @@ func TestNumTrue(t *testing.T) {
 	assert.Equal(t, 0, numTrue())
 }
 
+func TestFormatResults(t *testing.T) {
+	results := []sndotfiles2.Result{
+		{Path: ".apple", Tag: "dotfiles", NoteUUID: "1234", Diff: "local newer", Action: sndotfiles2.ActionPushed},
+		{Path: ".lemon", Action: sndotfiles2.ActionNone},
+	}
+
+	out, err := formatResults(outputJSON, results)
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"results": [`)
+	assert.Contains(t, out, `"note_uuid": "1234"`)
+	assert.Contains(t, out, `"action": "pushed"`)
+
+	out, err = formatResults(outputNDJSON, results)
+	assert.NoError(t, err)
+	lines := strings.Split(out, "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, `{"path":".lemon","action":"none"}`, lines[1])
+
+	out, err = formatResults(outputJSON, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"results": []`)
+
+	assert.Equal(t, `{"error":"failed"}`, formatError(fmt.Errorf("failed")))
+}
+
+func TestFormatBackups(t *testing.T) {
+	backups := []sndotfiles2.Backup{
+		{Name: "20200101T000000Z", Paths: []string{".apple", ".fruit/lemon"}},
+	}
+
+	out, err := formatBackups(outputText, backups)
+	assert.NoError(t, err)
+	assert.Equal(t, "20200101T000000Z\n  .apple\n  .fruit/lemon", out)
+
+	out, err = formatBackups(outputNDJSON, backups)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"20200101T000000Z","paths":[".apple",".fruit/lemon"]}`, out)
+
+	out, err = formatBackups(outputJSON, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"backups": []`)
+
+	out, err = formatBackups(outputText, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "no backups found", out)
+}
+
+func TestFormatVersions(t *testing.T) {
+	versions := []sndotfiles2.Version{
+		{Run: 2, Side: "remote", Action: sndotfiles2.ActionPushed, AfterHash: "abcd"},
+		{Run: 1, Side: "local", Action: sndotfiles2.ActionPulled, BeforeHash: "1234", AfterHash: "5678", Undone: true},
+	}
+
+	out, err := formatVersions(outputJSON, versions)
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"versions": [`)
+	assert.Contains(t, out, `"undone": true`)
+
+	out, err = formatVersions(outputNDJSON, versions)
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(out, "\n"), 2)
+
+	out, err = formatVersions(outputJSON, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"versions": []`)
+}
+
+func TestFormatDaemonResponse(t *testing.T) {
+	resp := sndotfiles2.DaemonResponse{OK: true, Paused: true, Tracked: 2, Pending: []string{".apple"}}
+
+	out, err := formatDaemonResponse(outputText, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "paused: true\ntracked: 2\nlast sync: never\npending: .apple", out)
+
+	out, err = formatDaemonResponse(outputNDJSON, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"ok":true,"paused":true,"tracked":2,"pending":[".apple"]}`, out)
+
+	resp.Msg = "nothing to do"
+	out, err = formatDaemonResponse(outputText, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "nothing to do", out)
+}
+
+func TestReadPaths(t *testing.T) {
+	paths, err := readPaths(strings.NewReader("/home/me/.apple\n\n# comment\n  /home/me/.config/lemon  \n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/home/me/.apple", "/home/me/.config/lemon"}, paths)
+}
+
 func createPathWithContent(path, content string) error {
 	dir, _ := filepath.Split(path)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
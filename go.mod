@@ -9,8 +9,8 @@ require (
 	github.com/danieljoos/wincred v1.1.2 // indirect
 	github.com/fatih/color v1.13.0
 	github.com/fatih/set v0.2.1
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/godbus/dbus/v5 v5.0.6 // indirect
-	github.com/jonhadfield/findexec v0.0.0-20190902195615-78db24cd4e77
 	github.com/jonhadfield/gosn-v2 v0.0.0-20211123204812-5a0242ddbf0d
 	github.com/kr/text v0.2.0 // indirect
 	github.com/lithammer/shortuuid v3.0.0+incompatible
@@ -21,6 +21,7 @@ require (
 	github.com/spf13/viper v1.9.0
 	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli v1.22.5
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/crypto v0.0.0-20211202192323-5770296d904e // indirect
 	golang.org/x/sys v0.0.0-20211124211545-fe61309f8881 // indirect
 	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211 // indirect
@@ -4,18 +4,25 @@ import (
 	"errors"
 	"fmt"
 	"github.com/asdine/storm/v3"
-	"github.com/briandowns/spinner"
 	"github.com/jonhadfield/gosn-v2"
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/ryanuber/columnize"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-	"time"
+)
+
+const (
+	// DefaultAddDepth limits add --all to the dotfiles directly in home
+	DefaultAddDepth = 1
+	// maxFileSize is the largest file that can be added
+	maxFileSize = 10240000
 )
 
 // Add tracks local Paths by pushing the local dir as a tag representation and the filename as a note title
+// if DryRun is set, the paths that would be tracked and tags that would be created are reported instead
 func Add(ai AddInput, useStdErr bool) (ao AddOutput, err error) {
 	// validate session
 	if !ai.Session.Valid() {
@@ -28,14 +35,31 @@ func Add(ai AddInput, useStdErr bool) (ao AddOutput, err error) {
 		return
 	}
 
+	if !symlinkModeValid(ai.Symlinks) {
+		err = fmt.Errorf("invalid symlink mode '%s'", ai.Symlinks)
+		return
+	}
+
 	var noRecurse bool
 	if ai.All {
 		noRecurse = true
 
-		ai.Paths, err = discoverDotfilesInHome(ai.Home, ai.Session.Debug)
+		ai.Paths, err = DiscoverDotfiles(ai.Home, filepath.Dir(ai.Session.CacheDBPath), ai.Depth, ai.Session.Debug)
 		if err != nil {
 			return
 		}
+
+		if ai.Interactive && len(ai.Paths) > 0 {
+			ai.Paths, err = selectInteractively(ai.Paths, ai.Home)
+			if err != nil {
+				return
+			}
+
+			if len(ai.Paths) == 0 {
+				ao.Msg = "nothing selected"
+				return
+			}
+		}
 	}
 
 	// check paths defined
@@ -48,22 +72,16 @@ func Add(ai AddInput, useStdErr bool) (ao AddOutput, err error) {
 		return
 	}
 
+	ai.Paths, err = expandGlobs(ai.Paths, ai.Home, ai.Roots, newIgnorer(ai.Home))
+	if err != nil {
+		return
+	}
+
 	debugPrint(ai.Session.Debug, fmt.Sprintf("Add | paths after dedupe: %d", len(ai.Paths)))
 
 	if !ai.Session.Debug {
-		prefix := HiWhite("syncing ")
-		if _, err = os.Stat(ai.Session.CacheDBPath); os.IsNotExist(err) {
-			prefix = HiWhite("initializing ")
-		}
-
-		s := spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stdout))
-		if useStdErr {
-			s = spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stderr))
-		}
-
-		s.Prefix = prefix
-		s.Start()
-		defer s.Stop()
+		stop := startSpinner(ai.Session, useStdErr)
+		defer stop()
 	}
 
 	// get populated db
@@ -94,6 +112,14 @@ func Add(ai AddInput, useStdErr bool) (ao AddOutput, err error) {
 	ai.Twn = twn
 
 	ao, err = add(cso.DB, ai, noRecurse)
+	if ai.DryRun {
+		if cErr := cso.DB.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+
+		return
+	}
+
 	si.CacheDB = cso.DB
 	// syncDBwithFS db back to SN
 	si.Close = true
@@ -103,17 +129,29 @@ func Add(ai AddInput, useStdErr bool) (ao AddOutput, err error) {
 }
 
 type AddInput struct {
-	Session  *cache.Session
-	Home     string
-	Paths    []string
-	All      bool
-	Twn      tagsWithNotes
-	PageSize int
+	Session    *cache.Session
+	Home       string
+	Paths      []string
+	All        bool
+	Symlinks   string
+	NestedTags bool
+	Template   bool
+	Twn        tagsWithNotes
+	PageSize   int
+	DryRun     bool
+
+	// Depth is how many levels below home All looks for dotfiles, defaulting to DefaultAddDepth
+	Depth int
+	// Interactive asks which of the dotfiles discovered by All to add
+	Interactive bool
+	// Roots are the directories outside home that paths can be added from
+	Roots *Roots
 }
 
 type AddOutput struct {
 	TagsPushed, NotesPushed                 int
 	PathsAdded, PathsExisting, PathsInvalid []string
+	Results                                 []Result
 	Msg                                     string
 }
 
@@ -123,7 +161,7 @@ func add(db *storm.DB, ai AddInput, noRecurse bool) (ao AddOutput, err error) {
 	var fsPathsToAdd []string
 
 	// generate list of Paths to add
-	fsPathsToAdd, err = getLocalFSPaths(ai.Paths, noRecurse)
+	fsPathsToAdd, err = getLocalFSPaths(ai.Paths, noRecurse, ai.Symlinks, newIgnorer(ai.Home))
 	if err != nil {
 		return
 	}
@@ -134,7 +172,7 @@ func add(db *storm.DB, ai AddInput, noRecurse bool) (ao AddOutput, err error) {
 
 	var statusLines []string
 
-	statusLines, tagToItemMap, ao.PathsAdded, ao.PathsExisting, err = generateTagItemMap(fsPathsToAdd, ai.Home, ai.Twn)
+	statusLines, tagToItemMap, ao.PathsAdded, ao.PathsExisting, err = generateTagItemMap(fsPathsToAdd, ai.Home, ai.Roots, ai.Twn, ai.Symlinks, ai.Template)
 	if err != nil {
 		return
 	}
@@ -146,8 +184,19 @@ func add(db *storm.DB, ai AddInput, noRecurse bool) (ao AddOutput, err error) {
 		tagToItemMap[DotFilesTag] = gosn.Items{}
 	}
 
+	ao.Results = addResults(ao.PathsExisting, tagToItemMap, ai.Home, ai.Roots, ai.Twn, ai.DryRun)
+
+	if ai.DryRun {
+		return planAdd(db, ai, tagToItemMap, ao)
+	}
+
+	// record added content as the base for the next sync
+	if err = recordAddedSyncBases(db, tagToItemMap, ai.Home, ai.Roots); err != nil {
+		return
+	}
+
 	// addToDB and tag items
-	ao.TagsPushed, ao.NotesPushed, err = pushAndTag(db, ai.Session, tagToItemMap, ai.Twn)
+	ao.TagsPushed, ao.NotesPushed, err = pushAndTag(db, ai.Session, tagToItemMap, ai.Twn, ai.NestedTags, false)
 	if err != nil {
 		return
 	}
@@ -159,7 +208,7 @@ func add(db *storm.DB, ai AddInput, noRecurse bool) (ao AddOutput, err error) {
 	return ao, err
 }
 
-func generateTagItemMap(fsPaths []string, home string, twn tagsWithNotes) (statusLines []string,
+func generateTagItemMap(fsPaths []string, home string, roots *Roots, twn tagsWithNotes, symlinkMode string, template bool) (statusLines []string,
 	tagToItemMap map[string]gosn.Items, pathsAdded, pathsExisting []string, err error) {
 	tagToItemMap = make(map[string]gosn.Items)
 
@@ -169,11 +218,11 @@ func generateTagItemMap(fsPaths []string, home string, twn tagsWithNotes) (statu
 
 	for _, path := range fsPaths {
 		dir, filename := filepath.Split(path)
-		homeRelPath := stripHome(dir+filename, home)
+		homeRelPath := stripHome(dir+filename, home, roots)
 		boldHomeRelPath := bold(homeRelPath)
 
 		var remoteTagTitleWithoutHome, remoteTagTitle string
-		remoteTagTitleWithoutHome = stripHome(dir, home)
+		remoteTagTitleWithoutHome = stripHome(dir, home, roots)
 		remoteTagTitle = pathToTag(remoteTagTitleWithoutHome)
 
 		existingCount := noteWithTagExists(remoteTagTitle, filename, twn)
@@ -186,12 +235,24 @@ func generateTagItemMap(fsPaths []string, home string, twn tagsWithNotes) (statu
 			err = fmt.Errorf("duplicate items found with name '%s' and tag '%s'", filename, remoteTagTitle)
 			return statusLines, tagToItemMap, pathsAdded, pathsExisting, err
 		}
+		if err = alternateValid(filename); err != nil {
+			return statusLines, tagToItemMap, pathsAdded, pathsExisting, err
+		}
+
 		// now add
 		pathsAdded = append(pathsAdded, path)
 
 		var itemToAdd gosn.Note
 
-		itemToAdd, err = createItem(path, filename)
+		if symlinkMode == SymlinksTrack && isSymlink(path) {
+			itemToAdd, err = createSymlinkItem(path, filename)
+		} else {
+			itemToAdd, err = createItem(path, filename)
+			if err == nil && template {
+				err = setNoteTemplate(&itemToAdd)
+			}
+		}
+
 		if err != nil {
 			return
 		}
@@ -206,16 +267,151 @@ func generateTagItemMap(fsPaths []string, home string, twn tagsWithNotes) (statu
 	return statusLines, tagToItemMap, pathsAdded, pathsExisting, err
 }
 
-func getLocalFSPaths(paths []string, noRecurse bool) (finalPaths []string, err error) {
+// planAdd reports the paths that would be tracked and the tags that would be created, without pushing anything
+func planAdd(db *storm.DB, ai AddInput, tagToItemMap map[string]gosn.Items, ao AddOutput) (AddOutput, error) {
+	var err error
+
+	ao.TagsPushed, ao.NotesPushed, err = pushAndTag(db, ai.Session, tagToItemMap, ai.Twn, ai.NestedTags, true)
+	if err != nil {
+		return ao, err
+	}
+
+	var lines []string
+
+	for _, path := range ao.PathsExisting {
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(stripHome(path, ai.Home, ai.Roots)), yellow("already tracked")))
+	}
+
+	for _, path := range ao.PathsAdded {
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(stripHome(path, ai.Home, ai.Roots)), yellow("would be tracked")))
+	}
+
+	for _, title := range missingTagTitles(tagToItemMap, ai.Twn) {
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(title), yellow("would create tag")))
+	}
+
+	ao.Msg = fmt.Sprint(columnize.SimpleFormat(lines))
+
+	return ao, err
+}
+
+// addResults returns a result for each path already tracked and each note to be pushed, sorted by path
+func addResults(pathsExisting []string, tagToItemMap map[string]gosn.Items, home string, roots *Roots, twn tagsWithNotes, dryRun bool) (results []Result) {
+	for _, path := range pathsExisting {
+		dir, filename := filepath.Split(path)
+		result := Result{
+			Path:   stripHome(path, home, roots),
+			Tag:    pathToTag(stripHome(dir, home, roots)),
+			Action: ActionNone,
+		}
+
+		for _, t := range twn {
+			for _, note := range t.notes {
+				if t.title() == result.Tag && note.Content.GetTitle() == filename {
+					result.NoteUUID = note.UUID
+				}
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	action := ActionAdded
+	if dryRun {
+		action = ActionWouldAdd
+	}
+
+	for tagTitle, items := range tagToItemMap {
+		dir, err := tagTitleToFSDir(tagTitle, home, roots)
+		if err != nil {
+			continue
+		}
+
+		for _, note := range items.Notes() {
+			results = append(results, Result{
+				Path:     stripHome(dir+note.Content.GetTitle(), home, roots),
+				Tag:      tagTitle,
+				NoteUUID: note.UUID,
+				Action:   action,
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+
+	return results
+}
+
+func recordAddedSyncBases(db *storm.DB, tagToItemMap map[string]gosn.Items, home string, roots *Roots) error {
+	var itemDiffs []ItemDiff
+
+	for tagTitle, items := range tagToItemMap {
+		dir, err := tagTitleToFSDir(tagTitle, home, roots)
+		if err != nil {
+			return err
+		}
+
+		for _, note := range items.Notes() {
+			// alternates and templates are materialised differently from how they were added
+			if isAlternate(note.Content.GetTitle()) || getNoteMeta(note).Template {
+				continue
+			}
+
+			itemDiffs = append(itemDiffs, ItemDiff{
+				tagTitle:    tagTitle,
+				noteTitle:   note.Content.GetTitle(),
+				path:        dir + note.Content.GetTitle(),
+				homeRelPath: stripHome(dir+note.Content.GetTitle(), home, roots),
+				remote:      note,
+			})
+		}
+	}
+
+	return recordSyncBases(db, itemDiffs)
+}
+
+// getLocalFSPaths returns the files and symlinks to add from the paths specified, walking directories
+// unless noRecurse is set, and skipping those ignored
+func getLocalFSPaths(paths []string, noRecurse bool, symlinkMode string, ig *ignorer) (finalPaths []string, err error) {
 	// check for directories
 	for _, path := range paths {
+		if ig.ignoredPath(path) {
+			continue
+		}
+
 		// if path is directory, then walk to generate list of additional Paths
 		var stat os.FileInfo
-		if stat, err = os.Stat(path); err == nil && stat.IsDir() && !noRecurse {
+		if isSymlink(path) {
+			// symlinks are not walked, even if pointing to a directory
+			var valid bool
+			valid, err = symlinkPathValid(path, symlinkMode)
+			if err != nil {
+				return
+			}
+			if valid {
+				finalPaths = append(finalPaths, path)
+			}
+		} else if stat, err = os.Stat(path); err == nil && stat.IsDir() && !noRecurse {
 			err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
 				if err != nil {
 					return fmt.Errorf("failed to read path %q: %v", path, err)
 				}
+				if ig.ignored(path, info.IsDir()) {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if isSymlink(path) {
+					var valid bool
+					valid, err = symlinkPathValid(path, symlinkMode)
+					if valid {
+						finalPaths = append(finalPaths, path)
+					}
+					return err
+				}
 				stat, err = os.Stat(path)
 				if err != nil {
 					return err
@@ -282,6 +478,13 @@ func createItem(path, title string) (item gosn.Note, err error) {
 		return
 	}
 
+	var stat os.FileInfo
+
+	stat, err = file.Stat()
+	if err != nil {
+		return
+	}
+
 	localStr := string(localBytes)
 	// addToDB item
 	item = gosn.NewNote()
@@ -291,6 +494,8 @@ func createItem(path, title string) (item gosn.Note, err error) {
 	item.Content.SetText(localStr)
 	// prevent a default editor parsing as html when selected via app
 	item.Content.SetPrefersPlainEditor(true)
+	// record permissions so they can be restored when pulled
+	setNoteMode(&item, stat.Mode())
 
 	return item, err
 }
@@ -311,32 +516,83 @@ func pathInfo(path string) (mode os.FileMode, pathSize int64, err error) {
 	return
 }
 
-func discoverDotfilesInHome(home string, debug bool) (paths []string, err error) {
-	debugPrint(debug, fmt.Sprintf("discoverDotfilesInHome | checking home: %s", home))
+// DiscoverDotfiles returns the dotfiles add --all would add: the regular files in home, and in dot directories
+// up to depth levels below it, that aren't ignored or too large
+// the cache directory, if set, is skipped as it holds the cache db, trash and backups
+func DiscoverDotfiles(home, cacheDir string, depth int, debug bool) (paths []string, err error) {
+	var skip []string
+	if cacheDir != "" {
+		skip = append(skip, cacheDir)
+	}
+
+	return discoverDotfilesInHome(home, depth, skip, newIgnorer(home), debug)
+}
 
-	var homeEntries []os.FileInfo
+// discoverDotfilesInHome walks home for dotfiles to add, to the depth specified, skipping the directories in skip
+// along with the default cache directory
+func discoverDotfilesInHome(home string, depth int, skip []string, ig *ignorer, debug bool) (paths []string, err error) {
+	debugPrint(debug, fmt.Sprintf("discoverDotfilesInHome | checking home: %s to depth: %d", home, depth))
 
-	homeEntries, err = ioutil.ReadDir(home)
+	if depth <= 0 {
+		depth = DefaultAddDepth
+	}
+
+	home, err = filepath.Abs(home)
 	if err != nil {
 		return
 	}
 
-	for _, f := range homeEntries {
-		if strings.HasPrefix(f.Name(), ".") {
-			var afp string
+	// the cache directory holds the db, trash and backups, which aren't dotfiles
+	skip = append(skip, filepath.Join(home, "."+SNAppName))
 
-			afp, err = filepath.Abs(home + string(os.PathSeparator) + f.Name())
-			if err != nil {
-				return
+	err = filepath.Walk(home, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == home {
+				return err
 			}
 
-			if f.Mode().IsRegular() {
-				paths = append(paths, afp)
+			debugPrint(debug, fmt.Sprintf("discoverDotfilesInHome | skipping unreadable: %s", path))
+
+			return nil
+		}
+
+		if path == home {
+			return nil
+		}
+
+		if !inDotPath(path, home) || StringInSlice(path, skip, true) || ig.ignored(path, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
+
+			return nil
 		}
-	}
 
-	return
+		if info.IsDir() {
+			// files in a directory at depth would be too deep
+			if strings.Count(stripHome(path, home, nil), string(os.PathSeparator))+1 >= depth {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if info.Size() > maxFileSize {
+			debugPrint(debug, fmt.Sprintf("discoverDotfilesInHome | skipping too large: %s", path))
+
+			return nil
+		}
+
+		paths = append(paths, path)
+
+		return nil
+	})
+
+	return paths, err
 }
 
 func pathValid(path string) (valid bool, err error) {
@@ -351,7 +607,7 @@ func pathValid(path string) (valid bool, err error) {
 
 	switch {
 	case mode.IsRegular():
-		if pSize > 10240000 {
+		if pSize > maxFileSize {
 			err = fmt.Errorf("file too large: %s", path)
 			return false, err
 		}
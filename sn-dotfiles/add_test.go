@@ -6,8 +6,10 @@ import (
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/lithammer/shortuuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -207,6 +209,53 @@ func TestAddAll(t *testing.T) {
 	assert.Equal(t, 0, len(ao.PathsInvalid))
 }
 
+func TestDiscoverDotfilesInHome(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	for _, path := range []string{".file1", "file2", ".config/app/settings", ".config/app/nested/deep", "dir/.file3",
+		".sn-dotfiles/db", ".cache/data"} {
+		require.NoError(t, createPathWithContent(filepath.Join(home, path), path))
+	}
+
+	// files too large to add are skipped
+	require.NoError(t, os.Truncate(filepath.Join(home, ".config/app/settings"), maxFileSize+1))
+	require.NoError(t, createPathWithContent(filepath.Join(home, ".config/app/small"), "small"))
+
+	discover := func(depth int, skip ...string) (rel []string) {
+		paths, err := discoverDotfilesInHome(home, depth, skip, nil, false)
+		require.NoError(t, err)
+
+		for _, path := range paths {
+			rel = append(rel, stripHome(path, home, nil))
+		}
+
+		return rel
+	}
+
+	assert.Equal(t, []string{".file1"}, discover(0))
+	assert.Equal(t, []string{".cache/data", ".file1"}, discover(2))
+	assert.Equal(t, []string{".cache/data", ".config/app/small", ".file1"}, discover(3))
+	assert.Equal(t, []string{".config/app/nested/deep", ".config/app/small", ".file1"}, discover(10, filepath.Join(home, ".cache")))
+}
+
+func TestDiscoverDotfilesSkipsCacheDir(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	for _, path := range []string{".file1", ".cachedb/sn-dotfiles.db", ".config/app"} {
+		require.NoError(t, createPathWithContent(filepath.Join(home, path), path))
+	}
+
+	paths, err := DiscoverDotfiles(home, filepath.Join(home, ".cachedb"), 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(home, ".config/app"), filepath.Join(home, ".file1")}, paths)
+
+	paths, err = DiscoverDotfiles(home, "", 2, false)
+	require.NoError(t, err)
+	assert.Contains(t, paths, filepath.Join(home, ".cachedb/sn-dotfiles.db"))
+}
+
 func TestCheckPathValid(t *testing.T) {
 	home := getTemporaryHome()
 	d1 := []byte("test file")
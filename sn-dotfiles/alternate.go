@@ -0,0 +1,137 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"github.com/jonhadfield/gosn-v2"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// AlternateSeparator separates a dotfile's name from the conditions under which it is used,
+// e.g. .gitconfig##host.worklaptop or .gitconfig##os.darwin
+const AlternateSeparator = "##"
+
+// hostFacts describes the host that alternates are selected for
+type hostFacts struct {
+	host string
+	os   string
+}
+
+func currentHostFacts() hostFacts {
+	host, _ := os.Hostname()
+
+	return hostFacts{
+		host: strings.ToLower(host),
+		os:   runtime.GOOS,
+	}
+}
+
+// splitAlternate returns the name a dotfile is materialised as, along with its conditions, if any
+func splitAlternate(name string) (canonical string, conditions []string) {
+	idx := strings.Index(name, AlternateSeparator)
+	if idx < 1 {
+		return name, nil
+	}
+
+	return name[:idx], strings.Split(name[idx+len(AlternateSeparator):], ",")
+}
+
+func isAlternate(name string) bool {
+	_, conditions := splitAlternate(name)
+
+	return conditions != nil
+}
+
+// alternateValid checks each of the alternate's conditions is supported
+func alternateValid(name string) error {
+	_, conditions := splitAlternate(name)
+	for _, c := range conditions {
+		if c == "default" {
+			continue
+		}
+
+		parts := strings.SplitN(c, ".", 2)
+		if len(parts) != 2 || parts[1] == "" || !StringInSlice(parts[0], []string{"host", "hostname", "h", "os", "o"}, true) {
+			return fmt.Errorf("invalid alternate condition '%s' in: %s", c, name)
+		}
+	}
+
+	return nil
+}
+
+// alternateScore returns whether an alternate's conditions all match the host, and if so,
+// a score that is higher the more specific the match, with host matches outranking os matches
+func alternateScore(conditions []string, facts hostFacts) (score int, matches bool) {
+	for _, c := range conditions {
+		if c == "default" {
+			continue
+		}
+
+		parts := strings.SplitN(c, ".", 2)
+		if len(parts) != 2 {
+			return 0, false
+		}
+
+		switch parts[0] {
+		case "host", "hostname", "h":
+			shortHost := strings.SplitN(facts.host, ".", 2)[0]
+			if !strings.EqualFold(parts[1], facts.host) && !strings.EqualFold(parts[1], shortHost) {
+				return 0, false
+			}
+
+			score += 2
+		case "os", "o":
+			if !strings.EqualFold(parts[1], facts.os) {
+				return 0, false
+			}
+
+			score++
+		default:
+			return 0, false
+		}
+	}
+
+	return score, true
+}
+
+// alternate is the note selected to be materialised at a canonical name
+type alternate struct {
+	canonical string
+	note      gosn.Note
+}
+
+// selectAlternates returns the best matching note for each canonical name found in a tag's notes,
+// in the order the canonical names first appear
+// notes without conditions match any host with the lowest score, so are used if nothing more specific matches
+func selectAlternates(notes gosn.Notes, facts hostFacts) (selected []alternate) {
+	scores := make(map[string]int)
+
+	for _, note := range notes {
+		canonical, conditions := splitAlternate(note.Content.GetTitle())
+
+		score, matches := alternateScore(conditions, facts)
+		if !matches {
+			continue
+		}
+
+		if best, found := scores[canonical]; found {
+			if score > best {
+				scores[canonical] = score
+
+				for x := range selected {
+					if selected[x].canonical == canonical {
+						selected[x].note = note
+					}
+				}
+			}
+
+			continue
+		}
+
+		scores[canonical] = score
+		selected = append(selected, alternate{canonical: canonical, note: note})
+	}
+
+	return selected
+}
@@ -0,0 +1,95 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitAlternate(t *testing.T) {
+	canonical, conditions := splitAlternate(".gitconfig##host.worklaptop,os.darwin")
+	assert.Equal(t, ".gitconfig", canonical)
+	assert.Equal(t, []string{"host.worklaptop", "os.darwin"}, conditions)
+
+	canonical, conditions = splitAlternate(".gitconfig")
+	assert.Equal(t, ".gitconfig", canonical)
+	assert.Nil(t, conditions)
+	assert.False(t, isAlternate("##host.worklaptop"))
+}
+
+func TestAlternateValid(t *testing.T) {
+	assert.NoError(t, alternateValid(".gitconfig"))
+	assert.NoError(t, alternateValid(".gitconfig##default"))
+	assert.NoError(t, alternateValid(".gitconfig##h.worklaptop,o.linux"))
+	assert.Error(t, alternateValid(".gitconfig##distro.ubuntu"))
+	assert.Error(t, alternateValid(".gitconfig##host."))
+}
+
+func TestSelectAlternates(t *testing.T) {
+	facts := hostFacts{host: "worklaptop.example.com", os: "darwin"}
+
+	plain := createNote(".gitconfig", "plain")
+	darwin := createNote(".gitconfig##os.darwin", "darwin")
+	host := createNote(".gitconfig##host.WorkLaptop", "host")
+	other := createNote(".gitconfig##host.other", "other")
+	vimrc := createNote(".vimrc##os.linux", "vimrc")
+	zshrc := createNote(".zshrc", "zshrc")
+
+	selected := selectAlternates(gosn.Notes{plain, darwin, zshrc, host, other, vimrc}, facts)
+	require.Len(t, selected, 2)
+	assert.Equal(t, ".gitconfig", selected[0].canonical)
+	assert.Equal(t, "host", selected[0].note.Content.GetText())
+	assert.Equal(t, ".zshrc", selected[1].canonical)
+
+	selected = selectAlternates(gosn.Notes{plain, darwin}, hostFacts{host: "server", os: "linux"})
+	require.Len(t, selected, 1)
+	assert.Equal(t, "plain", selected[0].note.Content.GetText())
+}
+
+func TestRemoteTrackedPathsIncludesAlternates(t *testing.T) {
+	home := getTemporaryHome()
+
+	twn := tagsWithNotes{tagWithNotes{
+		tag:   createTag(DotFilesTag),
+		notes: gosn.Notes{createNote(".gitconfig##host.other", "other"), createNote(".gitconfig", "plain")},
+	}}
+
+	tracked := remoteTrackedPaths(twn, home, nil)
+	assert.True(t, tracked[".gitconfig"])
+	assert.True(t, tracked[".gitconfig##host.other"])
+}
+
+// TestSyncKeepsAddedAlternate checks an alternate added locally isn't treated as deleted remotely on the next sync
+func TestSyncKeepsAddedAlternate(t *testing.T) {
+	defer func() {
+		if err := CleanUp(*testCacheSession); err != nil {
+			fmt.Println("failed to wipe")
+		}
+	}()
+
+	home := getTemporaryHome()
+	altPath := fmt.Sprintf("%s/.gitconfig##host.other", home)
+	require.NoError(t, createTemporaryFiles(map[string]string{altPath: "other content"}))
+
+	ao, err := Add(AddInput{Session: testCacheSession, Home: home, Paths: []string{altPath}}, true)
+	require.NoError(t, err)
+	require.Len(t, ao.PathsAdded, 1)
+
+	so, err := Sync(SNDotfilesSyncInput{
+		Session: testCacheSession,
+		Home:    home,
+		Paths:   []string{},
+		Exclude: []string{},
+		Debug:   true,
+	}, true)
+	require.NoError(t, err)
+	assert.Equal(t, 0, so.NoTrashed)
+
+	content, err := ioutil.ReadFile(altPath)
+	require.NoError(t, err)
+	assert.Equal(t, "other content", string(content))
+}
@@ -0,0 +1,172 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// maxTempAttempts is the number of names tried when creating a temporary file alongside a dotfile
+const maxTempAttempts = 10000
+
+// tempPath returns a hidden path alongside path that a replacement can be written to before being renamed into place
+func tempPath(path string, attempt int) string {
+	dir, name := filepath.Split(path)
+
+	return filepath.Join(dir, fmt.Sprintf(".%s.%s-%s", name, SNAppName,
+		strconv.FormatInt(time.Now().UnixNano()+int64(attempt), 36)))
+}
+
+// writeFileAtomic replaces the file at path with content, so it is either left untouched or fully written
+// if mode isn't set then the mode of any existing file is kept, otherwise a new file gets 0666 less the umask
+// a symlink at path is written through, replacing the file it points to rather than the link
+func writeFileAtomic(path, content string, mode os.FileMode, modeFound bool) (err error) {
+	if resolved, rErr := filepath.EvalSymlinks(path); rErr == nil {
+		path = resolved
+	}
+
+	if !modeFound {
+		if stat, sErr := os.Stat(path); sErr == nil {
+			mode, modeFound = stat.Mode().Perm(), true
+		}
+	}
+
+	var f *os.File
+
+	var tmp string
+
+	// a file with a mode is created readable by the user alone, so others can't read its content before the mode is set
+	perm := os.FileMode(0o666)
+	if modeFound {
+		perm = 0o600
+	}
+
+	for attempt := 0; attempt < maxTempAttempts; attempt++ {
+		tmp = tempPath(path, attempt)
+
+		f, err = os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	// restore recorded mode as the umask won't reflect it
+	if modeFound {
+		if err = f.Chmod(mode); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	if _, err = f.WriteString(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// symlinkAtomic replaces any symlink at path with one to target
+func symlinkAtomic(target, path string) (err error) {
+	var tmp string
+
+	for attempt := 0; attempt < maxTempAttempts; attempt++ {
+		tmp = tempPath(path, attempt)
+
+		err = os.Symlink(target, tmp)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes a directory so entries renamed into it survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err = d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+
+	return d.Close()
+}
+
+// copyLocal copies a dotfile, or symlink, to dest keeping its mode
+// if follow, a symlink is copied as the content of the file it points to, as for those added with SymlinksFollow
+func copyLocal(path, dest string, follow bool, roots *Roots) error {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if follow && stat.Mode()&os.ModeSymlink != 0 {
+		if stat, err = os.Stat(path); err != nil {
+			return err
+		}
+	}
+
+	if err = mkdirLocal(filepath.Dir(dest), 0o700, roots); err != nil {
+		return err
+	}
+
+	if stat.Mode()&os.ModeSymlink != 0 {
+		var target string
+
+		target, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+
+		return symlinkLocal(target, dest, roots)
+	}
+
+	var b []byte
+
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return writeLocalFile(dest, string(b), stat.Mode().Perm(), true, roots)
+}
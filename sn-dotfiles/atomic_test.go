@@ -0,0 +1,67 @@
+package sndotfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	home := getTemporaryHome()
+	require.NoError(t, os.MkdirAll(home, 0o700))
+
+	defer os.RemoveAll(home)
+
+	applePath := filepath.Join(home, ".apple")
+
+	// a recorded mode is applied
+	require.NoError(t, writeFileAtomic(applePath, "apple content", 0o600, true))
+
+	stat, err := os.Stat(applePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+	// an existing file's mode is kept if no mode is recorded
+	require.NoError(t, os.Chmod(applePath, 0o640))
+	require.NoError(t, writeFileAtomic(applePath, "new apple content", 0, false))
+
+	stat, err = os.Stat(applePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), stat.Mode().Perm())
+
+	content, err := ioutil.ReadFile(applePath)
+	require.NoError(t, err)
+	assert.Equal(t, "new apple content", string(content))
+
+	// a recorded mode wider than the temporary file's is applied too
+	require.NoError(t, writeFileAtomic(applePath, "apple content", 0o755, true))
+
+	stat, err = os.Stat(applePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), stat.Mode().Perm())
+
+	// no temporary files are left behind
+	entries, err := ioutil.ReadDir(home)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, ".apple", entries[0].Name())
+}
+
+func TestSymlinkAtomic(t *testing.T) {
+	home := getTemporaryHome()
+	require.NoError(t, os.MkdirAll(home, 0o700))
+
+	defer os.RemoveAll(home)
+
+	linkPath := filepath.Join(home, ".link")
+	require.NoError(t, symlinkAtomic("apple", linkPath))
+	require.NoError(t, symlinkAtomic("lemon", linkPath))
+
+	target, err := os.Readlink(linkPath)
+	require.NoError(t, err)
+	assert.Equal(t, "lemon", target)
+}
@@ -0,0 +1,251 @@
+package sndotfiles
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/ryanuber/columnize"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// BackupDirName is the directory, alongside the cache db, that local dotfiles are copied to before being overwritten
+	BackupDirName = "backups"
+	// LatestBackup can be given instead of a backup's name to restore from the most recent backup
+	LatestBackup = "latest"
+
+	// maxBackups is the number of backups kept, after which the oldest are removed
+	maxBackups = 100
+)
+
+// backupDir returns a new directory, alongside the cache db, to copy this run's overwritten dotfiles to
+func backupDir(session *cache.Session) string {
+	return filepath.Join(backupsDir(session), timestampNow())
+}
+
+func backupsDir(session *cache.Session) string {
+	return filepath.Join(filepath.Dir(session.CacheDBPath), BackupDirName)
+}
+
+// pruneBackups removes all but the most recent keep backups
+func pruneBackups(session *cache.Session, keep int) error {
+	entries, err := ioutil.ReadDir(backupsDir(session))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var names []string
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	if len(names) <= keep {
+		return nil
+	}
+
+	// names are timestamps so sort chronologically
+	sort.Strings(names)
+
+	for _, name := range names[:len(names)-keep] {
+		if err = os.RemoveAll(filepath.Join(backupsDir(session), name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Backup is a set of dotfiles copied before being overwritten by a single run, named after the time it started
+type Backup struct {
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"`
+}
+
+// ListBackups returns all backups, oldest first, along with the home relative paths of the dotfiles in each
+func ListBackups(session *cache.Session) (backups []Backup, err error) {
+	var entries []os.FileInfo
+
+	entries, err = ioutil.ReadDir(backupsDir(session))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		backup := Backup{Name: entry.Name()}
+
+		backup.Paths, err = backupPaths(filepath.Join(backupsDir(session), entry.Name()))
+		if err != nil {
+			return
+		}
+
+		backups = append(backups, backup)
+	}
+
+	// names are timestamps so sort chronologically
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name < backups[j].Name
+	})
+
+	return backups, err
+}
+
+// backupPaths returns the relative paths of all files and symlinks under dir
+func backupPaths(dir string) (paths []string, err error) {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, wErr error) error {
+		if wErr != nil {
+			return wErr
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, rErr := filepath.Rel(dir, path)
+		if rErr != nil {
+			return rErr
+		}
+
+		paths = append(paths, rel)
+
+		return nil
+	})
+
+	sort.Strings(paths)
+
+	return paths, err
+}
+
+type RestoreBackupInput struct {
+	Session *cache.Session
+	Home    string
+	// Backup is the name of the backup to restore from, or LatestBackup
+	Backup string
+	// Paths limits the dotfiles restored, all are restored if empty
+	Paths []string
+	// Roots are the directories outside home that dotfiles may have been backed up from
+	Roots *Roots
+	Debug bool
+}
+
+type RestoreBackupOutput struct {
+	NoRestored int
+	Results    []Result
+	Msg        string
+}
+
+// RestoreBackup copies dotfiles from a backup back to home
+// the dotfiles being replaced are themselves backed up first, and the next sync treats the restored content as a local change
+func RestoreBackup(ri RestoreBackupInput) (ro RestoreBackupOutput, err error) {
+	var backups []Backup
+
+	backups, err = ListBackups(ri.Session)
+	if err != nil {
+		return
+	}
+
+	if len(backups) == 0 {
+		return ro, errors.New("no backups found")
+	}
+
+	var backup *Backup
+
+	for i := range backups {
+		if backups[i].Name == ri.Backup {
+			backup = &backups[i]
+		}
+	}
+
+	if ri.Backup == LatestBackup {
+		backup = &backups[len(backups)-1]
+	}
+
+	if backup == nil {
+		return ro, fmt.Errorf("backup not found: %s", ri.Backup)
+	}
+
+	paths := backup.Paths
+
+	if len(ri.Paths) > 0 {
+		inBackup := make(map[string]bool)
+		for _, p := range backup.Paths {
+			inBackup[p] = true
+		}
+
+		paths = nil
+
+		var missing []string
+
+		for _, p := range ri.Paths {
+			if filepath.IsAbs(p) {
+				p = stripHome(p, ri.Home, ri.Roots)
+			}
+
+			p = filepath.Clean(p)
+			if !inBackup[p] {
+				missing = append(missing, p)
+				continue
+			}
+
+			paths = append(paths, p)
+		}
+
+		if len(missing) > 0 {
+			return ro, fmt.Errorf("not in backup %s: %s", backup.Name, strings.Join(missing, ", "))
+		}
+	}
+
+	src := filepath.Join(backupsDir(ri.Session), backup.Name)
+	current := backupDir(ri.Session)
+
+	// don't overwrite the backup being restored from if it was made this second
+	if current == src {
+		current += "-1"
+	}
+
+	var lines []string
+
+	for _, p := range paths {
+		path := localPath(ri.Home, p, ri.Roots)
+
+		if pathExists(path) {
+			debugPrint(ri.Debug, fmt.Sprintf("RestoreBackup | backing up current: %s", p))
+
+			// a dotfile backed up as content is restored through any symlink, so is backed up the same way
+			follow := !isSymlink(filepath.Join(src, p))
+			if err = copyLocal(path, filepath.Join(current, p), follow, ri.Roots); err != nil {
+				return ro, fmt.Errorf("failed to back up %s: %w", p, err)
+			}
+		}
+
+		if err = copyLocal(filepath.Join(src, p), path, false, ri.Roots); err != nil {
+			return ro, fmt.Errorf("failed to restore %s: %w", p, err)
+		}
+
+		ro.Results = append(ro.Results, Result{Path: p, Action: ActionRestored})
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(p), green("restored")))
+	}
+
+	ro.NoRestored = len(paths)
+	ro.Msg = columnize.SimpleFormat(lines)
+
+	return ro, pruneBackups(ri.Session, maxBackups)
+}
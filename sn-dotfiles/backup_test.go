@@ -0,0 +1,156 @@
+package sndotfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateLocalBacksUpExisting(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	applePath := filepath.Join(home, ".fruit", "apple")
+	require.NoError(t, createPathWithContent(applePath, "old apple content"))
+
+	backup := filepath.Join(home, BackupDirName, timestampNow())
+	iDiff := ItemDiff{
+		path:        applePath,
+		homeRelPath: ".fruit/apple",
+		remote:      createNote("apple", "new apple content"),
+	}
+	require.NoError(t, createLocal([]ItemDiff{iDiff}, backup, nil))
+
+	content, err := ioutil.ReadFile(applePath)
+	require.NoError(t, err)
+	assert.Equal(t, "new apple content", string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(backup, ".fruit", "apple"))
+	require.NoError(t, err)
+	assert.Equal(t, "old apple content", string(content))
+}
+
+func TestCreateLocalFollowedSymlink(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	// a dotfile added with SymlinksFollow is pulled into the file its symlink points to
+	targetPath := filepath.Join(home, "dotfiles", "vimrc")
+	require.NoError(t, createPathWithContent(targetPath, "old"))
+
+	linkPath := filepath.Join(home, ".vimrc")
+	require.NoError(t, os.Symlink(targetPath, linkPath))
+
+	backup := filepath.Join(home, BackupDirName, timestampNow())
+	iDiff := ItemDiff{
+		path:        linkPath,
+		homeRelPath: ".vimrc",
+		remote:      createNote(".vimrc", "new"),
+	}
+	require.NoError(t, createLocal([]ItemDiff{iDiff}, backup, nil))
+
+	assert.True(t, isSymlink(linkPath))
+
+	content, err := ioutil.ReadFile(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+
+	// the content replaced is backed up, rather than the symlink
+	backupPath := filepath.Join(backup, ".vimrc")
+	assert.False(t, isSymlink(backupPath))
+
+	content, err = ioutil.ReadFile(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+}
+
+func TestRestoreBackup(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	session := &cache.Session{CacheDBPath: filepath.Join(home, "cache", "test.db")}
+
+	backups, err := ListBackups(session)
+	require.NoError(t, err)
+	assert.Empty(t, backups)
+
+	_, err = RestoreBackup(RestoreBackupInput{Session: session, Home: home, Backup: LatestBackup})
+	assert.Error(t, err)
+
+	older := filepath.Join(backupsDir(session), "20200101T000000Z")
+	newer := filepath.Join(backupsDir(session), "20200102T000000Z")
+	require.NoError(t, createPathWithContent(filepath.Join(older, ".apple"), "older apple content"))
+	require.NoError(t, createPathWithContent(filepath.Join(newer, ".apple"), "newer apple content"))
+	require.NoError(t, createPathWithContent(filepath.Join(newer, ".fruit", "lemon"), "newer lemon content"))
+
+	backups, err = ListBackups(session)
+	require.NoError(t, err)
+	assert.Equal(t, []Backup{
+		{Name: "20200101T000000Z", Paths: []string{".apple"}},
+		{Name: "20200102T000000Z", Paths: []string{".apple", ".fruit/lemon"}},
+	}, backups)
+
+	applePath := filepath.Join(home, ".apple")
+	require.NoError(t, createPathWithContent(applePath, "current apple content"))
+
+	// restore a single path from a named backup
+	ro, err := RestoreBackup(RestoreBackupInput{Session: session, Home: home, Backup: "20200101T000000Z", Paths: []string{applePath}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, ro.NoRestored)
+
+	content, err := ioutil.ReadFile(applePath)
+	require.NoError(t, err)
+	assert.Equal(t, "older apple content", string(content))
+
+	// the replaced content is itself backed up
+	backups, err = ListBackups(session)
+	require.NoError(t, err)
+	require.Len(t, backups, 3)
+	assert.Equal(t, []string{".apple"}, backups[2].Paths)
+
+	// paths not in the backup aren't restored
+	_, err = RestoreBackup(RestoreBackupInput{Session: session, Home: home, Backup: "20200101T000000Z", Paths: []string{".fruit/lemon"}})
+	assert.Error(t, err)
+
+	_, err = RestoreBackup(RestoreBackupInput{Session: session, Home: home, Backup: "missing"})
+	assert.Error(t, err)
+
+	// restore everything from the backup made before the last restore
+	ro, err = RestoreBackup(RestoreBackupInput{Session: session, Home: home, Backup: "20200102T000000Z"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, ro.NoRestored)
+
+	content, err = ioutil.ReadFile(filepath.Join(home, ".fruit", "lemon"))
+	require.NoError(t, err)
+	assert.Equal(t, "newer lemon content", string(content))
+}
+
+func TestPruneBackups(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	session := &cache.Session{CacheDBPath: filepath.Join(home, "cache", "test.db")}
+
+	// nothing backed up yet
+	require.NoError(t, pruneBackups(session, 2))
+
+	for _, name := range []string{"20200102T000000Z", "20200101T000000Z", "20200104T000000Z", "20200103T000000Z"} {
+		require.NoError(t, createPathWithContent(filepath.Join(backupsDir(session), name, ".apple"), name))
+	}
+
+	require.NoError(t, pruneBackups(session, 2))
+
+	backups, err := ListBackups(session)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, "20200103T000000Z", backups[0].Name)
+	assert.Equal(t, "20200104T000000Z", backups[1].Name)
+}
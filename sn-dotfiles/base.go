@@ -0,0 +1,170 @@
+package sndotfiles
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/asdine/storm/v3"
+	"github.com/jonhadfield/gosn-v2"
+	"time"
+)
+
+// syncBase records the state of a tracked path as it was when last synchronised
+// so that later comparisons can tell which side has changed since, and conflicts can be merged
+type syncBase struct {
+	Path          string `storm:"id"`
+	NoteUUID      string
+	NoteUpdatedAt string
+	Hash          string
+	Content       string
+	Mode          string
+	Symlink       bool
+	SyncedAt      time.Time
+}
+
+type syncBases map[string]syncBase
+
+// content returns the content when last synced, or false if it wasn't recorded, as by versions before merge
+func (b syncBase) content() (string, bool) {
+	return b.Content, b.Content != "" || b.Hash == hashContent("")
+}
+
+func hashContent(in string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(in)))
+}
+
+func loadSyncBases(db *storm.DB) (bases syncBases, err error) {
+	var all []syncBase
+
+	if err = db.All(&all); err != nil {
+		return
+	}
+
+	bases = make(syncBases, len(all))
+	for _, b := range all {
+		bases[b.Path] = b
+	}
+
+	return
+}
+
+// recordSyncBases persists the remote content of each item, as rendered if templated, as the new base for its path
+func recordSyncBases(db *storm.DB, itemDiffs []ItemDiff) error {
+	now := time.Now().UTC()
+
+	for _, itemDiff := range itemDiffs {
+		base := syncBase{
+			Path:          itemDiff.homeRelPath,
+			NoteUUID:      itemDiff.remote.UUID,
+			NoteUpdatedAt: itemDiff.remote.UpdatedAt,
+			Hash:          hashContent(itemDiff.remoteContent()),
+			Content:       itemDiff.remoteContent(),
+			Mode:          getNoteMeta(itemDiff.remote).Mode,
+			Symlink:       getNoteMeta(itemDiff.remote).Symlink,
+			SyncedAt:      now,
+		}
+
+		if err := db.Save(&base); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forgetSyncBases removes the recorded bases for paths that are no longer tracked
+func forgetSyncBases(db *storm.DB, paths []string) error {
+	for _, path := range paths {
+		if err := db.DeleteStruct(&syncBase{Path: path}); err != nil && !errors.Is(err, storm.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forgetSyncBasesForNotes removes the recorded bases for the paths tracked by the specified notes
+func forgetSyncBasesForNotes(db *storm.DB, notes gosn.Notes) error {
+	bases, err := loadSyncBases(db)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+
+	for _, base := range bases {
+		for _, note := range notes {
+			if base.NoteUUID == note.UUID {
+				paths = append(paths, base.Path)
+			}
+		}
+	}
+
+	return forgetSyncBases(db, paths)
+}
+
+// applySyncBases reclassifies differing items using the recorded base for their path:
+// - only local content changed since base: local newer
+// - only remote content changed since base: remote newer
+// - both changed since base: conflict
+// - local missing and remote unchanged since base: deleted locally
+// - local missing and remote changed since base: conflict
+// items without a base (or with a base for a different note) keep their timestamp based result
+func applySyncBases(itemDiffs []ItemDiff, bases syncBases, debug bool) []ItemDiff {
+	for i := range itemDiffs {
+		if !StringInSlice(itemDiffs[i].diff, []string{localNewer, remoteNewer, localMissing}, true) {
+			continue
+		}
+
+		base, found := bases[itemDiffs[i].homeRelPath]
+		if !found || base.NoteUUID != itemDiffs[i].remote.UUID {
+			debugPrint(debug, fmt.Sprintf("applySyncBases | no base for: %s", itemDiffs[i].homeRelPath))
+			continue
+		}
+
+		remoteChanged := hashContent(itemDiffs[i].remoteContent()) != base.Hash
+
+		if itemDiffs[i].diff == localMissing {
+			// the path existed locally when last synced, so has since been deleted
+			itemDiffs[i].diff = localDeleted
+			if remoteChanged {
+				itemDiffs[i].diff = conflict
+			}
+
+			debugPrint(debug, fmt.Sprintf("applySyncBases | %s is: %s", itemDiffs[i].homeRelPath, itemDiffs[i].diff))
+
+			continue
+		}
+
+		localChanged := hashContent(itemDiffs[i].local) != base.Hash
+
+		switch {
+		case localChanged && remoteChanged:
+			itemDiffs[i].diff = conflict
+		case localChanged:
+			itemDiffs[i].diff = localNewer
+		case remoteChanged:
+			itemDiffs[i].diff = remoteNewer
+		}
+
+		debugPrint(debug, fmt.Sprintf("applySyncBases | %s is: %s", itemDiffs[i].homeRelPath, itemDiffs[i].diff))
+	}
+
+	return itemDiffs
+}
+
+// localModeChanged returns true unless the local mode still matches the mode recorded at the
+// last sync, in which case the mode recorded against the note must have been changed remotely
+// if the note had no mode at the last sync, e.g. as it was edited in an SN app, it has been recorded remotely since
+func localModeChanged(itemDiff ItemDiff, bases syncBases) bool {
+	base, found := bases[itemDiff.homeRelPath]
+	if !found || base.NoteUUID != itemDiff.remote.UUID {
+		return true
+	}
+
+	if base.Mode == "" {
+		return false
+	}
+
+	return base.Mode != modeString(itemDiff.localMode)
+}
@@ -0,0 +1,77 @@
+package sndotfiles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplySyncBases(t *testing.T) {
+	appleNote := createNote("apple", "apple content")
+	lemonNote := createNote("lemon", "lemon content 2")
+	grapeNote := createNote("grape", "grape content 2")
+	pearNote := createNote("pear", "pear content 2")
+	plumNote := createNote("plum", "plum content")
+	figNote := createNote("fig", "fig content 2")
+
+	itemDiffs := []ItemDiff{
+		{homeRelPath: ".apple", diff: remoteNewer, local: "apple content 2", remote: appleNote},
+		{homeRelPath: ".lemon", diff: localNewer, local: "lemon content", remote: lemonNote},
+		{homeRelPath: ".grape", diff: localNewer, local: "grape content 3", remote: grapeNote},
+		{homeRelPath: ".pear", diff: remoteNewer, local: "pear content", remote: pearNote},
+		{homeRelPath: ".plum", diff: localMissing, remote: plumNote},
+		{homeRelPath: ".fig", diff: localMissing, remote: figNote},
+	}
+
+	bases := syncBases{
+		".apple": {Path: ".apple", NoteUUID: appleNote.UUID, Hash: hashContent("apple content")},
+		".lemon": {Path: ".lemon", NoteUUID: lemonNote.UUID, Hash: hashContent("lemon content")},
+		".grape": {Path: ".grape", NoteUUID: grapeNote.UUID, Hash: hashContent("grape content")},
+		// base for a different note should be ignored
+		".pear": {Path: ".pear", NoteUUID: "another-uuid", Hash: hashContent("pear content 2")},
+		".plum": {Path: ".plum", NoteUUID: plumNote.UUID, Hash: hashContent("plum content")},
+		".fig":  {Path: ".fig", NoteUUID: figNote.UUID, Hash: hashContent("fig content")},
+	}
+
+	res := applySyncBases(itemDiffs, bases, true)
+	assert.Equal(t, localNewer, res[0].diff)
+	assert.Equal(t, remoteNewer, res[1].diff)
+	assert.Equal(t, conflict, res[2].diff)
+	assert.Equal(t, remoteNewer, res[3].diff)
+	assert.Equal(t, localDeleted, res[4].diff)
+	assert.Equal(t, conflict, res[5].diff)
+}
+
+func TestLocalModeChanged(t *testing.T) {
+	note := createNote("apple", "apple content")
+	setNoteMode(&note, 0o600)
+
+	itemDiff := ItemDiff{homeRelPath: ".apple", diff: modeChanged, localMode: 0o644, remote: note}
+
+	// no base, so the local mode is pushed
+	assert.True(t, localModeChanged(itemDiff, syncBases{}))
+	// local mode changed since the last sync
+	assert.True(t, localModeChanged(itemDiff, syncBases{".apple": {NoteUUID: note.UUID, Mode: "0600"}}))
+	// mode recorded against the note changed since the last sync
+	assert.False(t, localModeChanged(itemDiff, syncBases{".apple": {NoteUUID: note.UUID, Mode: "0644"}}))
+	// note had no mode at the last sync, as its metadata was dropped by editing it in an SN app
+	assert.False(t, localModeChanged(itemDiff, syncBases{".apple": {NoteUUID: note.UUID}}))
+}
+
+func TestHashContent(t *testing.T) {
+	assert.Equal(t, hashContent("apple content"), hashContent("apple content"))
+	assert.NotEqual(t, hashContent("apple content"), hashContent("apple content "))
+}
+
+func TestSyncBaseContent(t *testing.T) {
+	content, known := syncBase{Hash: hashContent("apple"), Content: "apple"}.content()
+	assert.True(t, known)
+	assert.Equal(t, "apple", content)
+
+	_, known = syncBase{Hash: hashContent("")}.content()
+	assert.True(t, known)
+
+	// recorded before content was kept
+	_, known = syncBase{Hash: hashContent("apple")}.content()
+	assert.False(t, known)
+}
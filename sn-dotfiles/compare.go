@@ -9,7 +9,7 @@ import (
 	"time"
 )
 
-func compare(remote tagsWithNotes, home string, paths, exclude []string, debug bool) (diffs []ItemDiff, err error) {
+func compare(remote tagsWithNotes, home string, roots *Roots, paths, exclude []string, templateVars map[string]string, debug bool) (diffs []ItemDiff, err error) {
 	debugPrint(debug, fmt.Sprintf("compare | Home: %s", home))
 	debugPrint(debug, fmt.Sprintf("compare | %d Paths to include supplied", len(paths)))
 	debugPrint(debug, fmt.Sprintf("compare | %d Paths to Exclude supplied", len(exclude)))
@@ -27,7 +27,7 @@ func compare(remote tagsWithNotes, home string, paths, exclude []string, debug b
 
 	var remotePaths []string
 	// check remotes against local filesystem
-	itemDiffs, remotePaths, err = compareRemoteWithLocalFS(remote, paths, home, debug)
+	itemDiffs, remotePaths, err = compareRemoteWithLocalFS(remote, paths, home, roots, templateVars, debug)
 	if err != nil {
 		return
 	}
@@ -35,47 +35,94 @@ func compare(remote tagsWithNotes, home string, paths, exclude []string, debug b
 	// if Paths specified, then discover those that are untracked
 	// by comparing with existing remote equivalent Paths
 	if len(paths) > 0 {
-		itemDiffs = append(itemDiffs, findUntracked(paths, remotePaths, home, debug)...)
+		itemDiffs = append(itemDiffs, findUntracked(paths, remotePaths, home, roots, newIgnorer(home), debug)...)
 	}
 
 	return itemDiffs, err
 }
 
-func compareRemoteWithLocalFS(remote tagsWithNotes, paths []string, home string, debug bool) (itemDiffs []ItemDiff, remotePaths []string, err error) {
+func compareRemoteWithLocalFS(remote tagsWithNotes, paths []string, home string, roots *Roots, templateVars map[string]string, debug bool) (itemDiffs []ItemDiff, remotePaths []string, err error) {
 	// loop through remotes to generate a list of diffs for:
 	// - existing local and remotes
 	// - missing local files
 	// also getTagsWithNotes a list of remotes that should have locals
+	facts := currentHostFacts()
+
+	templateData := newTemplateData(home, templateVars)
+
 	for _, twn := range remote {
 		// only do a compare if path equals translated tag
-		tagTitle := twn.tag.Content.GetTitle()
+		tagTitle := twn.title()
 
 		var dir string
 
-		dir, err = tagTitleToFSDir(twn.tag.Content.GetTitle(), home)
+		dir, err = tagTitleToFSDir(twn.title(), home, roots)
 		if err != nil {
 			return
 		}
 
-		debugPrint(debug, fmt.Sprintf("compare | tag title: %s is path: <home>/%s", tagTitle, stripHome(dir, home)))
+		// notes in a root that isn't set on this host are left alone
+		if dir == "" {
+			debugPrint(debug, fmt.Sprintf("compare | skipping tag: %s", tagTitle))
+			continue
+		}
+
+		debugPrint(debug, fmt.Sprintf("compare | tag title: %s is path: <home>/%s", tagTitle, stripHome(dir, home, roots)))
 		// if Paths were supplied, then check the determined dir is a prefix of one of those
 		if len(paths) > 0 && !pathIsPrefixOfPaths(dir, paths) {
 			continue
 		}
 
+		// alternates are tracked by their own name, so their local copies aren't untracked
+		for _, d := range twn.notes {
+			if isAlternate(d.Content.GetTitle()) {
+				remotePaths = append(remotePaths, dir+d.Content.GetTitle())
+			}
+		}
+
 		// loop through notes for the tag and compareNoteWithFile content of any with matching file
 		// log each matching path so we can later walk them to discover untracked files
-		for _, d := range twn.notes {
-			fullPath := fmt.Sprintf("%s%s", dir, d.Content.GetTitle())
+		// where alternates exist, only the best match for this host is compared, using the canonical path
+		for _, a := range selectAlternates(twn.notes, facts) {
+			d := a.note
+			fullPath := fmt.Sprintf("%s%s", dir, a.canonical)
 			// skip note if exact path is not specified and does not have prefix of total path
-			if len(paths) > 0 && !noteInPaths(dir+d.Content.GetTitle(), paths) {
+			if len(paths) > 0 && !noteInPaths(fullPath, paths) && !noteInPaths(dir+d.Content.GetTitle(), paths) {
 				continue
 			}
 
-			if !localExists(fullPath) {
+			symlink := getNoteMeta(d).Symlink
+
+			// templated notes are compared, and materialised, as rendered for this host
+			templated := getNoteMeta(d).Template && !symlink
+
+			var rendered string
+
+			if templated {
+				var rErr error
+
+				rendered, rErr = renderTemplate(d, templateData)
+				if rErr != nil {
+					// the others are still compared, and the local copy isn't reported as untracked
+					debugPrint(debug, fmt.Sprintf("compare | failed to render: <home>/%s", stripHome(fullPath, home, roots)))
+					remotePaths = append(remotePaths, fullPath)
+					itemDiffs = append(itemDiffs, ItemDiff{
+						tagTitle:    tagTitle,
+						homeRelPath: stripHome(fullPath, home, roots),
+						path:        fullPath,
+						noteTitle:   d.Content.GetTitle(),
+						template:    true,
+						remote:      d,
+					}.fail(rErr))
+
+					continue
+				}
+			}
+
+			if !localExists(fullPath) && !(symlink && isSymlink(fullPath)) {
 				// local path matching tag+note doesn't exist so set as 'local missing'
-				debugPrint(debug, fmt.Sprintf("compare | local not found: <home>/%s", stripHome(fullPath, home)))
-				homeRelPath := stripHome(fullPath, home)
+				debugPrint(debug, fmt.Sprintf("compare | local not found: <home>/%s", stripHome(fullPath, home, roots)))
+				homeRelPath := stripHome(fullPath, home, roots)
 
 				itemDiffs = append(itemDiffs, ItemDiff{
 					tagTitle:    tagTitle,
@@ -83,13 +130,28 @@ func compareRemoteWithLocalFS(remote tagsWithNotes, paths []string, home string,
 					path:        fullPath,
 					diff:        localMissing,
 					noteTitle:   d.Content.GetTitle(),
+					symlink:     symlink,
+					template:    templated,
+					rendered:    rendered,
 					remote:      d,
 				})
+			} else if symlink {
+				// note represents a symlink so compare targets rather than content
+				debugPrint(debug, fmt.Sprintf("compare | local symlink found: <home>/%s", stripHome(fullPath, home, roots)))
+				remotePaths = append(remotePaths, fullPath)
+				itemDiffs = append(itemDiffs, compareSymlinkWithNote(tagTitle, fullPath, home, roots, d, debug))
+			} else if templated {
+				debugPrint(debug, fmt.Sprintf("compare | local found for template: <home>/%s", stripHome(fullPath, home, roots)))
+				remotePaths = append(remotePaths, fullPath)
+				itemDiff := compareContentWithFile(tagTitle, fullPath, home, roots, d, rendered, debug)
+				itemDiff.template = true
+				itemDiff.rendered = rendered
+				itemDiffs = append(itemDiffs, itemDiff)
 			} else {
 				// local does exist, so compareNoteWithFile and store generated compare
-				debugPrint(debug, fmt.Sprintf("compare | local found: <home>/%s", stripHome(fullPath, home)))
+				debugPrint(debug, fmt.Sprintf("compare | local found: <home>/%s", stripHome(fullPath, home, roots)))
 				remotePaths = append(remotePaths, fullPath)
-				itemDiffs = append(itemDiffs, compareNoteWithFile(tagTitle, fullPath, home, d, debug))
+				itemDiffs = append(itemDiffs, compareNoteWithFile(tagTitle, fullPath, home, roots, d, debug))
 			}
 		}
 	}
@@ -97,9 +159,14 @@ func compareRemoteWithLocalFS(remote tagsWithNotes, paths []string, home string,
 	return itemDiffs, remotePaths, err
 }
 
-func compareNoteWithFile(tagTitle, path, home string, remote gosn.Note, debug bool) ItemDiff {
+func compareNoteWithFile(tagTitle, path, home string, roots *Roots, remote gosn.Note, debug bool) ItemDiff {
+	return compareContentWithFile(tagTitle, path, home, roots, remote, remote.Content.GetText(), debug)
+}
+
+// compareContentWithFile compares a local file with the content its note materialises as
+func compareContentWithFile(tagTitle, path, home string, roots *Roots, remote gosn.Note, remoteContent string, debug bool) ItemDiff {
 	debugPrint(debug, fmt.Sprintf("compareNoteWithFile | title: %s path: <home>/%s",
-		tagTitle, stripHome(path, home)))
+		tagTitle, stripHome(path, home, roots)))
 
 	localStat, err := os.Stat(path)
 	if err != nil {
@@ -126,10 +193,10 @@ func compareNoteWithFile(tagTitle, path, home string, remote gosn.Note, debug bo
 		log.Fatal(err)
 	}
 
-	homeRelPath := stripHome(path, home)
+	homeRelPath := stripHome(path, home, roots)
 
 	localStr := string(localBytes)
-	if localStr != remote.Content.GetText() {
+	if localStr != remoteContent {
 		var remoteUpdated time.Time
 
 		remoteUpdated, err = time.Parse("2006-01-02T15:04:05.000Z", remote.UpdatedAt)
@@ -149,6 +216,7 @@ func compareNoteWithFile(tagTitle, path, home string, remote gosn.Note, debug bo
 				noteTitle:   remote.Content.GetTitle(),
 				diff:        localNewer,
 				local:       string(localBytes),
+				localMode:   localStat.Mode().Perm(),
 				remote:      remote,
 			}
 		}
@@ -160,6 +228,22 @@ func compareNoteWithFile(tagTitle, path, home string, remote gosn.Note, debug bo
 			noteTitle:   remote.Content.GetTitle(),
 			diff:        remoteNewer,
 			local:       string(localBytes),
+			localMode:   localStat.Mode().Perm(),
+			remote:      remote,
+		}
+	}
+	// content identical so check if the recorded mode has drifted
+	if noteModeDiffers(remote, localStat.Mode()) {
+		debugPrint(debug, fmt.Sprintf("compareNoteWithFile | mode of <home>/%s differs from remote", homeRelPath))
+
+		return ItemDiff{
+			tagTitle:    tagTitle,
+			path:        path,
+			homeRelPath: homeRelPath,
+			noteTitle:   remote.Content.GetTitle(),
+			diff:        modeChanged,
+			local:       string(localBytes),
+			localMode:   localStat.Mode().Perm(),
 			remote:      remote,
 		}
 	}
@@ -171,6 +255,7 @@ func compareNoteWithFile(tagTitle, path, home string, remote gosn.Note, debug bo
 		noteTitle:   remote.Content.GetTitle(),
 		diff:        identical,
 		local:       string(localBytes),
+		localMode:   localStat.Mode().Perm(),
 		remote:      remote,
 	}
 }
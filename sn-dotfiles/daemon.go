@@ -0,0 +1,276 @@
+package sndotfiles
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DaemonSocketName is the name of the daemon's socket in its directory
+const DaemonSocketName = "daemon.sock"
+
+// commands accepted by the daemon
+const (
+	DaemonStatus = "status"
+	DaemonSync   = "sync"
+	DaemonPush   = "push"
+	DaemonPull   = "pull"
+	DaemonPause  = "pause"
+	DaemonResume = "resume"
+)
+
+// DefaultDaemonSocket returns the socket path to use if none is specified: in $XDG_RUNTIME_DIR if set,
+// or else alongside the cache db in cacheDir, defaulting to ~/.sn-dotfiles
+func DefaultDaemonSocket(cacheDir string) (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, SNAppName+".sock"), nil
+	}
+
+	if cacheDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		cacheDir = filepath.Join(home, "."+SNAppName)
+	}
+
+	return filepath.Join(cacheDir, DaemonSocketName), nil
+}
+
+type DaemonInput struct {
+	WatchInput
+	// Socket is the path of the Unix socket to listen on
+	Socket string
+}
+
+// DaemonRequest is a single command sent to the daemon, as a line of JSON
+type DaemonRequest struct {
+	Command string `json:"command"`
+	// Paths limits a sync to the specified paths, and are required to push or pull
+	Paths  []string `json:"paths,omitempty"`
+	DryRun bool     `json:"dry_run,omitempty"`
+}
+
+// DaemonResponse is the daemon's reply to each request, as a line of JSON
+type DaemonResponse struct {
+	OK        bool       `json:"ok"`
+	Error     string     `json:"error,omitempty"`
+	Paused    bool       `json:"paused"`
+	LastSync  *time.Time `json:"last_sync,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	// Tracked is the number of dotfiles being watched
+	Tracked int `json:"tracked"`
+	// Pending lists the paths changed locally and waiting to be synced
+	Pending []string `json:"pending,omitempty"`
+	Results []Result `json:"results,omitempty"`
+	Msg     string   `json:"msg,omitempty"`
+}
+
+// Daemon watches and syncs dotfiles as Watch does, using a single session, and also makes syncs requested
+// over a Unix socket, until stop is closed
+// all syncs are made one at a time, so requests wait for any sync in progress
+// the cache db stays populated between syncs, so each only fetches the changes made since the last, but it isn't
+// held open: gosn's cache.Sync opens it by path for every sync, and holding its lock would block other commands
+func Daemon(di DaemonInput, stop <-chan struct{}) (err error) {
+	if di.Socket == "" {
+		return errors.New("daemon socket not specified")
+	}
+
+	w, err := newWatcher(di.WatchInput)
+	if err != nil {
+		return err
+	}
+
+	defer w.fsw.Close()
+
+	l, err := listenDaemon(di.Socket)
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(di.Socket)
+	defer l.Close()
+
+	if err = w.start(); err != nil {
+		return err
+	}
+
+	calls := make(chan func())
+	done := make(chan struct{})
+
+	defer close(done)
+
+	go serveDaemon(l, calls, done, w.handle)
+
+	return w.run(stop, calls)
+}
+
+// listenDaemon listens on a socket only the user can connect to, replacing any left by a daemon that didn't exit cleanly
+func listenDaemon(socket string) (net.Listener, error) {
+	if pathExists(socket) {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			_ = conn.Close()
+
+			return nil, fmt.Errorf("daemon already running on %s", socket)
+		}
+
+		if err := os.Remove(socket); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		return nil, err
+	}
+
+	// the socket is created without group and other permissions, rather than restricted once others could connect
+	umask := syscall.Umask(0o177)
+	l, err := net.Listen("unix", socket)
+	syscall.Umask(umask)
+
+	return l, err
+}
+
+// serveDaemon accepts connections until the listener is closed, passing each request to handle on the
+// goroutine receiving calls
+func serveDaemon(l net.Listener, calls chan<- func(), done <-chan struct{}, handle func(DaemonRequest) DaemonResponse) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go serveDaemonConn(conn, calls, done, handle)
+	}
+}
+
+func serveDaemonConn(conn net.Conn, calls chan<- func(), done <-chan struct{}, handle func(DaemonRequest) DaemonResponse) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req DaemonRequest
+
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			_ = enc.Encode(DaemonResponse{Error: fmt.Sprintf("invalid request: %s", err)})
+			continue
+		}
+
+		respCh := make(chan DaemonResponse, 1)
+
+		select {
+		case calls <- func() { respCh <- handle(req) }:
+		case <-done:
+			return
+		}
+
+		if err := enc.Encode(<-respCh); err != nil {
+			return
+		}
+	}
+}
+
+// handle carries out a request made to the daemon
+func (w *watcher) handle(req DaemonRequest) (resp DaemonResponse) {
+	var paths []string
+
+	for _, p := range req.Paths {
+		switch {
+		case strings.HasPrefix(p, "~"):
+			p = strings.Replace(p, "~", w.home, 1)
+		case !filepath.IsAbs(p):
+			p = localPath(w.home, p, w.roots)
+		}
+
+		paths = append(paths, filepath.Clean(p))
+	}
+
+	si := syncInput{paths: paths, dryRun: req.DryRun}
+
+	var err error
+
+	switch req.Command {
+	case DaemonStatus:
+	case DaemonPause:
+		w.paused = true
+	case DaemonResume:
+		w.resume()
+	case DaemonPush, DaemonPull:
+		if len(paths) == 0 {
+			err = fmt.Errorf("specify the paths to %s", req.Command)
+			break
+		}
+
+		si.direction = req.Command
+
+		fallthrough
+	case DaemonSync:
+		var so SyncOutput
+
+		so, err = w.syncWith(si)
+		resp.Results = so.Results
+		resp.Msg = so.Msg
+	default:
+		err = fmt.Errorf("unknown command: %s", req.Command)
+	}
+
+	resp.OK = err == nil
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	resp.Paused = w.paused
+	resp.Tracked = len(w.tracked)
+
+	if !w.lastSync.IsZero() {
+		lastSync := w.lastSync
+		resp.LastSync = &lastSync
+	}
+
+	if w.lastErr != nil {
+		resp.LastError = w.lastErr.Error()
+	}
+
+	for path := range w.pending {
+		resp.Pending = append(resp.Pending, stripHome(path, w.home, w.roots))
+	}
+
+	sort.Strings(resp.Pending)
+
+	return resp
+}
+
+// DaemonCall sends a request to the daemon listening on socket and returns its response
+func DaemonCall(socket string, req DaemonRequest) (resp DaemonResponse, err error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return resp, fmt.Errorf("failed to connect to daemon, is it running? %w", err)
+	}
+
+	defer conn.Close()
+
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return
+	}
+
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("failed to read daemon response: %w", err)
+	}
+
+	if !resp.OK {
+		return resp, errors.New(resp.Error)
+	}
+
+	return resp, err
+}
@@ -0,0 +1,112 @@
+package sndotfiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultDaemonSocket(t *testing.T) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+
+	defer os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	require.NoError(t, os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000"))
+
+	socket, err := DefaultDaemonSocket("/cache")
+	require.NoError(t, err)
+	assert.Equal(t, "/run/user/1000/sn-dotfiles.sock", socket)
+
+	require.NoError(t, os.Unsetenv("XDG_RUNTIME_DIR"))
+
+	socket, err = DefaultDaemonSocket("/cache")
+	require.NoError(t, err)
+	assert.Equal(t, "/cache/daemon.sock", socket)
+}
+
+func TestDaemonRequests(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	applePath := filepath.Join(home, ".apple")
+	require.NoError(t, createPathWithContent(applePath, "apple content"))
+
+	var requested []syncInput
+
+	w := newTestWatcher(t, home, nil)
+
+	defer w.fsw.Close()
+
+	w.sync = func(si syncInput) (SyncOutput, error) {
+		requested = append(requested, si)
+
+		return SyncOutput{Results: []Result{{Path: ".apple", Action: ActionPushed}}, Msg: "synced"}, nil
+	}
+
+	socket := filepath.Join(home, DaemonSocketName)
+	l, err := listenDaemon(socket)
+	require.NoError(t, err)
+
+	// only the user can connect
+	stat, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+	// only one daemon can listen on a socket
+	_, err = listenDaemon(socket)
+	assert.Error(t, err)
+
+	stop := make(chan struct{})
+	calls := make(chan func())
+	done := make(chan error)
+
+	go serveDaemon(l, calls, stop, w.handle)
+
+	go func() {
+		done <- w.run(stop, calls)
+	}()
+
+	resp, err := DaemonCall(socket, DaemonRequest{Command: DaemonStatus})
+	require.NoError(t, err)
+	assert.True(t, resp.OK)
+	assert.False(t, resp.Paused)
+	assert.Nil(t, resp.LastSync)
+
+	resp, err = DaemonCall(socket, DaemonRequest{Command: DaemonPause})
+	require.NoError(t, err)
+	assert.True(t, resp.Paused)
+
+	resp, err = DaemonCall(socket, DaemonRequest{Command: DaemonSync})
+	require.NoError(t, err)
+	assert.Equal(t, "synced", resp.Msg)
+	assert.Equal(t, []Result{{Path: ".apple", Action: ActionPushed}}, resp.Results)
+	assert.NotNil(t, resp.LastSync)
+	assert.Equal(t, 1, resp.Tracked)
+
+	resp, err = DaemonCall(socket, DaemonRequest{Command: DaemonPull, Paths: []string{".apple"}, DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, resp.OK)
+
+	resp, err = DaemonCall(socket, DaemonRequest{Command: DaemonResume})
+	require.NoError(t, err)
+	assert.False(t, resp.Paused)
+
+	// paths are required to push or pull
+	_, err = DaemonCall(socket, DaemonRequest{Command: DaemonPush})
+	assert.Error(t, err)
+
+	_, err = DaemonCall(socket, DaemonRequest{Command: "unknown"})
+	assert.Error(t, err)
+
+	require.Len(t, requested, 2)
+	assert.Empty(t, requested[0].paths)
+	assert.Equal(t, syncInput{paths: []string{applePath}, dryRun: true, direction: directionPull}, requested[1])
+
+	close(stop)
+	assert.NoError(t, <-done)
+	require.NoError(t, l.Close())
+}
@@ -0,0 +1,155 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"github.com/asdine/storm/v3"
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TrashDirName is the directory, alongside the cache db, that sync moves locally deleted dotfiles to
+const TrashDirName = "trash"
+
+// remoteTrackedPaths returns the home relative paths of all notes tracked remotely for this host
+func remoteTrackedPaths(twn tagsWithNotes, home string, roots *Roots) map[string]bool {
+	tracked := make(map[string]bool)
+
+	facts := currentHostFacts()
+
+	for _, t := range twn {
+		dir, err := tagTitleToFSDir(t.title(), home, roots)
+		if err != nil || dir == "" {
+			continue
+		}
+
+		for _, a := range selectAlternates(t.notes, facts) {
+			tracked[stripHome(dir+a.canonical, home, roots)] = true
+		}
+
+		// alternates are also tracked by their own name
+		for _, n := range t.notes {
+			tracked[stripHome(dir+n.Content.GetTitle(), home, roots)] = true
+		}
+	}
+
+	return tracked
+}
+
+// findRemoteDeleted checks each previously synced path that is no longer tracked remotely and returns:
+// - an item for each that still exists locally: deleted remotely if unchanged since the last sync, otherwise a conflict
+// - the paths of those that no longer exist locally either
+// paths in roots that aren't set are skipped, as their notes can't be told apart from deleted ones
+func findRemoteDeleted(twn tagsWithNotes, bases syncBases, home string, roots *Roots, paths []string, debug bool) (itemDiffs []ItemDiff, gone []string) {
+	tracked := remoteTrackedPaths(twn, home, roots)
+
+	for homeRelPath, base := range bases {
+		if tracked[homeRelPath] {
+			continue
+		}
+
+		if !rootResolved(homeRelPath, roots) {
+			debugPrint(debug, fmt.Sprintf("findRemoteDeleted | %s is in a root that isn't set", homeRelPath))
+
+			continue
+		}
+
+		path := localPath(home, homeRelPath, roots)
+		if len(paths) > 0 && !noteInPaths(path, paths) {
+			continue
+		}
+
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			debugPrint(debug, fmt.Sprintf("findRemoteDeleted | %s deleted locally and remotely", homeRelPath))
+			gone = append(gone, homeRelPath)
+
+			continue
+		}
+
+		itemDiff := ItemDiff{
+			path:        path,
+			homeRelPath: homeRelPath,
+			symlink:     base.Symlink,
+			diff:        remoteDeleted,
+		}
+
+		var err error
+		if base.Symlink {
+			itemDiff.local, err = os.Readlink(path)
+		} else {
+			var b []byte
+			b, err = ioutil.ReadFile(path)
+			itemDiff.local = string(b)
+		}
+
+		if err != nil || hashContent(itemDiff.local) != base.Hash {
+			// changed locally since the note was deleted so leave for the user to decide
+			itemDiff.diff = conflict
+		}
+
+		debugPrint(debug, fmt.Sprintf("findRemoteDeleted | %s is: %s", homeRelPath, itemDiff.diff))
+		itemDiffs = append(itemDiffs, itemDiff)
+	}
+
+	return itemDiffs, gone
+}
+
+// deleteRemote deletes the notes for locally deleted items, along with any tags left empty as a result
+func deleteRemote(db *storm.DB, session *cache.Session, twn tagsWithNotes, itemDiffs []ItemDiff, debug bool) error {
+	var notes gosn.Notes
+	for _, itemDiff := range itemDiffs {
+		notes = append(notes, itemDiff.remote)
+	}
+
+	emptyTags := findEmptyTags(twn, notes, debug)
+	emptyTags.DeDupe()
+
+	var items gosn.Items
+
+	for i := range notes {
+		notes[i].SetDeleted(true)
+		items = append(items, &notes[i])
+	}
+
+	for i := range emptyTags {
+		debugPrint(debug, fmt.Sprintf("deleteRemote | removing empty tag: %s", emptyTags[i].Content.GetTitle()))
+		emptyTags[i].SetDeleted(true)
+		items = append(items, &emptyTags[i])
+	}
+
+	return cache.SaveItems(db, session, items, false)
+}
+
+// runDirFormat names the trash and backup directories for each run after the time it started
+const runDirFormat = "20060102T150405Z"
+
+// trashDir returns a new directory, alongside the cache db, to move this run's deleted dotfiles to
+func trashDir(session *cache.Session) string {
+	return filepath.Join(filepath.Dir(session.CacheDBPath), TrashDirName, timestampNow())
+}
+
+func timestampNow() string {
+	return time.Now().UTC().Format(runDirFormat)
+}
+
+// moveToTrash moves a local dotfile to the same home relative path under the trash directory
+func moveToTrash(path, home string, roots *Roots, trash string) error {
+	dest := filepath.Join(trash, stripHome(path, home, roots))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, dest); err == nil {
+		return nil
+	}
+
+	// trash may be on another device, so copy before removing
+	if err := copyLocal(path, dest, false, roots); err != nil {
+		return err
+	}
+
+	return removeLocal(path, roots)
+}
@@ -0,0 +1,100 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindRemoteDeleted(t *testing.T) {
+	home := getTemporaryHome()
+	require.NoError(t, createPathWithContent(fmt.Sprintf("%s/.fruit/apple", home), "apple content"))
+	require.NoError(t, createPathWithContent(fmt.Sprintf("%s/.fruit/lemon", home), "lemon content 2"))
+	require.NoError(t, createPathWithContent(fmt.Sprintf("%s/.fruit/grape", home), "grape content"))
+
+	grapeNote := createNote("grape", "grape content")
+	fruitTag := createTag("dotfiles.fruit")
+	twn := tagsWithNotes{tagWithNotes{tag: fruitTag, notes: gosn.Notes{grapeNote}}}
+
+	bases := syncBases{
+		".fruit/apple": {Path: ".fruit/apple", NoteUUID: "apple-uuid", Hash: hashContent("apple content")},
+		".fruit/lemon": {Path: ".fruit/lemon", NoteUUID: "lemon-uuid", Hash: hashContent("lemon content")},
+		".fruit/grape": {Path: ".fruit/grape", NoteUUID: grapeNote.UUID, Hash: hashContent("grape content")},
+		".fruit/pear":  {Path: ".fruit/pear", NoteUUID: "pear-uuid", Hash: hashContent("pear content")},
+	}
+
+	itemDiffs, gone := findRemoteDeleted(twn, bases, home, nil, nil, true)
+	require.Len(t, itemDiffs, 2)
+
+	diffs := make(map[string]string)
+	for _, itemDiff := range itemDiffs {
+		diffs[itemDiff.homeRelPath] = itemDiff.diff
+	}
+
+	assert.Equal(t, remoteDeleted, diffs[".fruit/apple"])
+	assert.Equal(t, conflict, diffs[".fruit/lemon"])
+	assert.Equal(t, []string{".fruit/pear"}, gone)
+
+	// only check specified paths
+	itemDiffs, _ = findRemoteDeleted(twn, bases, home, nil, []string{fmt.Sprintf("%s/.fruit/apple", home)}, true)
+	require.Len(t, itemDiffs, 1)
+	assert.Equal(t, ".fruit/apple", itemDiffs[0].homeRelPath)
+}
+
+func TestFindRemoteDeletedRootNotSet(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	etc := filepath.Join(home, "etc")
+	require.NoError(t, createPathWithContent(filepath.Join(etc, "hosts"), "hosts content"))
+
+	hostsNote := createNote("hosts", "hosts content")
+	twn := tagsWithNotes{tagWithNotes{tag: createTag("dotfiles.root:etc"), notes: gosn.Notes{hostsNote}}}
+
+	bases := syncBases{
+		"root:etc/hosts": {Path: "root:etc/hosts", NoteUUID: hostsNote.UUID, Hash: hashContent("hosts content")},
+	}
+
+	// the root's notes are still tracked, so nothing was deleted remotely
+	itemDiffs, gone := findRemoteDeleted(twn, bases, home, nil, nil, true)
+	assert.Empty(t, itemDiffs)
+	assert.Empty(t, gone)
+
+	otherRoots, err := NewRoots(map[string]string{"other": home}, "")
+	require.NoError(t, err)
+
+	itemDiffs, gone = findRemoteDeleted(twn, bases, home, otherRoots, nil, true)
+	assert.Empty(t, itemDiffs)
+	assert.Empty(t, gone)
+
+	// with the root set, a deleted note is found
+	etcRoots, err := NewRoots(map[string]string{"etc": etc}, "")
+	require.NoError(t, err)
+
+	itemDiffs, gone = findRemoteDeleted(nil, bases, home, etcRoots, nil, true)
+	require.Len(t, itemDiffs, 1)
+	assert.Equal(t, remoteDeleted, itemDiffs[0].diff)
+	assert.Empty(t, gone)
+}
+
+func TestMoveToTrash(t *testing.T) {
+	home := getTemporaryHome()
+	applePath := fmt.Sprintf("%s/.fruit/apple", home)
+	require.NoError(t, createPathWithContent(applePath, "apple content"))
+
+	trash := filepath.Join(getTemporaryHome(), TrashDirName)
+	require.NoError(t, moveToTrash(applePath, home, nil, trash))
+
+	_, err := os.Stat(applePath)
+	assert.True(t, os.IsNotExist(err))
+
+	content, err := ioutil.ReadFile(filepath.Join(trash, ".fruit", "apple"))
+	require.NoError(t, err)
+	assert.Equal(t, "apple content", string(content))
+}
@@ -1,44 +1,47 @@
 package sndotfiles
 
 import (
-	"errors"
 	"fmt"
-	"github.com/briandowns/spinner"
-	"github.com/jonhadfield/findexec"
 	"github.com/jonhadfield/gosn-v2"
 	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/ryanuber/columnize"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 )
 
 const (
-	localMissing = "local missing"
-	localNewer   = "local newer"
-	remoteNewer  = "remote newer"
-	untracked    = "untracked"
-	identical    = "identical"
+	localMissing  = "local missing"
+	localNewer    = "local newer"
+	remoteNewer   = "remote newer"
+	untracked     = "untracked"
+	identical     = "identical"
+	conflict      = "conflict"
+	modeChanged   = "mode changed"
+	targetChanged = "target changed"
+	localDeleted  = "deleted locally"
+	remoteDeleted = "deleted remotely"
+	failed        = "failed"
 )
 
-func Diff(session *cache.Session, home string, paths []string, pageSize int, close, useStdErr bool) (diffs []ItemDiff, msg string, err error) {
+// DiffOptions controls how differences between local and remote content are shown
+type DiffOptions struct {
+	// Context is the number of unchanged lines shown either side of each change
+	Context int
+	// Stat shows the number of lines changed for each path instead of the changes
+	Stat bool
+	// NameOnly shows only the paths that differ
+	NameOnly bool
+}
+
+// Diff compares local and remote items and shows the differences in their content as unified diffs,
+// from local to remote
+func Diff(session *cache.Session, home string, roots *Roots, paths []string, templateVars map[string]string, pageSize int, opts DiffOptions, close, useStdErr bool) (diffs []ItemDiff, msg string, err error) {
 	debugPrint(session.Debug, fmt.Sprintf("Diff | %d paths", len(paths)))
 
 	if !session.Debug {
-		prefix := HiWhite("syncing ")
-		if _, err = os.Stat(session.CacheDBPath); os.IsNotExist(err) {
-			prefix = HiWhite("initializing ")
-		}
-
-		s := spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stdout))
-		if useStdErr {
-			s = spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stderr))
-		}
-
-		s.Prefix = prefix
-		s.Start()
-		defer s.Stop()
+		stop := startSpinner(session, useStdErr)
+		defer stop()
 	}
 
 	// get populated db
@@ -58,11 +61,19 @@ func Diff(session *cache.Session, home string, paths []string, pageSize int, clo
 	if err != nil {
 		return diffs, msg, err
 	}
+
+	var bases syncBases
+
+	bases, err = loadSyncBases(cso.DB)
+	if err != nil {
+		return diffs, msg, err
+	}
+
 	if err = cso.DB.Close(); err != nil {
 		return
 	}
 
-	return diff(remote, home, paths, session.Debug)
+	return diff(remote, home, roots, paths, templateVars, bases, opts, session.Debug)
 }
 
 type ItemDiff struct {
@@ -73,9 +84,23 @@ type ItemDiff struct {
 	diff        string
 	remote      gosn.Note
 	local       string
+	localMode   os.FileMode
+	symlink     bool
+	template    bool
+	rendered    string
+	// err is why the item couldn't be compared, if its diff is failed
+	err error
 }
 
-func diff(twn tagsWithNotes, home string, paths []string, debug bool) (diffs []ItemDiff, msg string, err error) {
+// fail marks an item that couldn't be compared, so it's reported and left untouched while the others are synced
+func (i ItemDiff) fail(err error) ItemDiff {
+	i.diff = failed
+	i.err = err
+
+	return i
+}
+
+func diff(twn tagsWithNotes, home string, roots *Roots, paths []string, templateVars map[string]string, bases syncBases, opts DiffOptions, debug bool) (diffs []ItemDiff, msg string, err error) {
 	debugPrint(debug, fmt.Sprintf("diff | %d remote items", len(twn)))
 
 	err = checkNoteTagConflicts(twn)
@@ -94,107 +119,95 @@ func diff(twn tagsWithNotes, home string, paths []string, debug bool) (diffs []I
 		debugPrint(debug, fmt.Sprintf("diff | calling compare with Paths: %s", strings.Join(paths, ",")))
 	}
 
-	diffs, err = compare(twn, home, paths, []string{}, debug)
+	diffs, err = compare(twn, home, roots, paths, []string{}, templateVars, debug)
 	if err != nil {
 		return diffs, msg, err
 	}
 
+	diffs = applySyncBases(diffs, bases, debug)
+
 	debugPrint(debug, fmt.Sprintf("compare | %d diffs generated", len(diffs)))
 
 	if len(diffs) == 0 {
 		return diffs, msg, err
 	}
 
-	diffBinary := findexec.Find("diff", "")
-	if diffBinary == "" {
-		err = errors.New("failed to find compare binary")
-		return
-	}
-
-	var differencesFound bool
-	// getTagsWithNotes tempdir
-	tempDir := os.TempDir()
-	if !strings.HasSuffix(tempDir, string(os.PathSeparator)) {
-		tempDir += string(os.PathSeparator)
-	}
-
-	differencesFound, err = processContentDiffs(diffs, tempDir, diffBinary)
-	if err != nil {
-		return
-	}
-
-	if !differencesFound {
+	msg = processContentDiffs(diffs, opts)
+	if msg == "" {
 		msg = "no differences found"
 	}
 
 	return diffs, msg, err
 }
 
-func processContentDiffs(diffs []ItemDiff, tempDir, diffBinary string) (differencesFound bool, err error) {
-	for _, diff := range diffs {
-		localContent := diff.local
-
-		remoteContent := diff.remote.Content.GetText()
-		if localContent != remoteContent {
-			differencesFound = true
-			// write local and remote content to temporary files
-			var f1, f2 *os.File
-
-			uuid := gosn.GenUUID()
-			f1path := fmt.Sprintf("%ssn-dotfiles-compare-%s-f1", tempDir, uuid)
-			f2path := fmt.Sprintf("%ssn-dotfiles-compare-%s-f2", tempDir, uuid)
+// processContentDiffs returns the differences between the local and remote content of each item
+func processContentDiffs(diffs []ItemDiff, opts DiffOptions) string {
+	var out []string
 
-			f1, err = os.Create(f1path)
-			if err != nil {
-				return
-			}
+	var stats []string
 
-			f2, err = os.Create(f2path)
-			if err != nil {
-				return
-			}
+	var files, insertions, deletions int
 
-			if _, err = f1.WriteString(diff.local); err != nil {
-				return
-			}
-
-			if _, err = f2.WriteString(diff.remote.Content.GetText()); err != nil {
-				return
-			}
+	for _, diff := range diffs {
+		if diff.err != nil {
+			out = append(out, red(fmt.Sprintf("%s: %s: %s", diff.homeRelPath, failed, diff.err)))
+			continue
+		}
 
-			cmd := exec.Command(diffBinary, f1path, f2path)
-			out, oErr := cmd.CombinedOutput()
+		localContent := diff.local
 
-			if err = os.Remove(f1path); err != nil {
-				return
-			}
+		remoteContent := diff.remoteContent()
+		if localContent == remoteContent {
+			continue
+		}
 
-			if err = os.Remove(f2path); err != nil {
-				return
-			}
+		switch {
+		case opts.NameOnly:
+			out = append(out, diff.homeRelPath)
+		case opts.Stat:
+			ins, dels := diffStat(localContent, remoteContent)
+			files++
+			insertions += ins
+			deletions += dels
+			stats = append(stats, fmt.Sprintf("%s | %d %s", diff.homeRelPath, ins+dels, statBar(ins, dels)))
+		default:
+			out = append(out, unifiedDiff("local/"+diff.homeRelPath, "remote/"+diff.homeRelPath,
+				localContent, remoteContent, opts.Context))
+		}
+	}
 
-			var exitCode int
+	if opts.Stat && files > 0 {
+		out = append(out, columnize.SimpleFormat(stats),
+			fmt.Sprintf("%d file(s) changed, %d insertion(s)(+), %d deletion(s)(-)", files, insertions, deletions))
+	}
 
-			if oErr != nil {
-				if exitError, ok := oErr.(*exec.ExitError); ok {
-					exitCode = exitError.ExitCode()
-				}
-			}
+	return strings.TrimSuffix(strings.Join(out, "\n"), "\n")
+}
 
-			if exitCode == 2 {
-				panic(fmt.Sprintf("failed to compare: '%s' with '%s'", f1path, f2path))
-			}
+// maxStatBarWidth is the most characters used to show a path's insertions and deletions
+const maxStatBarWidth = 50
 
-			fmt.Println(bold(diff.homeRelPath))
-			fmt.Println(string(out))
+// statBar shows insertions and deletions as +'s and -'s, scaled down if there are too many to show
+func statBar(insertions, deletions int) string {
+	if total := insertions + deletions; total > maxStatBarWidth {
+		scaled := insertions * maxStatBarWidth / total
+		if insertions > 0 && scaled == 0 {
+			scaled = 1
 		}
+
+		insertions, deletions = scaled, maxStatBarWidth-scaled
 	}
 
-	return differencesFound, err
+	return green(strings.Repeat("+", insertions)) + red(strings.Repeat("-", deletions))
 }
 
 func pathIsPrefixOfPaths(path string, paths []string) bool {
 	for i := range paths {
+		// a pattern may match any path, so is checked against each note
+		if isGlob(paths[i]) {
+			return true
+		}
+
 		inSliceDIR, _ := filepath.Split(paths[i])
 		if inSliceDIR == "" {
 			continue
@@ -222,6 +235,14 @@ func noteInPaths(note string, paths []string) bool {
 			return true
 		}
 
+		if isGlob(paths[i]) {
+			if globMatches(paths[i], note) {
+				return true
+			}
+
+			continue
+		}
+
 		d, _ := filepath.Split(note)
 		if d == paths[i] {
 			return true
@@ -236,8 +257,13 @@ func noteInPaths(note string, paths []string) bool {
 	return false
 }
 
+// checkPathsExist returns an error if any path, other than a pattern, doesn't exist
 func checkPathsExist(paths []string) error {
 	for _, p := range paths {
+		if isGlob(p) {
+			continue
+		}
+
 		if _, err := os.Stat(p); err != nil || os.IsNotExist(err) {
 			return fmt.Errorf("failed to read path: %s", p)
 		}
@@ -248,7 +274,7 @@ func checkPathsExist(paths []string) error {
 
 func tagExists(title string, twn tagsWithNotes) bool {
 	for _, twn := range twn {
-		if twn.tag.Content.GetTitle() == title {
+		if twn.title() == title {
 			return true
 		}
 	}
@@ -256,15 +282,38 @@ func tagExists(title string, twn tagsWithNotes) bool {
 	return false
 }
 
-func findUntracked(paths, existingRemoteEquivalentPaths []string, home string, debug bool) (itemDiffs []ItemDiff) {
-	// if path is directory, then walk to generate list of additional Paths
+func findUntracked(paths, existingRemoteEquivalentPaths []string, home string, roots *Roots, ig *ignorer, debug bool) (itemDiffs []ItemDiff) {
+	var expanded []string
+
+	// patterns are expanded to the local paths matching them, and may match none
 	for _, path := range paths {
-		debugPrint(debug, fmt.Sprintf("compare | diffing path: %s", stripHome(path, home)))
+		if !isGlob(path) {
+			expanded = append(expanded, path)
+			continue
+		}
+
+		matches, err := globLocal(path, home, roots, ig)
+		if err != nil {
+			debugPrint(debug, fmt.Sprintf("compare | %s", err))
+			continue
+		}
+
+		expanded = append(expanded, matches...)
+	}
+
+	// if path is directory, then walk to generate list of additional Paths
+	for _, path := range expanded {
+		debugPrint(debug, fmt.Sprintf("compare | diffing path: %s", stripHome(path, home, roots)))
 
 		if StringInSlice(path, existingRemoteEquivalentPaths, true) {
 			continue
 		}
 
+		if ig.ignoredPath(path) {
+			debugPrint(debug, fmt.Sprintf("compare | ignoring path: %s", path))
+			continue
+		}
+
 		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
 			debugPrint(debug, fmt.Sprintf("compare | walking path: %s", path))
 
@@ -277,6 +326,24 @@ func findUntracked(paths, existingRemoteEquivalentPaths []string, home string, d
 					fmt.Printf("failed to read path %q: %v\n", p, err)
 					return err
 				}
+				if ig.ignored(p, info.IsDir()) {
+					debugPrint(debug, fmt.Sprintf("compare | ignoring path: %s", p))
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				// symlinks are untracked files regardless of what they point to
+				if isSymlink(p) {
+					debugPrint(debug, fmt.Sprintf("compare | symlink is untracked: %s", p))
+					itemDiffs = append(itemDiffs, ItemDiff{
+						homeRelPath: stripHome(p, home, roots),
+						path:        p,
+						diff:        untracked,
+						symlink:     true,
+					})
+					return nil
+				}
 				// ensure walked path is valid
 				if v, err := pathValid(p); !v {
 					return err
@@ -284,7 +351,7 @@ func findUntracked(paths, existingRemoteEquivalentPaths []string, home string, d
 				// add file as untracked
 				if stat, err := os.Stat(p); err == nil && !stat.IsDir() {
 					debugPrint(debug, fmt.Sprintf("compare | file is untracked: %s", p))
-					homeRelPath := stripHome(p, home)
+					homeRelPath := stripHome(p, home, roots)
 					itemDiffs = append(itemDiffs, ItemDiff{
 						homeRelPath: homeRelPath,
 						path:        p,
@@ -297,7 +364,7 @@ func findUntracked(paths, existingRemoteEquivalentPaths []string, home string, d
 				return
 			}
 		} else {
-			homeRelPath := stripHome(path, home)
+			homeRelPath := stripHome(path, home, roots)
 			debugPrint(debug, fmt.Sprintf("compare | file is untracked: %s", path))
 
 			itemDiffs = append(itemDiffs, ItemDiff{
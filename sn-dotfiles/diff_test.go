@@ -70,7 +70,7 @@ func TestDiff(t *testing.T) {
 	home := getTemporaryHome()
 	twn, fwc := testCompareSetup1and2(home)
 	// test when locals do not exist
-	diffs, _, err := diff(twn, home, []string{}, true)
+	diffs, _, err := diff(twn, home, nil, []string{}, nil, nil, DiffOptions{Context: DefaultDiffContext}, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 3)
 	assert.Equal(t, diffs[0].diff, localMissing)
@@ -84,12 +84,12 @@ func TestDiff(t *testing.T) {
 			fmt.Printf("failed to clean-up: %s\ndetails: %v\n", home, err)
 		}
 	}()
-	diffs, _, err = diff(twn, home, []string{}, true)
+	diffs, _, err = diff(twn, home, nil, []string{}, nil, nil, DiffOptions{Context: DefaultDiffContext}, true)
 	assert.Equal(t, diffs[0].diff, identical)
 	assert.Equal(t, diffs[1].diff, identical)
 	assert.Equal(t, diffs[2].diff, localMissing)
 	// test when no tags with notes supplied
-	diffs, _, err = diff(tagsWithNotes{}, home, []string{}, true)
+	diffs, _, err = diff(tagsWithNotes{}, home, nil, []string{}, nil, nil, DiffOptions{Context: DefaultDiffContext}, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 0)
 }
@@ -107,12 +107,12 @@ func TestCompare1(t *testing.T) {
 	}()
 
 	// missing remote and missing local
-	_, err = compare(tagsWithNotes{}, home, []string{"missing-file"}, []string{}, true)
+	_, err = compare(tagsWithNotes{}, home, nil, []string{"missing-file"}, []string{}, nil, true)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "tags with notes not supplied")
 
 	// existing remote and missing local
-	_, err = compare(twn, home, []string{"missing-file"}, []string{}, true)
+	_, err = compare(twn, home, nil, []string{"missing-file"}, []string{}, nil, true)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no such file")
 
@@ -120,7 +120,7 @@ func TestCompare1(t *testing.T) {
 	applePath := fmt.Sprintf("%s/.sn-dotfiles-test-fruit/apple", home)
 	lemonPath := fmt.Sprintf("%s/.sn-dotfiles-test-fruit/lemon", home)
 	allPaths := []string{applePath, lemonPath}
-	diffs, err = compare(twn, home, allPaths, []string{}, true)
+	diffs, err = compare(twn, home, nil, allPaths, []string{}, nil, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 2)
 	assert.NotEmpty(t, diffs)
@@ -193,7 +193,7 @@ func TestCompare2(t *testing.T) {
 
 	// valid local, valid remote, grape not compare'd as not specified in path
 	paths := []string{fmt.Sprintf("%s/.sn-dotfiles-test-fruit/", home)}
-	diffs, err = compare(twn, home, paths, []string{}, true)
+	diffs, err = compare(twn, home, nil, paths, []string{}, nil, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 3)
 	assert.NotEmpty(t, diffs)
@@ -243,7 +243,7 @@ func TestCompare3(t *testing.T) {
 
 	// valid local, valid remote, grape not compare'd as not specified in path
 	paths := []string{fmt.Sprintf("%s/.apple", home)}
-	diffs, err = compare(twn, home, paths, []string{}, true)
+	diffs, err = compare(twn, home, nil, paths, []string{}, nil, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 1)
 	assert.Equal(t, identical, diffs[0].diff)
@@ -284,7 +284,7 @@ func TestCompare4(t *testing.T) {
 	}()
 
 	paths := []string{fmt.Sprintf("%s/.apple", home), fmt.Sprintf("%s/.banana", home), fmt.Sprintf("%s/.cars", home)}
-	diffs, err = compare(twn, home, paths, []string{}, true)
+	diffs, err = compare(twn, home, nil, paths, []string{}, nil, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 3)
 	assert.Equal(t, identical, diffs[0].diff)
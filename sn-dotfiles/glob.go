@@ -0,0 +1,226 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// isGlob returns true if path is a pattern, rather than the name of an existing path
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[") && !pathExists(path)
+}
+
+// expandHome replaces a leading ~ in path with home, and makes a relative path relative to home
+func expandHome(home, path string) string {
+	switch {
+	case strings.HasPrefix(path, "~"):
+		return strings.Replace(path, "~", home, 1)
+	case !filepath.IsAbs(path):
+		return filepath.Join(home, path)
+	default:
+		return path
+	}
+}
+
+// globRegexp compiles an absolute glob pattern, where * and ? don't match a separator and ** matches
+// any number of directories
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^" + globToRegexp(filepath.ToSlash(filepath.Clean(pattern))) + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+
+	return re, nil
+}
+
+// matchGlob returns true if path, or a directory containing it, matches the pattern
+func matchGlob(re *regexp.Regexp, path string) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	for {
+		if re.MatchString(path) {
+			return true
+		}
+
+		parent := filepath.ToSlash(filepath.Dir(path))
+		if parent == path {
+			return false
+		}
+
+		path = parent
+	}
+}
+
+// globMatches returns true if path, or a directory containing it, matches an absolute pattern
+func globMatches(pattern, path string) bool {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return false
+	}
+
+	return matchGlob(re, path)
+}
+
+// globRoot returns the directory a pattern is matched within, being the longest part of it without any wildcards
+func globRoot(pattern string) string {
+	root := string(filepath.Separator)
+
+	for _, part := range strings.Split(filepath.Clean(pattern), string(filepath.Separator)) {
+		if strings.ContainsAny(part, "*?[") {
+			break
+		}
+
+		root = filepath.Join(root, part)
+	}
+
+	return root
+}
+
+// inDotPath returns true if path is a dotfile in home, or within a dot directory in home
+func inDotPath(path, home string) bool {
+	rel, err := filepath.Rel(home, path)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(rel, ".") && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// inHome returns true if path is within home, and not home itself
+func inHome(path, home string) bool {
+	rel, err := filepath.Rel(home, path)
+
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// leadsTo returns true if dir is home, or a root, or a directory containing either
+func leadsTo(dir, home string, roots *Roots) bool {
+	for _, d := range append([]string{home}, roots.dirs()...) {
+		if strings.HasPrefix(ensureTrailingPathSep(d), ensureTrailingPathSep(dir)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globLocal returns the dotfiles in home, and files in roots, matching an absolute pattern, skipping those ignored
+// and any that can't be added
+// files without a dot are only matched within a directory in home named by the pattern, e.g. ~/bin/*, so
+// wildcards don't reach everything in home
+// directories matched aren't walked, so their contents are left to the caller
+func globLocal(pattern, home string, roots *Roots, ig *ignorer) (matches []string, err error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return
+	}
+
+	root := globRoot(pattern)
+	named := inHome(root, home)
+
+	// without ** a pattern can only match paths as deep as it is
+	maxDepth := -1
+	if !strings.Contains(pattern, "**") {
+		maxDepth = strings.Count(filepath.Clean(pattern), string(filepath.Separator))
+	}
+
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// unreadable paths, or a root that doesn't exist, can't match
+			return nil
+		}
+
+		if !named && !inDotPath(p, home) && !roots.Contains(p) {
+			// the directories leading to home, and roots, are walked to reach them
+			if info.IsDir() && leadsTo(p, home, roots) {
+				return nil
+			}
+
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if p != root && ig.ignored(p, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if p != root && re.MatchString(filepath.ToSlash(p)) {
+			if valid, _ := preflightPathValid(p); valid {
+				matches = append(matches, p)
+			}
+
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if info.IsDir() && maxDepth >= 0 && strings.Count(p, string(filepath.Separator)) >= maxDepth {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return matches, err
+}
+
+// globTracked returns the paths of the notes tracked remotely that match an absolute pattern, or are within
+// a directory that does, whether or not they exist locally
+func globTracked(pattern, home string, roots *Roots, twn tagsWithNotes) (matches []string, err error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return
+	}
+
+	for _, t := range twn {
+		dir, dErr := tagTitleToFSDir(t.title(), home, roots)
+		if dErr != nil || dir == "" {
+			continue
+		}
+
+		for _, n := range t.notes {
+			if path := dir + n.Content.GetTitle(); matchGlob(re, path) {
+				matches = append(matches, path)
+			}
+		}
+	}
+
+	return dedupe(matches), err
+}
+
+// expandGlobs replaces each pattern in paths, which must be absolute, with the local paths matching it
+func expandGlobs(paths []string, home string, roots *Roots, ig *ignorer) (out []string, err error) {
+	for _, path := range paths {
+		if !isGlob(path) {
+			out = append(out, path)
+			continue
+		}
+
+		var matches []string
+
+		matches, err = globLocal(path, home, roots, ig)
+		if err != nil {
+			return
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no paths match %s", path)
+		}
+
+		out = append(out, matches...)
+	}
+
+	return dedupe(out), err
+}
@@ -0,0 +1,88 @@
+package sndotfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobLocal(t *testing.T) {
+	home := getTemporaryHome()
+	for _, dir := range []string{".config/app", ".config/other", ".config/app/nested", ".shell", "projects"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(home, dir), 0o700))
+	}
+
+	defer os.RemoveAll(home)
+
+	for _, path := range []string{".config/app/config.toml", ".config/other/config.toml", ".config/app/nested/config.toml",
+		".zshrc.zsh", ".shell/aliases.zsh", "projects/build.zsh"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(home, path), []byte(path), 0o600))
+	}
+
+	glob := func(pattern string) (rel []string) {
+		matches, err := globLocal(filepath.Join(home, pattern), home, nil, nil)
+		require.NoError(t, err)
+
+		for _, match := range matches {
+			rel = append(rel, stripHome(match, home, nil))
+		}
+
+		return rel
+	}
+
+	assert.ElementsMatch(t, []string{".config/app/config.toml", ".config/other/config.toml"}, glob(".config/*/config.toml"))
+	// only dotfiles are matched
+	assert.ElementsMatch(t, []string{".zshrc.zsh", ".shell/aliases.zsh"}, glob("**/*.zsh"))
+	// unless within a directory named by the pattern
+	assert.Equal(t, []string{"projects/build.zsh"}, glob("projects/*.zsh"))
+	// directories matched aren't walked
+	assert.ElementsMatch(t, []string{".config/app", ".config/other"}, glob(".config/*"))
+	assert.Empty(t, glob(".missing/*"))
+
+	assert.True(t, isGlob(filepath.Join(home, ".config/*")))
+	assert.False(t, isGlob(filepath.Join(home, ".config")))
+
+	_, err := expandGlobs([]string{filepath.Join(home, ".missing/*")}, home, nil, nil)
+	assert.Error(t, err)
+
+	paths, err := preflight(home, []string{"~/.config/*/config.toml", ".zshrc.zsh"})
+	require.NoError(t, err)
+
+	paths, err = expandGlobs(paths, home, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, paths, 3)
+}
+
+func TestGlobTracked(t *testing.T) {
+	home := getTemporaryHome()
+
+	twn := tagsWithNotes{
+		tagWithNotes{tag: createTag("dotfiles.config.app"), notes: gosn.Notes{createNote("config.toml", ""), createNote("theme", "")}},
+		tagWithNotes{tag: createTag("dotfiles"), notes: gosn.Notes{createNote(".gone.zsh", "")}},
+	}
+
+	matches, err := globTracked(filepath.Join(home, ".config/*/config.toml"), home, nil, twn)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(home, ".config/app/config.toml")}, matches)
+
+	// paths within a matching directory are matched, whether or not they exist locally
+	matches, err = globTracked(filepath.Join(home, ".config/a*"), home, nil, twn)
+	require.NoError(t, err)
+	assert.Len(t, matches, 2)
+
+	matches, err = globTracked(filepath.Join(home, "**/*.zsh"), home, nil, twn)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(home, ".gone.zsh")}, matches)
+
+	assert.True(t, noteInPaths(filepath.Join(home, ".config/app/theme"), []string{filepath.Join(home, ".config/*")}))
+	assert.False(t, noteInPaths(filepath.Join(home, ".config/app/theme"), []string{filepath.Join(home, ".config/*.toml")}))
+
+	assert.True(t, matchesPathsToExclude(home, nil, ".config/app/config.toml", []string{"~/.config/*/config.toml"}, nil))
+	assert.True(t, matchesPathsToExclude(home, nil, ".config/app/theme", []string{".config/a*"}, nil))
+	assert.False(t, matchesPathsToExclude(home, nil, ".config/app/theme", []string{"**/*.toml"}, nil))
+}
@@ -3,6 +3,7 @@ package sndotfiles
 import (
 	"fmt"
 	"github.com/asdine/storm/v3"
+	"github.com/briandowns/spinner"
 	"github.com/jonhadfield/gosn-v2"
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/pkg/errors"
@@ -12,6 +13,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 func debugPrint(show bool, msg string) {
@@ -20,6 +22,39 @@ func debugPrint(show bool, msg string) {
 	}
 }
 
+func startSpinner(session *cache.Session, useStdErr bool) (stop func()) {
+	if !spinnerWanted(useStdErr) {
+		return func() {}
+	}
+
+	prefix := HiWhite("syncing ")
+	if _, err := os.Stat(session.CacheDBPath); os.IsNotExist(err) {
+		prefix = HiWhite("initializing ")
+	}
+
+	s := spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stdout))
+	if useStdErr {
+		s = spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stderr))
+	}
+
+	s.Prefix = prefix
+	s.Start()
+
+	return s.Stop
+}
+
+// spinnerWanted returns true if the spinner would be written to a terminal, rather than a log or pipe
+func spinnerWanted(useStdErr bool) bool {
+	out := os.Stdout
+	if useStdErr {
+		out = os.Stderr
+	}
+
+	stat, err := out.Stat()
+
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
 func addDot(in string) string {
 	if !strings.HasPrefix(in, ".") {
 		return fmt.Sprintf(".%s", in)
@@ -44,7 +79,14 @@ func localExists(path string) bool {
 	return true
 }
 
-func stripHome(in, home string) string {
+func stripHome(in, home string, roots *Roots) string {
+	// paths in a root are relative to it, unless the root contains home
+	if rel, ok := roots.relPath(in); ok {
+		if _, dir := roots.rootOf(in); home == "" || !strings.HasPrefix(in, ensureTrailingPathSep(home)) || len(dir) > len(home) {
+			return rel
+		}
+	}
+
 	if home != "" && strings.HasPrefix(in, home) {
 		return in[len(home)+1:]
 	}
@@ -68,7 +110,7 @@ func addToDB(db *storm.DB, session *cache.Session, itemDiffs []ItemDiff, close b
 
 func getTagIfExists(name string, twn tagsWithNotes) (tag gosn.Tag, found bool) {
 	for _, x := range twn {
-		if name == x.tag.Content.GetTitle() {
+		if name == x.title() {
 			return x.tag, true
 		}
 	}
@@ -76,31 +118,39 @@ func getTagIfExists(name string, twn tagsWithNotes) (tag gosn.Tag, found bool) {
 	return tag, false
 }
 
-func createMissingTags(db *storm.DB, session *cache.Session, pt string, twn tagsWithNotes) (newTags gosn.Tags, err error) {
-	var fts []string
+// createMissingTags creates a tag for the path represented by tag title pt and each of its parents,
+// unless they already exist. If nested, each tag is titled with a single directory name and references its parent.
+func createMissingTags(db *storm.DB, session *cache.Session, pt string, twn tagsWithNotes, nested, dryRun bool) (newTags tagsWithNotes, err error) {
+	itemsToPush := gosn.Items{}
 
-	ts := strings.Split(pt, ".")
-	for x, t := range ts {
-		switch {
-		case x == 0:
-			fts = append(fts, t)
-		case x+1 == len(ts):
-			a := strings.Join(fts[len(fts)-1:], ".") + "." + t
-			fts = append(fts, a)
-		default:
-			a := strings.Join(fts[len(fts)-1:], ".") + "." + t
-			fts = append(fts, a)
-		}
-	}
+	var parent gosn.Tag
 
-	itemsToPush := gosn.Items{}
+	ts := splitTagTitle(pt)
+	for x := range ts {
+		f := joinTagTitle(ts[:x+1])
+
+		existingTag, found := getTagIfExists(f, twn)
+		if found {
+			parent = existingTag
+			continue
+		}
 
-	for _, f := range fts {
-		_, found := getTagIfExists(f, twn)
-		if !found {
-			nt := createTag(f)
-			itemsToPush = append(itemsToPush, &nt)
+		nt := createTag(f)
+		if nested && x > 0 {
+			nt = createTag(ts[x])
+			nt.Content.UpsertReferences(gosn.ItemReferences{{
+				UUID:        parent.UUID,
+				ContentType: "Tag",
+			}})
 		}
+
+		itemsToPush = append(itemsToPush, &nt)
+		newTags = append(newTags, tagWithNotes{tag: nt, fullTitle: f})
+		parent = nt
+	}
+
+	if dryRun {
+		return newTags, err
 	}
 
 	err = cache.SaveItems(db, session, itemsToPush, false)
@@ -108,10 +158,12 @@ func createMissingTags(db *storm.DB, session *cache.Session, pt string, twn tags
 		return
 	}
 
-	return itemsToPush.Tags(), err
+	return newTags, err
 }
 
-func pushAndTag(db *storm.DB, session *cache.Session, tim map[string]gosn.Items, twn tagsWithNotes) (tagsPushed, notesPushed int, err error) {
+// pushAndTag pushes the notes in the tag item map, tagging them with existing or newly created tags
+// if dryRun, the items are generated and counted without being saved
+func pushAndTag(db *storm.DB, session *cache.Session, tim map[string]gosn.Items, twn tagsWithNotes, nested, dryRun bool) (tagsPushed, notesPushed int, err error) {
 	// create missing tags first to create a new tim
 	itemsToPush := gosn.Items{}
 	for potentialTag, notes := range tim {
@@ -132,8 +184,8 @@ func pushAndTag(db *storm.DB, session *cache.Session, tim map[string]gosn.Items,
 			itemsToPush = append(itemsToPush, &existingTag)
 		} else {
 			// need to create tag
-			var newTags gosn.Tags
-			newTags, err = createMissingTags(db, session, potentialTag, twn)
+			var newTags tagsWithNotes
+			newTags, err = createMissingTags(db, session, potentialTag, twn, nested, dryRun)
 			if err != nil {
 				return
 			}
@@ -146,29 +198,46 @@ func pushAndTag(db *storm.DB, session *cache.Session, tim map[string]gosn.Items,
 					ContentType: "Note",
 				})
 			}
-			newTag := newTags[len(newTags)-1]
+			newTag := newTags[len(newTags)-1].tag
 			newTag.Content.UpsertReferences(newReferences)
 			itemsToPush = append(itemsToPush, &newTag)
 
 			// add to twn so we don't getTagsWithNotes duplicates
 			twn = append(twn, tagWithNotes{
-				tag:   newTag,
-				notes: notes.Notes(),
+				tag:       newTag,
+				fullTitle: potentialTag,
+				notes:     notes.Notes(),
 			})
-			for x := 0; x < len(newTags)-1; x++ {
-				twn = append(twn, tagWithNotes{
-					tag:   newTags[x],
-					notes: nil,
-				})
-			}
+			twn = append(twn, newTags[:len(newTags)-1]...)
 		}
 	}
-	err = cache.SaveItems(db, session, itemsToPush, true)
 	tagsPushed, notesPushed = getItemCounts(itemsToPush)
+	if dryRun {
+		return tagsPushed, notesPushed, err
+	}
+
+	err = cache.SaveItems(db, session, itemsToPush, true)
 
 	return tagsPushed, notesPushed, err
 }
 
+// missingTagTitles returns the titles of the tags that would need creating to tag the items in the tag item map
+func missingTagTitles(tim map[string]gosn.Items, twn tagsWithNotes) (titles []string) {
+	for potentialTag := range tim {
+		ts := splitTagTitle(potentialTag)
+		for x := range ts {
+			t := joinTagTitle(ts[:x+1])
+			if _, found := getTagIfExists(t, twn); !found && !StringInSlice(t, titles, true) {
+				titles = append(titles, t)
+			}
+		}
+	}
+
+	sort.Strings(titles)
+
+	return titles
+}
+
 func getItemCounts(items gosn.Items) (tags, notes int) {
 	return len(items.Tags()), len(items.Notes())
 }
@@ -183,21 +252,31 @@ func createTag(name string) (tag gosn.Tag) {
 	return
 }
 
-func createLocal(itemDiffs []ItemDiff) error {
+// createLocal writes each item's remote content locally, replacing each file atomically
+// any existing file is first copied to the same home relative path under backup, unless backup is empty
+func createLocal(itemDiffs []ItemDiff, backup string, roots *Roots) error {
 	for _, item := range itemDiffs {
 		dir, _ := filepath.Split(item.path)
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		if err := mkdirLocal(dir, os.ModePerm, roots); err != nil {
 			return err
 		}
 
-		f, err := os.Create(item.path)
-		if err != nil {
-			return err
+		if backup != "" && pathExists(item.path) {
+			if err := copyLocal(item.path, filepath.Join(backup, item.homeRelPath), !item.symlink, roots); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", item.homeRelPath, err)
+			}
+		}
+
+		if item.symlink {
+			if err := createLocalSymlink(item, roots); err != nil {
+				return err
+			}
+
+			continue
 		}
 
-		_, err = f.WriteString(item.remote.Content.GetText())
-		if err != nil {
-			f.Close()
+		mode, modeFound := getNoteMeta(item.remote).fileMode()
+		if err := writeLocalFile(item.path, item.remoteContent(), mode, modeFound, roots); err != nil {
 			return err
 		}
 	}
@@ -240,16 +319,16 @@ func getAllTagsWithoutNotes(twn tagsWithNotes, deletedNotes gosn.Notes, debug bo
 	res := make(map[string]int)
 	// initialise map with 0 count
 	for _, x := range twn {
-		res[x.tag.Content.GetTitle()] = 0
+		res[x.title()] = 0
 	}
 	// getTagsWithNotes a count of notes for each tag
 	for _, t := range twn {
-		debugPrint(debug, fmt.Sprintf("getAllTagsWithoutNotes | tag: %s", t.tag.Content.GetTitle()))
+		debugPrint(debug, fmt.Sprintf("getAllTagsWithoutNotes | tag: %s", t.title()))
 
 		// generate list of tags to reduce later
 		for _, n := range t.notes {
 			if !noteInNotes(n, deletedNotes) {
-				res[t.tag.Content.GetTitle()]++
+				res[t.title()]++
 			}
 		}
 	}
@@ -290,18 +369,18 @@ func findEmptyTags(twn tagsWithNotes, deletedNotes gosn.Notes, debug bool) gosn.
 	// loop through all identified tags with their associated notes and generate a map of them
 	// for each tag, the last item is the child
 	for _, atwn := range twn {
-		//if strings.HasPrefix(atwn.tag.Content.GetTitle(), DotFilesTag+".") || atwn.tag.Content.GetTitle() == DotFilesTag {
-		if strings.HasPrefix(atwn.tag.Content.GetTitle(), DotFilesTag+".") {
-			allDotfileChildTags = append(allDotfileChildTags, atwn.tag.Content.GetTitle())
+		//if strings.HasPrefix(atwn.title(), DotFilesTag+".") || atwn.title() == DotFilesTag {
+		if strings.HasPrefix(atwn.title(), DotFilesTag+".") {
+			allDotfileChildTags = append(allDotfileChildTags, atwn.title())
 		}
 
-		tagTitle := atwn.tag.Content.GetTitle()
-		splitTag := strings.Split(tagTitle, ".")
+		tagTitle := atwn.title()
+		splitTag := splitTagTitle(tagTitle)
 
-		if strings.Contains(tagTitle, ".") {
-			firstPart := splitTag[:len(splitTag)-1]
-			lastPart := splitTag[len(splitTag)-1:]
-			allTagsChildMap[strings.Join(firstPart, ".")] = append(allTagsChildMap[strings.Join(firstPart, ".")], strings.Join(lastPart, "."))
+		if len(splitTag) > 1 {
+			firstPart := joinTagTitle(splitTag[:len(splitTag)-1])
+			lastPart := escapeTagTitlePart(splitTag[len(splitTag)-1])
+			allTagsChildMap[firstPart] = append(allTagsChildMap[firstPart], lastPart)
 		}
 	}
 
@@ -362,7 +441,7 @@ func findEmptyTags(twn tagsWithNotes, deletedNotes gosn.Notes, debug bool) gosn.
 
 func tagTitlesToTags(tagTitles []string, twn tagsWithNotes) (res gosn.Tags) {
 	for _, t := range twn {
-		if StringInSlice(t.tag.Content.GetTitle(), tagTitles, true) {
+		if StringInSlice(t.title(), tagTitles, true) {
 			res = append(res, t.tag)
 		}
 	}
@@ -370,13 +449,18 @@ func tagTitlesToTags(tagTitles []string, twn tagsWithNotes) (res gosn.Tags) {
 	return
 }
 
-func getNotesToRemove(path, home string, twn tagsWithNotes, debug bool) (homeRelPath string, pathsToRemove []string, res gosn.Notes) {
+func getNotesToRemove(path, home string, roots *Roots, twn tagsWithNotes, debug bool) (homeRelPath string, pathsToRemove []string, res gosn.Notes) {
 	pathType, err := getPathType(path)
 	if err != nil {
-		return
+		// a path no longer existing locally may still be tracked
+		if !os.IsNotExist(err) {
+			return
+		}
+
+		pathType = "file"
 	}
 
-	homeRelPath = stripHome(path, home)
+	homeRelPath = stripHome(path, home, roots)
 	remoteEquiv := homeRelPath
 
 	debugPrint(debug, fmt.Sprintf("getNotesToRemove | path: '%s': %s", path, remoteEquiv))
@@ -389,9 +473,8 @@ func getNotesToRemove(path, home string, twn tagsWithNotes, debug bool) (homeRel
 	if pathType != "dir" {
 		// split between tag and title if remote equivalent doesn't contain slash
 		if strings.Contains(remoteEquiv, string(os.PathSeparator)) {
-			remoteEquiv = stripDot(remoteEquiv)
 			noteTag, noteTitle = filepath.Split(remoteEquiv)
-			noteTag = DotFilesTag + "." + strings.ReplaceAll(noteTag[:len(noteTag)-1], string(os.PathSeparator), ".")
+			noteTag = pathToTag(noteTag)
 		} else {
 			noteTag = DotFilesTag
 			noteTitle = remoteEquiv
@@ -399,7 +482,7 @@ func getNotesToRemove(path, home string, twn tagsWithNotes, debug bool) (homeRel
 
 		// check if remote exists
 		for _, t := range twn {
-			if t.tag.Content.GetTitle() == noteTag {
+			if t.title() == noteTag {
 				for _, note := range t.notes {
 					if note.Content.GetTitle() == noteTitle {
 						res = append(res, note)
@@ -410,31 +493,22 @@ func getNotesToRemove(path, home string, twn tagsWithNotes, debug bool) (homeRel
 		}
 	} else {
 		// tag specified so find all notes matching tag and tags underneath
-		remoteEquiv = stripDot(remoteEquiv)
 		debugPrint(debug, fmt.Sprintf("getNotesToRemove | remoteEquiv: %s", remoteEquiv))
 
-		// strip trailing slash if provided
-		if strings.HasSuffix(remoteEquiv, string(os.PathSeparator)) {
-			remoteEquiv = remoteEquiv[:len(remoteEquiv)-1]
-		}
-
-		// replace path separatators with dots
-		remoteEquiv = strings.ReplaceAll(remoteEquiv, string(os.PathSeparator), ".")
-
-		noteTag = DotFilesTag + "." + remoteEquiv
+		noteTag = pathToTag(remoteEquiv)
 		debugPrint(debug, fmt.Sprintf("getNotesToRemove | find notes matching tag: %s", noteTag))
 
 		// find notes matching tag
 		for _, t := range twn {
-			tagTitle := t.tag.Content.GetTitle()
+			tagTitle := t.title()
 			var tp string
-			tp, err = tagTitleToFSDir(tagTitle, home)
+			tp, err = tagTitleToFSDir(tagTitle, home, roots)
 			if err != nil {
 				return
 			}
-			tp = stripHome(tp, home)
+			tp = stripHome(tp, home, roots)
 
-			if t.tag.Content.GetTitle() == noteTag || strings.HasPrefix(t.tag.Content.GetTitle(), noteTag+".") {
+			if t.title() == noteTag || strings.HasPrefix(t.title(), noteTag+".") {
 				for _, note := range t.notes {
 					pathsToRemove = append(pathsToRemove, fmt.Sprintf("%s%s", tp, note.Content.GetTitle()))
 					{
@@ -454,7 +528,7 @@ func getNotesToRemove(path, home string, twn tagsWithNotes, debug bool) (homeRel
 
 func noteWithTagExists(tag, name string, twn tagsWithNotes) (count int) {
 	for _, t := range twn {
-		if t.tag.Content.GetTitle() == tag {
+		if t.title() == tag {
 			for _, note := range t.notes {
 				if note.Content.GetTitle() == name {
 					count++
@@ -487,7 +561,7 @@ func dedupe(in []string) []string {
 	return in[:j+1]
 }
 
-func tagTitleToFSDir(title, home string) (path string, err error) {
+func tagTitleToFSDir(title, home string, roots *Roots) (path string, err error) {
 	if title == "" {
 		err = errors.New("tag title required")
 		return
@@ -506,23 +580,109 @@ func tagTitleToFSDir(title, home string) (path string, err error) {
 		return home + string(os.PathSeparator), nil
 	}
 
-	a := title[len(DotFilesTag)+1:]
-	b := strings.ReplaceAll(a, ".", string(os.PathSeparator))
-	c := addDot(b)
+	if !strings.HasPrefix(title, DotFilesTag+".") {
+		return
+	}
+
+	parts := splitTagTitle(title)[1:]
+
+	// files outside home are tracked under the tag of their root, e.g. dotfiles.root:etc
+	if strings.HasPrefix(parts[0], RootPrefix) {
+		dir, ok := roots.dir(parts[0])
+		if !ok {
+			return "", nil
+		}
+
+		return ensureTrailingPathSep(filepath.Join(append([]string{dir}, parts[1:]...)...)), nil
+	}
 
-	return home + string(os.PathSeparator) + c + string(os.PathSeparator), err
+	// the leading dot of the top level directory is implied, unless marked as undotted, e.g. dotfiles.home:bin
+	if strings.HasPrefix(parts[0], HomePrefix) {
+		parts[0] = strings.TrimPrefix(parts[0], HomePrefix)
+	} else {
+		parts[0] = addDot(parts[0])
+	}
+
+	return home + string(os.PathSeparator) + filepath.Join(parts...) + string(os.PathSeparator), err
 }
 
+// HomePrefix starts the first element of the tags of directories in home that don't start with a dot,
+// e.g. bin/ is tracked with the tag dotfiles.home:bin, as the top level directory's dot is otherwise implied
+const HomePrefix = "home:"
+
+// pathToTag converts a directory relative to home into a tag title where each
+// directory is separated by a period, with any periods in directory names escaped
 func pathToTag(homeRelPath string) string {
-	// prepend dotfiles path
-	r := DotFilesTag + homeRelPath
-	// replace path separators with dots
-	r = strings.ReplaceAll(r, string(os.PathSeparator), ".")
-	if strings.HasSuffix(r, ".") {
-		return r[:len(r)-1]
+	parts := []string{DotFilesTag}
+
+	for _, p := range strings.Split(homeRelPath, string(os.PathSeparator)) {
+		if p == "" {
+			continue
+		}
+
+		// the leading dot of the top level directory is implied, so its absence is recorded instead
+		// it's kept if removing it would leave a name read otherwise, e.g. .home:x, .root:x or ..x
+		if len(parts) == 1 {
+			switch {
+			case strings.HasPrefix(p, "."):
+				if !hasTagPrefix(stripDot(p)) {
+					p = stripDot(p)
+				}
+			case !strings.HasPrefix(p, RootPrefix):
+				p = HomePrefix + p
+			}
+		}
+
+		parts = append(parts, p)
 	}
 
-	return r
+	return joinTagTitle(parts)
+}
+
+// hasTagPrefix returns true if the first element of a tag would not have a dot added when read back
+func hasTagPrefix(element string) bool {
+	return strings.HasPrefix(element, ".") || strings.HasPrefix(element, HomePrefix) || strings.HasPrefix(element, RootPrefix)
+}
+
+// escapeTagTitlePart escapes characters that would otherwise be read as tag title separators
+func escapeTagTitlePart(in string) string {
+	return tagTitleEscaper.Replace(in)
+}
+
+var tagTitleEscaper = strings.NewReplacer(`\`, `\\`, ".", `\.`)
+
+// joinTagTitle joins unescaped parts into a tag title
+func joinTagTitle(parts []string) string {
+	escaped := make([]string, len(parts))
+	for i := range parts {
+		escaped[i] = escapeTagTitlePart(parts[i])
+	}
+
+	return strings.Join(escaped, ".")
+}
+
+// splitTagTitle splits a tag title on unescaped periods and unescapes each part
+func splitTagTitle(title string) (parts []string) {
+	var part strings.Builder
+
+	var escaped bool
+
+	for _, r := range title {
+		switch {
+		case escaped:
+			part.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+
+	return append(parts, part.String())
 }
 
 func isUnencryptedSession(in string) bool {
@@ -576,12 +736,24 @@ func colourDiff(diff string) string {
 		return green(diff)
 	case localMissing:
 		return red(diff)
+	case conflict:
+		return red(diff)
+	case modeChanged:
+		return yellow(diff)
+	case localDeleted:
+		return yellow(diff)
+	case remoteDeleted:
+		return yellow(diff)
+	case targetChanged:
+		return yellow(diff)
 	case localNewer:
 		return yellow(diff)
 	case untracked:
 		return yellow(diff)
 	case remoteNewer:
 		return yellow(diff)
+	case failed:
+		return red(diff)
 	default:
 		return diff
 	}
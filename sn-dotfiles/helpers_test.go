@@ -6,6 +6,7 @@ import (
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/stretchr/testify/require"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -47,23 +48,74 @@ func TestGetAllTagsWithoutNotes(t *testing.T) {
 func TestTagTitleToFSDIR(t *testing.T) {
 	home := getTemporaryHome()
 	// missing Home should return err
-	p, err := tagTitleToFSDir(fmt.Sprintf("%s.fruit.lemon", DotFilesTag), "")
+	p, err := tagTitleToFSDir(fmt.Sprintf("%s.fruit.lemon", DotFilesTag), "", nil)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "home directory required")
 	assert.Empty(t, p)
 
 	// check result for supplied title and Home
-	p, err = tagTitleToFSDir(DotFilesTag, home)
+	p, err = tagTitleToFSDir(DotFilesTag, home, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, fmt.Sprintf("%s/", home), p)
 
 	// missing title should generate error
-	p, err = tagTitleToFSDir("", home)
+	p, err = tagTitleToFSDir("", home, nil)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "tag title required")
 	assert.Equal(t, "", p)
 }
 
+func TestPathToTag(t *testing.T) {
+	home := getTemporaryHome()
+	assert.Equal(t, DotFilesTag, pathToTag(""))
+	assert.Equal(t, "dotfiles.config.nvim", pathToTag(".config/nvim/"))
+	assert.Equal(t, `dotfiles.config.foo\.d.bar`, pathToTag(".config/foo.d/bar"))
+	assert.NotEqual(t, pathToTag(".config/foo.d/bar"), pathToTag(".config/foo/d/bar"))
+	// directories without a dot are marked as such
+	assert.Equal(t, "dotfiles.home:bin", pathToTag("bin/"))
+	assert.Equal(t, "dotfiles.home:work.config", pathToTag("work/config"))
+	assert.NotEqual(t, pathToTag("bin"), pathToTag(".bin"))
+	// the dot is kept where removing it would change how the tag is read
+	assert.Equal(t, `dotfiles.\.home:x`, pathToTag(".home:x/"))
+	assert.Equal(t, `dotfiles.\.root:x`, pathToTag(".root:x/"))
+	assert.Equal(t, `dotfiles.\.\.x`, pathToTag("..x/"))
+
+	// check tag titles convert back to the original directory
+	for _, dir := range []string{".config/foo.d/bar", ".config/foo/d/bar", `.config/back\slash.d`, "bin", "work/config",
+		"home:dir", ".home:dir", ".root:dir", "..dir"} {
+		p, err := tagTitleToFSDir(pathToTag(dir), home, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("%s/%s/", home, dir), p)
+	}
+}
+
+func TestSplitTagTitle(t *testing.T) {
+	assert.Equal(t, []string{"dotfiles"}, splitTagTitle("dotfiles"))
+	assert.Equal(t, []string{"dotfiles", "config", "foo.d"}, splitTagTitle(`dotfiles.config.foo\.d`))
+	assert.Equal(t, `dotfiles.config.foo\.d`, joinTagTitle([]string{"dotfiles", "config", "foo.d"}))
+}
+
+func TestGetFullTagTitles(t *testing.T) {
+	dotfilesTag := createTag(DotFilesTag)
+	configTag := createTag("config")
+	configTag.Content.UpsertReferences(gosn.ItemReferences{{UUID: dotfilesTag.UUID, ContentType: "Tag"}})
+	confDTag := createTag("conf.d")
+	confDTag.Content.UpsertReferences(gosn.ItemReferences{{UUID: configTag.UUID, ContentType: "Tag"}})
+	flatTag := createTag("dotfiles.vim")
+
+	fullTitles := getFullTagTitles(gosn.Tags{confDTag, configTag, dotfilesTag, flatTag})
+	assert.Equal(t, DotFilesTag, fullTitles[dotfilesTag.UUID])
+	assert.Equal(t, "dotfiles.config", fullTitles[configTag.UUID])
+	assert.Equal(t, `dotfiles.config.conf\.d`, fullTitles[confDTag.UUID])
+	assert.Equal(t, "dotfiles.vim", fullTitles[flatTag.UUID])
+
+	twn := tagWithNotes{tag: confDTag, fullTitle: fullTitles[confDTag.UUID]}
+	assert.True(t, twn.nested())
+	dir, err := tagTitleToFSDir(twn.title(), "home", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("home", ".config", "conf.d")+string(os.PathSeparator), dir)
+}
+
 func TestDeDupe(t *testing.T) {
 	noDupes := dedupe([]string{"lemon", "apple", "grapefruit"})
 	assert.Len(t, noDupes, 3)
@@ -91,11 +143,11 @@ func TestCreateTag(t *testing.T) {
 
 func TestStripHome(t *testing.T) {
 	home := getTemporaryHome()
-	h1 := stripHome(fmt.Sprintf("%s/my/path", home), home)
+	h1 := stripHome(fmt.Sprintf("%s/my/path", home), home, nil)
 	assert.Equal(t, "my/path", h1)
-	h2 := stripHome("/my/path", home)
+	h2 := stripHome("/my/path", home, nil)
 	assert.Equal(t, "/my/path", h2)
-	h3 := stripHome("", "")
+	h3 := stripHome("", "", nil)
 	assert.Equal(t, "", h3)
 }
 
@@ -120,7 +172,7 @@ func TestCompareIdentical(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, f.Close())
 	// verify local and remote identical produces correct ItemDiff
-	iDiff := compareNoteWithFile("apple", applePath, home, appleNote, true)
+	iDiff := compareNoteWithFile("apple", applePath, home, nil, appleNote, true)
 	assert.Equal(t, identical, iDiff.diff)
 	assert.Equal(t, "apple", iDiff.tagTitle)
 	assert.Equal(t, "apple", iDiff.noteTitle)
@@ -143,7 +195,7 @@ func TestCompareRemoteNewer(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, f.Close())
 	// verify local and remote differ and remote newer produces correct ItemDiff
-	iDiff := compareNoteWithFile("lemon", lemonPath, home, lemonNote, true)
+	iDiff := compareNoteWithFile("lemon", lemonPath, home, nil, lemonNote, true)
 	assert.Equal(t, remoteNewer, iDiff.diff)
 	assert.Equal(t, "lemon", iDiff.tagTitle)
 	assert.Equal(t, "lemon", iDiff.noteTitle)
@@ -165,7 +217,7 @@ func TestCompareLocalNewer(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, f.Close())
 	// verify local and remote differ and local newer produces correct ItemDiff
-	iDiff := compareNoteWithFile("lemon", lemonPath, home, lemonNote, true)
+	iDiff := compareNoteWithFile("lemon", lemonPath, home, nil, lemonNote, true)
 	assert.Equal(t, localNewer, iDiff.diff)
 	assert.Equal(t, "lemon", iDiff.tagTitle)
 	assert.Equal(t, "lemon", iDiff.noteTitle)
@@ -173,6 +225,26 @@ func TestCompareLocalNewer(t *testing.T) {
 	assert.Equal(t, lemonNote, iDiff.remote)
 }
 
+func TestCompareModeChanged(t *testing.T) {
+	home := getTemporaryHome()
+	err := os.MkdirAll(home, os.ModePerm)
+	assert.NoError(t, err)
+	// setup
+	appleNote := createNote("apple", "apple content")
+	setNoteMode(&appleNote, 0600)
+	applePath := fmt.Sprintf("%s/apple", home)
+	assert.NoError(t, createPathWithContent(applePath, "apple content"))
+	assert.NoError(t, os.Chmod(applePath, 0644))
+	// verify identical content with a different mode produces correct ItemDiff
+	iDiff := compareNoteWithFile("apple", applePath, home, nil, appleNote, true)
+	assert.Equal(t, modeChanged, iDiff.diff)
+	assert.Equal(t, os.FileMode(0644), iDiff.localMode)
+	// verify restoring the mode makes them identical
+	assert.NoError(t, createLocal([]ItemDiff{iDiff}, "", nil))
+	iDiff = compareNoteWithFile("apple", applePath, home, nil, appleNote, true)
+	assert.Equal(t, identical, iDiff.diff)
+}
+
 func TestStripDot(t *testing.T) {
 	assert.Equal(t, "test", stripDot(".test"))
 	assert.Equal(t, "test", stripDot("test"))
@@ -236,3 +308,23 @@ func TestPushNoItems(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no items")
 }
+
+func TestPushAndTagDryRun(t *testing.T) {
+	dotfilesTag := createTag(DotFilesTag)
+	twn := tagsWithNotes{tagWithNotes{tag: dotfilesTag}}
+
+	appleNote := createNote("apple", "apple content")
+	gitConfigNote := createNote(".gitconfig", "gitconfig content")
+	tim := map[string]gosn.Items{
+		"dotfiles.fruit.red": {&appleNote},
+		DotFilesTag:          {&gitConfigNote},
+	}
+
+	assert.Equal(t, []string{"dotfiles.fruit", "dotfiles.fruit.red"}, missingTagTitles(tim, twn))
+
+	// nothing is saved so no db is required
+	tagsPushed, notesPushed, err := pushAndTag(nil, nil, tim, twn, false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, tagsPushed)
+	assert.Equal(t, 2, notesPushed)
+}
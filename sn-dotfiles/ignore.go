@@ -0,0 +1,254 @@
+package sndotfiles
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the name of the files listing paths to ignore, using gitignore syntax
+// patterns in the global file, in the config directory, are relative to home, and those in any other
+// directory are relative to that directory
+const IgnoreFileName = ".sndotfilesignore"
+
+// globalIgnoreFile returns the path of the ignore file applying to all of home
+// a variable so it can be replaced in tests
+var globalIgnoreFile = func() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, SNAppName, IgnoreFileName)
+}
+
+// ignoreRule is a single pattern from an ignore file
+type ignoreRule struct {
+	// base is the directory the pattern is relative to
+	base string
+	re   *regexp.Regexp
+	// anchored patterns are matched against the path relative to base, others against its last element
+	anchored bool
+	negate   bool
+	dirOnly  bool
+}
+
+// parseIgnoreRule parses a line of an ignore file, returning false if it's blank or a comment
+func parseIgnoreRule(base, line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	rule.base = base
+
+	switch {
+	case strings.HasPrefix(line, "!"):
+		rule.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return rule, false
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return rule, false
+	}
+
+	rule.re = re
+
+	return rule, true
+}
+
+// globToRegexp converts a gitignore glob to a regular expression, where * and ? don't match a separator
+// and ** matches any number of directories
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
+
+// matches returns true if the rule applies to path, which must be within its base
+func (r ignoreRule) matches(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	rel, err := filepath.Rel(r.base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	rel = filepath.ToSlash(rel)
+	if !r.anchored {
+		rel = filepath.Base(rel)
+	}
+
+	return r.re.MatchString(rel)
+}
+
+func readIgnoreFile(path, base string) (rules []ignoreRule) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(base, scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// ignorer decides whether paths in home are ignored, using the global ignore file and those in each directory
+// a nil ignorer ignores nothing
+type ignorer struct {
+	home   string
+	global []ignoreRule
+	// dirs caches the rules from each directory's ignore file
+	dirs map[string][]ignoreRule
+}
+
+func newIgnorer(home string) *ignorer {
+	ig := &ignorer{
+		home: filepath.Clean(home),
+		dirs: make(map[string][]ignoreRule),
+	}
+
+	if path := globalIgnoreFile(); path != "" {
+		ig.global = readIgnoreFile(path, ig.home)
+	}
+
+	return ig
+}
+
+func (ig *ignorer) dirRules(dir string) []ignoreRule {
+	rules, found := ig.dirs[dir]
+	if !found {
+		rules = readIgnoreFile(filepath.Join(dir, IgnoreFileName), dir)
+		ig.dirs[dir] = rules
+	}
+
+	return rules
+}
+
+// ignored returns true if path, or any directory containing it, is ignored
+// as with git, a path can't be included again if a directory containing it is ignored
+func (ig *ignorer) ignored(path string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+
+	path = filepath.Clean(path)
+
+	rel, err := filepath.Rel(ig.home, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	rules := ig.global
+	current := ig.home
+
+	for i, part := range parts {
+		rules = append(rules[:len(rules):len(rules)], ig.dirRules(current)...)
+		current = filepath.Join(current, part)
+
+		partIsDir := isDir || i < len(parts)-1
+
+		var ignored bool
+
+		for _, rule := range rules {
+			if rule.matches(current, partIsDir) {
+				ignored = !rule.negate
+			}
+		}
+
+		if ignored {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ignoredPath returns true if path is ignored, checking whether it's a directory
+func (ig *ignorer) ignoredPath(path string) bool {
+	if ig == nil {
+		return false
+	}
+
+	fi, err := os.Lstat(path)
+
+	return ig.ignored(path, err == nil && fi.IsDir())
+}
+
+// ignoredHomeRel returns true if a path relative to home is ignored
+// paths in roots are outside home, so never ignored
+func (ig *ignorer) ignoredHomeRel(homeRelPath string) bool {
+	if ig == nil || strings.HasPrefix(homeRelPath, RootPrefix) {
+		return false
+	}
+
+	return ig.ignoredPath(localPath(ig.home, homeRelPath, nil))
+}
@@ -0,0 +1,112 @@
+package sndotfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreRuleMatches(t *testing.T) {
+	base := "/home/user"
+
+	for _, tc := range []struct {
+		pattern string
+		path    string
+		isDir   bool
+		match   bool
+	}{
+		{"*.log", ".config/app/error.log", false, true},
+		{"*.log", ".config/app/error.logs", false, false},
+		{"history", ".config/app/history", false, true},
+		{"/history", ".config/app/history", false, false},
+		{"/history", "history", false, true},
+		{"cache/", ".config/app/cache", true, true},
+		{"cache/", ".config/app/cache", false, false},
+		{".config/*/cache", ".config/app/cache", true, true},
+		{".config/*/cache", ".config/app/sub/cache", true, false},
+		{"**/cache", ".config/app/sub/cache", true, true},
+		{".config/**/cache", ".config/cache", true, true},
+		{".config/**", ".config/app/settings", false, true},
+		{"file?.txt", "file1.txt", false, true},
+		{"file[0-9].txt", "filea.txt", false, false},
+		{"file[!0-9].txt", "filea.txt", false, true},
+		{`\#notes`, "#notes", false, true},
+	} {
+		rule, ok := parseIgnoreRule(base, tc.pattern)
+		require.True(t, ok, tc.pattern)
+		assert.Equal(t, tc.match, rule.matches(filepath.Join(base, tc.path), tc.isDir), "%s: %s", tc.pattern, tc.path)
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "/"} {
+		_, ok := parseIgnoreRule(base, line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestIgnorer(t *testing.T) {
+	home := getTemporaryHome()
+	configDir := filepath.Join(home, "config")
+	appDir := filepath.Join(home, ".config", "app")
+	require.NoError(t, os.MkdirAll(filepath.Join(appDir, "cache"), 0o700))
+	require.NoError(t, os.MkdirAll(configDir, 0o700))
+
+	defer os.RemoveAll(home)
+
+	globalPath := filepath.Join(configDir, IgnoreFileName)
+	orig := globalIgnoreFile
+	globalIgnoreFile = func() string { return globalPath }
+
+	defer func() { globalIgnoreFile = orig }()
+
+	require.NoError(t, ioutil.WriteFile(globalPath, []byte("# global\n*.sock\ncache/\n/.history\n"), 0o600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(appDir, IgnoreFileName), []byte("history\n!keep.sock\n"), 0o600))
+
+	for _, name := range []string{"settings", "history", "app.sock", "keep.sock", "cache/data"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(appDir, name), []byte(name), 0o600))
+	}
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, ".history"), []byte("history"), 0o600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, ".bashrc"), []byte("bashrc"), 0o600))
+
+	ig := newIgnorer(home)
+
+	assert.False(t, ig.ignored(filepath.Join(appDir, "settings"), false))
+	// per directory rules only apply within the directory
+	assert.True(t, ig.ignored(filepath.Join(appDir, "history"), false))
+	assert.False(t, ig.ignored(filepath.Join(home, "history"), false))
+	// global rules apply throughout home, but can be negated
+	assert.True(t, ig.ignored(filepath.Join(appDir, "app.sock"), false))
+	assert.False(t, ig.ignored(filepath.Join(appDir, "keep.sock"), false))
+	// paths within ignored directories are ignored
+	assert.True(t, ig.ignored(filepath.Join(appDir, "cache", "data"), false))
+	assert.True(t, ig.ignoredHomeRel(".config/app/cache"))
+	// paths outside home are never ignored
+	assert.False(t, ig.ignored("/tmp/app.sock", false))
+
+	var nilIgnorer *ignorer
+	assert.False(t, nilIgnorer.ignored(filepath.Join(appDir, "app.sock"), false))
+
+	paths, err := getLocalFSPaths([]string{filepath.Join(home, ".config")}, false, SymlinksTrack, ig)
+	require.NoError(t, err)
+
+	var relPaths []string
+	for _, path := range paths {
+		relPaths = append(relPaths, stripHome(path, home, nil))
+	}
+
+	assert.ElementsMatch(t, []string{".config/app/.sndotfilesignore", ".config/app/settings", ".config/app/keep.sock"}, relPaths)
+
+	untracked := findUntracked([]string{filepath.Join(home, ".config")}, nil, home, nil, ig, false)
+	assert.Len(t, untracked, 3)
+
+	assert.True(t, matchesPathsToExclude(home, nil, ".config/app/history", nil, ig))
+	assert.False(t, matchesPathsToExclude(home, nil, ".config/app/settings", nil, ig))
+
+	paths, err = discoverDotfilesInHome(home, 0, nil, ig, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(home, ".bashrc")}, paths)
+}
@@ -0,0 +1,342 @@
+package sndotfiles
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// conflictMarkers are written around each side of an item being merged in an editor
+const (
+	conflictMarkerLocal  = "<<<<<<< local"
+	conflictMarkerSep    = "======="
+	conflictMarkerRemote = ">>>>>>> remote"
+)
+
+// resolver asks the user what to do with each item a sync would change
+type resolver struct {
+	in  *bufio.Reader
+	out io.Writer
+	// edit opens the file at path for the user to edit
+	edit func(path string) error
+	// closed is set once input ends, after which all remaining items are skipped
+	closed bool
+}
+
+func newResolver(in io.Reader, out io.Writer) *resolver {
+	return &resolver{
+		in:   bufio.NewReader(in),
+		out:  out,
+		edit: editInEditor,
+	}
+}
+
+// editInEditor opens a file in the user's $EDITOR, or vi if not set
+func editInEditor(path string) error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	return runTool(editor+` "$MERGED"`, map[string]string{"MERGED": path})
+}
+
+// ask prompts until one of the choices is entered, returning def if nothing is entered and def is set
+func (r *resolver) ask(prompt string, choices string, def byte) byte {
+	for {
+		if r.closed {
+			return 's'
+		}
+
+		fmt.Fprintf(r.out, "%s ", prompt)
+
+		line, err := r.in.ReadString('\n')
+		if err != nil {
+			// no more input so leave everything else untouched
+			r.closed = true
+
+			if strings.TrimSpace(line) == "" {
+				return 's'
+			}
+		}
+
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" && def != 0 {
+			return def
+		}
+
+		if len(line) == 1 && strings.Contains(choices, line) {
+			return line[0]
+		}
+	}
+}
+
+// resolve asks what to do with each item to be pushed, pulled, removed or trashed, and each conflict,
+// returning the actions chosen
+// conflicts involving deletions, symlinks or templates can't be resolved interactively and are left untouched
+func (r *resolver) resolve(actions syncActions) (resolved syncActions, err error) {
+	resolved = syncActions{
+		identical: actions.identical,
+		notPushed: actions.notPushed,
+		failed:    actions.failed,
+		gone:      actions.gone,
+		bases:     actions.bases,
+	}
+
+	changed := func(itemDiff ItemDiff, def byte) error {
+		choice, merged, cErr := r.resolveChange(itemDiff, def)
+		if cErr != nil {
+			return cErr
+		}
+
+		switch choice {
+		case 'l':
+			resolved.push = append(resolved.push, itemDiff)
+		case 'r':
+			resolved.pull = append(resolved.pull, itemDiff)
+		case 'e':
+			itemDiff.local = merged
+			resolved.merged = append(resolved.merged, itemDiff)
+		default:
+			if itemDiff.diff == conflict {
+				resolved.conflicting = append(resolved.conflicting, itemDiff)
+			}
+		}
+
+		return nil
+	}
+
+	for _, itemDiff := range actions.push {
+		if err = changed(itemDiff, 'l'); err != nil {
+			return
+		}
+	}
+
+	for _, itemDiff := range actions.pull {
+		if err = changed(itemDiff, 'r'); err != nil {
+			return
+		}
+	}
+
+	for _, itemDiff := range actions.conflicting {
+		if itemDiff.symlink || itemDiff.template || itemDiff.remote.UUID == "" || !pathExists(itemDiff.path) {
+			resolved.conflicting = append(resolved.conflicting, itemDiff)
+			continue
+		}
+
+		if err = changed(itemDiff, 0); err != nil {
+			return
+		}
+	}
+
+	for _, itemDiff := range actions.remove {
+		prompt := fmt.Sprintf("%s %s: remove remote? [y]es, [s]kip [y]", bold(itemDiff.homeRelPath), colourDiff(itemDiff.diff))
+		if r.ask(prompt, "ys", 'y') == 'y' {
+			resolved.remove = append(resolved.remove, itemDiff)
+		}
+	}
+
+	for _, itemDiff := range actions.trash {
+		prompt := fmt.Sprintf("%s %s: move local to trash? [y]es, [s]kip [y]", bold(itemDiff.homeRelPath), colourDiff(itemDiff.diff))
+		if r.ask(prompt, "ys", 'y') == 'y' {
+			resolved.trash = append(resolved.trash, itemDiff)
+		}
+	}
+
+	return resolved, err
+}
+
+// resolveChange asks whether to keep the local or remote content of an item, showing the diff or
+// merging in an editor as requested, and returns the choice along with any merged content
+func (r *resolver) resolveChange(itemDiff ItemDiff, def byte) (choice byte, merged string, err error) {
+	options, choices := "keep [l]ocal, keep [r]emote, [d]iff, [e]dit, [s]kip", "lrdes"
+
+	switch {
+	case !pathExists(itemDiff.path), itemDiff.template:
+		// there's nothing local to keep or merge, or templates would be replaced by their output
+		options, choices = "keep [r]emote, [d]iff, [s]kip", "rds"
+	case itemDiff.symlink:
+		options, choices = "keep [l]ocal, keep [r]emote, [d]iff, [s]kip", "lrds"
+	}
+
+	prompt := fmt.Sprintf("%s %s: %s", bold(itemDiff.homeRelPath), colourDiff(displayDiff(itemDiff)), options)
+	if def != 0 {
+		prompt += fmt.Sprintf(" [%c]", def)
+	}
+
+	for {
+		choice = r.ask(prompt, choices, def)
+
+		switch choice {
+		case 'd':
+			fmt.Fprint(r.out, unifiedDiff("local/"+itemDiff.homeRelPath, "remote/"+itemDiff.homeRelPath,
+				itemDiff.local, itemDiff.remoteContent(), DefaultDiffContext))
+		case 'e':
+			var ok bool
+
+			merged, ok, err = r.editMerge(itemDiff)
+			if err != nil || ok {
+				return choice, merged, err
+			}
+
+			fmt.Fprintln(r.out, yellow("conflict markers remain, so not merged"))
+		default:
+			return choice, merged, err
+		}
+	}
+}
+
+// editMerge opens the local and remote content of an item, separated by conflict markers, in an editor
+// and returns the result if no markers remain
+func (r *resolver) editMerge(itemDiff ItemDiff) (merged string, ok bool, err error) {
+	var dir string
+
+	dir, err = ioutil.TempDir("", SNAppName+"-")
+	if err != nil {
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	content := fmt.Sprintf("%s\n%s%s\n%s%s\n", conflictMarkerLocal, ensureTrailingNewline(itemDiff.local),
+		conflictMarkerSep, ensureTrailingNewline(itemDiff.remoteContent()), conflictMarkerRemote)
+
+	var path string
+
+	path, err = writeToolFile(dir, "merged", filepath.Base(itemDiff.path), content)
+	if err != nil {
+		return
+	}
+
+	if err = r.edit(path); err != nil {
+		return merged, false, fmt.Errorf("failed to edit %s: %w", itemDiff.homeRelPath, err)
+	}
+
+	var b []byte
+
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	merged = string(b)
+
+	return merged, !hasConflictMarkers(merged), nil
+}
+
+func ensureTrailingNewline(in string) string {
+	if in == "" || strings.HasSuffix(in, "\n") {
+		return in
+	}
+
+	return in + "\n"
+}
+
+// checklist lists the candidates, by their paths relative to home, and asks which to select until done
+// all are selected to begin with, and none are if input ends before the selection is confirmed
+func (r *resolver) checklist(candidates []string, home string) (selected []string) {
+	chosen := make([]bool, len(candidates))
+	for i := range chosen {
+		chosen[i] = true
+	}
+
+	for {
+		for i, candidate := range candidates {
+			mark := " "
+			if chosen[i] {
+				mark = "x"
+			}
+
+			fmt.Fprintf(r.out, "%3d [%s] %s\n", i+1, mark, stripHome(candidate, home, nil))
+		}
+
+		fmt.Fprint(r.out, "toggle numbers or ranges (e.g. 1 3 5-7), select [a]ll or [n]one, [d]one, [q]uit [d] ")
+
+		line, err := r.in.ReadString('\n')
+		if err != nil && strings.TrimSpace(line) == "" {
+			r.closed = true
+
+			return nil
+		}
+
+		switch line = strings.ToLower(strings.TrimSpace(line)); line {
+		case "", "d":
+			for i, candidate := range candidates {
+				if chosen[i] {
+					selected = append(selected, candidate)
+				}
+			}
+
+			return selected
+		case "q":
+			return nil
+		case "a", "n":
+			for i := range chosen {
+				chosen[i] = line == "a"
+			}
+		default:
+			for _, field := range strings.Fields(strings.ReplaceAll(line, ",", " ")) {
+				first, last, ok := parseChecklistRange(field, len(candidates))
+				if !ok {
+					fmt.Fprintf(r.out, "invalid selection: %s\n", field)
+					continue
+				}
+
+				for i := first; i <= last; i++ {
+					chosen[i-1] = !chosen[i-1]
+				}
+			}
+		}
+	}
+}
+
+// parseChecklistRange parses a number, or range of numbers such as 5-7, within a checklist of n items
+func parseChecklistRange(field string, n int) (first, last int, ok bool) {
+	from, to := field, field
+	if i := strings.Index(field, "-"); i > 0 {
+		from, to = field[:i], field[i+1:]
+	}
+
+	first, fErr := strconv.Atoi(from)
+	last, lErr := strconv.Atoi(to)
+
+	if fErr != nil || lErr != nil || first < 1 || last > n || first > last {
+		return 0, 0, false
+	}
+
+	return first, last, true
+}
+
+// errNotInteractive is returned if an interactive sync is requested without a terminal to interact with
+var errNotInteractive = errors.New("interactive sync requires a terminal")
+
+// stdinIsTerminal returns true if the user can be asked questions on stdin
+func stdinIsTerminal() bool {
+	stat, err := os.Stdin.Stat()
+
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// resolveInteractively asks the user on the terminal what to do with each item a sync would change
+func resolveInteractively(actions syncActions) (syncActions, error) {
+	if !stdinIsTerminal() {
+		return actions, errNotInteractive
+	}
+
+	return newResolver(os.Stdin, os.Stdout).resolve(actions)
+}
+
+// selectInteractively asks the user on the terminal which of the dotfiles discovered to add
+func selectInteractively(candidates []string, home string) ([]string, error) {
+	if !stdinIsTerminal() {
+		return nil, errors.New("interactive add requires a terminal")
+	}
+
+	return newResolver(os.Stdin, os.Stdout).checklist(candidates, home), nil
+}
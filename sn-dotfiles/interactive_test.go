@@ -0,0 +1,180 @@
+package sndotfiles
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverAsk(t *testing.T) {
+	var out bytes.Buffer
+
+	r := newResolver(strings.NewReader("x\nR\n\n"), &out)
+	// invalid choices are asked again
+	assert.Equal(t, byte('r'), r.ask("choose", "lrs", 'l'))
+	assert.Equal(t, 2, strings.Count(out.String(), "choose"))
+	// nothing entered uses the default
+	assert.Equal(t, byte('l'), r.ask("choose", "lrs", 'l'))
+	// end of input skips
+	assert.Equal(t, byte('s'), r.ask("choose", "lrs", 'l'))
+	assert.Equal(t, byte('s'), r.ask("choose", "lrs", 'l'))
+}
+
+func TestResolverChecklist(t *testing.T) {
+	home := "/home/user"
+	candidates := []string{"/home/user/.apple", "/home/user/.config/lemon", "/home/user/.grape", "/home/user/.fig"}
+
+	var out bytes.Buffer
+
+	// toggle off .apple and a range, with an invalid selection, then toggle .grape back on
+	r := newResolver(strings.NewReader("1 2-3 9\n3\nd\n"), &out)
+	assert.Equal(t, []string{"/home/user/.grape", "/home/user/.fig"}, r.checklist(candidates, home))
+	assert.Contains(t, out.String(), "  2 [x] .config/lemon")
+	assert.Contains(t, out.String(), "invalid selection: 9")
+
+	// none, then all but .fig, selected by default
+	r = newResolver(strings.NewReader("n\na\n4\n\n"), &out)
+	assert.Equal(t, candidates[:3], r.checklist(candidates, home))
+
+	// quitting, or input ending, selects nothing
+	r = newResolver(strings.NewReader("q\n"), &out)
+	assert.Empty(t, r.checklist(candidates, home))
+
+	r = newResolver(strings.NewReader("1\n"), &out)
+	assert.Empty(t, r.checklist(candidates, home))
+	assert.True(t, r.closed)
+}
+
+func TestResolve(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	for _, name := range []string{".apple", ".lemon", ".grape", ".fig"} {
+		require.NoError(t, createPathWithContent(filepath.Join(home, name), "local "+name+"\n"))
+	}
+
+	item := func(name, diff string) ItemDiff {
+		return ItemDiff{
+			path:        filepath.Join(home, name),
+			homeRelPath: name,
+			diff:        diff,
+			local:       "local " + name + "\n",
+			remote:      createNote(name, "remote "+name+"\n"),
+		}
+	}
+
+	actions := syncActions{
+		push:        []ItemDiff{item(".apple", localNewer)},
+		pull:        []ItemDiff{item(".lemon", remoteNewer), item(".pear", localMissing)},
+		conflicting: []ItemDiff{item(".grape", conflict), item(".fig", conflict), {homeRelPath: ".plum", diff: conflict}},
+		trash:       []ItemDiff{item(".kiwi", remoteDeleted)},
+		identical:   []ItemDiff{item(".date", identical)},
+	}
+
+	var out bytes.Buffer
+
+	// .apple: default (keep local), .lemon: keep remote, .pear: invalid edit then skip,
+	// .grape: diff then edit, .fig: skip, .kiwi: skip
+	r := newResolver(strings.NewReader("\nr\ne\ns\nd\ne\ns\ns\n"), &out)
+	r.edit = func(path string) error {
+		return ioutil.WriteFile(path, []byte("merged grape\n"), 0o600)
+	}
+
+	resolved, err := r.resolve(actions)
+	require.NoError(t, err)
+
+	paths := func(items []ItemDiff) (res []string) {
+		for _, i := range items {
+			res = append(res, i.homeRelPath)
+		}
+
+		return res
+	}
+
+	assert.Equal(t, []string{".apple"}, paths(resolved.push))
+	assert.Equal(t, []string{".lemon"}, paths(resolved.pull))
+	assert.Equal(t, []string{".grape"}, paths(resolved.merged))
+	assert.Equal(t, "merged grape\n", resolved.merged[0].local)
+	// unresolved conflicts, including those that can't be resolved interactively, remain
+	assert.Equal(t, []string{".fig", ".plum"}, paths(resolved.conflicting))
+	assert.Empty(t, resolved.trash)
+	assert.Equal(t, actions.identical, resolved.identical)
+
+	assert.Contains(t, out.String(), "--- local/.grape\n+++ remote/.grape")
+	assert.Contains(t, out.String(), ".pear")
+	assert.NotContains(t, out.String(), ".plum")
+}
+
+func TestResolveKeepLocalPushesText(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	require.NoError(t, createPathWithContent(filepath.Join(home, ".grape"), "local grape\n"))
+
+	conflicting := ItemDiff{
+		path:        filepath.Join(home, ".grape"),
+		homeRelPath: ".grape",
+		diff:        conflict,
+		local:       "local grape\n",
+		localMode:   0o600,
+		remote:      createNote(".grape", "remote grape\n"),
+	}
+	modeOnly := ItemDiff{
+		homeRelPath: ".fig",
+		diff:        modeChanged,
+		local:       "fig\n",
+		localMode:   0o700,
+		remote:      createNote(".fig", "fig\n"),
+	}
+
+	var out bytes.Buffer
+
+	// .fig: default (keep local), .grape: keep local
+	r := newResolver(strings.NewReader("\nl\n"), &out)
+
+	resolved, err := r.resolve(syncActions{push: []ItemDiff{modeOnly}, conflicting: []ItemDiff{conflicting}})
+	require.NoError(t, err)
+	require.Len(t, resolved.push, 2)
+
+	preparePush(resolved.push)
+
+	for _, itemDiff := range resolved.push {
+		assert.Equal(t, itemDiff.local, itemDiff.remote.Content.GetText())
+		assert.Equal(t, modeString(itemDiff.localMode), getNoteMeta(itemDiff.remote).Mode)
+	}
+}
+
+func TestEditMerge(t *testing.T) {
+	itemDiff := ItemDiff{path: "/home/user/.apple", homeRelPath: ".apple", local: "local", remote: createNote(".apple", "remote\n")}
+
+	var edited string
+
+	r := newResolver(strings.NewReader(""), ioutil.Discard)
+	r.edit = func(path string) error {
+		b, err := ioutil.ReadFile(path)
+		edited = string(b)
+
+		return err
+	}
+
+	_, ok, err := r.editMerge(itemDiff)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, fmt.Sprintf("%s\nlocal\n%s\nremote\n%s\n", conflictMarkerLocal, conflictMarkerSep, conflictMarkerRemote), edited)
+
+	r.edit = func(path string) error {
+		return ioutil.WriteFile(path, []byte("local\nremote\n"), 0o600)
+	}
+
+	merged, ok, err := r.editMerge(itemDiff)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "local\nremote\n", merged)
+}
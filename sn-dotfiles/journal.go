@@ -0,0 +1,635 @@
+package sndotfiles
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/ryanuber/columnize"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	journalSideLocal  = "local"
+	journalSideRemote = "remote"
+
+	// maxJournalRuns is the number of runs kept in the journal, after which the oldest are forgotten
+	maxJournalRuns = 100
+)
+
+// dbLockTimeout is how long to wait for another process, such as the daemon, to release the cache db
+// a variable so it can be shortened in tests
+var dbLockTimeout = 5 * time.Second
+
+// journalRun is a single sync or merge that changed content, recorded so it can be undone
+type journalRun struct {
+	ID        int `storm:"id,increment"`
+	StartedAt time.Time
+	Undone    bool
+}
+
+// journalEntry records the content of one side of a path before and after it was changed by a run
+// along with the path's sync base beforehand, so the change can be reverted
+type journalEntry struct {
+	ID   int    `storm:"id,increment"`
+	Run  int    `storm:"index"`
+	Path string `storm:"index"`
+	// Side is the side changed, either local or remote
+	Side     string
+	Action   string
+	NoteUUID string
+	// BeforeExists is false if the path was created locally by the run
+	BeforeExists bool
+	Before       string
+	// BeforeMode is the local mode, or the note's metadata, before the run
+	BeforeMode string
+	After      string
+	// Deleted is true if the run removed the path on this side, leaving no content after
+	Deleted bool
+	Symlink bool
+	HadBase bool
+	Base    syncBase
+}
+
+// journal collects the changes made by a run
+type journal struct {
+	bases   syncBases
+	entries []journalEntry
+}
+
+func newJournal(bases syncBases) *journal {
+	return &journal{bases: bases}
+}
+
+// add records one side of an item about to be changed to after
+// it must be called before the item's note or local file is updated
+func (j *journal) add(itemDiff ItemDiff, side, action, after string) {
+	base, hadBase := j.bases[itemDiff.homeRelPath]
+
+	entry := journalEntry{
+		Path:     itemDiff.homeRelPath,
+		Side:     side,
+		Action:   action,
+		NoteUUID: itemDiff.remote.UUID,
+		After:    after,
+		Symlink:  itemDiff.symlink,
+		HadBase:  hadBase,
+		Base:     base,
+	}
+
+	if side == journalSideLocal {
+		// read again as the item's local content may have been replaced, e.g. by a merge
+		var mode os.FileMode
+
+		entry.Before, mode, entry.BeforeExists = readLocal(itemDiff.path)
+		if entry.BeforeExists && !itemDiff.symlink {
+			entry.BeforeMode = modeString(mode)
+		}
+	} else {
+		entry.BeforeExists = true
+		entry.Before = itemDiff.remote.Content.GetText()
+		entry.BeforeMode = itemDiff.remote.Content.PreviewPlain
+	}
+
+	j.entries = append(j.entries, entry)
+}
+
+// pushing records the remote side of items about to be pushed
+func (j *journal) pushing(itemDiffs []ItemDiff) {
+	for _, itemDiff := range itemDiffs {
+		j.add(itemDiff, journalSideRemote, ActionPushed, itemDiff.local)
+	}
+}
+
+// pulling records the local side of items about to be pulled
+func (j *journal) pulling(itemDiffs []ItemDiff) {
+	for _, itemDiff := range itemDiffs {
+		j.add(itemDiff, journalSideLocal, ActionPulled, itemDiff.remoteContent())
+	}
+}
+
+// deleting records one side of an item about to be removed
+func (j *journal) deleting(itemDiff ItemDiff, side, action string) {
+	j.add(itemDiff, side, action, "")
+	j.entries[len(j.entries)-1].Deleted = true
+}
+
+// removing records the remote side of items about to be removed, as deleted locally
+func (j *journal) removing(itemDiffs []ItemDiff) {
+	for _, itemDiff := range itemDiffs {
+		j.deleting(itemDiff, journalSideRemote, ActionRemoved)
+	}
+}
+
+// trashing records the local side of an item about to be moved to the trash, as deleted remotely
+func (j *journal) trashing(itemDiff ItemDiff) {
+	j.deleting(itemDiff, journalSideLocal, ActionTrashed)
+}
+
+// forget drops the local change recorded for a path that couldn't be written, so undo leaves it alone
+func (j *journal) forget(path string) {
+	entries := j.entries[:0]
+
+	for _, entry := range j.entries {
+		if entry.Path != path || entry.Side != journalSideLocal {
+			entries = append(entries, entry)
+		}
+	}
+
+	j.entries = entries
+}
+
+// merging records both sides of items about to be replaced by their merged local content
+func (j *journal) merging(itemDiffs []ItemDiff) {
+	for _, itemDiff := range itemDiffs {
+		j.add(itemDiff, journalSideRemote, ActionMerged, itemDiff.local)
+		j.add(itemDiff, journalSideLocal, ActionMerged, itemDiff.local)
+	}
+}
+
+// save records the run and its changes, if there were any, and forgets the oldest runs
+func (j *journal) save(db *storm.DB) error {
+	if j == nil || len(j.entries) == 0 {
+		return nil
+	}
+
+	run := journalRun{StartedAt: time.Now().UTC()}
+	if err := db.Save(&run); err != nil {
+		return err
+	}
+
+	for i := range j.entries {
+		j.entries[i].Run = run.ID
+		if err := db.Save(&j.entries[i]); err != nil {
+			return err
+		}
+	}
+
+	return pruneJournal(db, maxJournalRuns)
+}
+
+// pruneJournal forgets all but the most recent keep runs
+func pruneJournal(db *storm.DB, keep int) error {
+	var runs []journalRun
+
+	if err := db.All(&runs, storm.Reverse()); err != nil {
+		return err
+	}
+
+	if len(runs) <= keep {
+		return nil
+	}
+
+	for _, run := range runs[keep:] {
+		if err := db.Select(q.Eq("Run", run.ID)).Delete(&journalEntry{}); err != nil && !errors.Is(err, storm.ErrNotFound) {
+			return err
+		}
+
+		if err := db.DeleteStruct(&run); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lastJournalRun returns the most recent run that hasn't been undone
+func lastJournalRun(db *storm.DB) (run journalRun, found bool, err error) {
+	var runs []journalRun
+
+	if err = db.All(&runs, storm.Reverse()); err != nil {
+		return
+	}
+
+	for _, r := range runs {
+		if !r.Undone {
+			return r, true, nil
+		}
+	}
+
+	return
+}
+
+// readLocal returns the content and mode of a local path, or the target if it's a symlink
+// anything that can't be read is treated as missing
+func readLocal(path string) (content string, mode os.FileMode, exists bool) {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+
+	if stat.Mode()&os.ModeSymlink != 0 {
+		content, err = os.Readlink(path)
+
+		return content, stat.Mode(), err == nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+
+	return string(b), stat.Mode().Perm(), err == nil
+}
+
+type UndoInput struct {
+	Session *cache.Session
+	Home    string
+	Roots   *Roots
+	Debug   bool
+}
+
+type UndoOutput struct {
+	NoReverted int
+	Results    []Result
+	Msg        string
+}
+
+// Undo reverts the content changed on both sides by the most recent sync or merge that hasn't been undone
+// paths changed again since are left untouched, and local files are backed up before being reverted
+// files moved to the trash are restored untracked, while removed notes are reported but not restored
+func Undo(ui UndoInput, useStdErr bool) (uo UndoOutput, err error) {
+	roots := ui.Roots
+
+	var stop func()
+	if !ui.Debug {
+		stop = startSpinner(ui.Session, useStdErr)
+		defer func() {
+			stop()
+		}()
+
+		// the spinner would draw over the privilege helper asking for a password
+		roots = roots.withBeforeHelper(stop)
+	}
+
+	si := cache.SyncInput{
+		Session: ui.Session,
+		Close:   false,
+	}
+
+	var cso cache.SyncOutput
+
+	cso, err = cache.Sync(si)
+	if err != nil {
+		return
+	}
+
+	var reverted int
+
+	uo, reverted, err = undo(cso.DB, ui.Session, ui.Home, roots, ui.Debug)
+	if err != nil {
+		_ = cso.DB.Close()
+		return
+	}
+
+	if err = cso.DB.Close(); err != nil {
+		return
+	}
+
+	if reverted == 0 {
+		return
+	}
+
+	// push reverted notes
+	si.Close = true
+	_, err = cache.Sync(si)
+
+	return uo, err
+}
+
+func undo(db *storm.DB, session *cache.Session, home string, roots *Roots, debug bool) (uo UndoOutput, notesReverted int, err error) {
+	run, found, err := lastJournalRun(db)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		uo.Msg = fmt.Sprint(bold("nothing to undo"))
+		return
+	}
+
+	var entries []journalEntry
+
+	if err = db.Find("Run", run.ID, &entries); err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return
+	}
+
+	var twn tagsWithNotes
+
+	twn, err = getTagsWithNotes(db, session)
+	if err != nil {
+		return
+	}
+
+	notes := make(map[string]*gosn.Note)
+
+	for _, t := range twn {
+		for i := range t.notes {
+			notes[t.notes[i].UUID] = &t.notes[i]
+		}
+	}
+
+	var toPush gosn.Items
+
+	uo, toPush, err = revertRun(db, home, roots, backupDir(session), entries, notes, debug)
+	if err != nil {
+		return
+	}
+
+	if err = pruneBackups(session, maxBackups); err != nil {
+		return
+	}
+
+	if len(toPush) > 0 {
+		if err = cache.SaveItems(db, session, toPush, false); err != nil {
+			return
+		}
+	}
+
+	run.Undone = true
+	if err = db.Save(&run); err != nil {
+		return
+	}
+
+	return uo, len(toPush), err
+}
+
+// revertRun restores the content of both sides of each path changed by a run, along with its sync base,
+// returning the notes to push
+// paths with a side that no longer has the content the run left it with are left untouched
+func revertRun(db *storm.DB, home string, roots *Roots, backup string, entries []journalEntry, notes map[string]*gosn.Note,
+	debug bool) (uo UndoOutput, toPush gosn.Items, err error) {
+	// a path is only reverted if neither of its sides has changed since the run
+	changed := make(map[string]bool)
+
+	for _, entry := range entries {
+		var current string
+
+		switch {
+		case entry.Deleted && entry.Side == journalSideLocal:
+			// a file moved to the trash is only restored if nothing has replaced it
+			if pathExists(localPath(home, entry.Path, roots)) {
+				changed[entry.Path] = true
+			}
+
+			continue
+		case entry.Deleted:
+			continue
+		}
+
+		if entry.Side == journalSideLocal {
+			current, _, _ = readLocal(localPath(home, entry.Path, roots))
+		} else if note, ok := notes[entry.NoteUUID]; ok {
+			current = note.Content.GetText()
+		} else {
+			changed[entry.Path] = true
+			continue
+		}
+
+		if current != entry.After {
+			debugPrint(debug, fmt.Sprintf("revertRun | changed since: %s", entry.Path))
+			changed[entry.Path] = true
+		}
+	}
+
+	var lines []string
+
+	done := make(map[string]bool)
+
+	for _, entry := range entries {
+		if done[entry.Path] {
+			continue
+		}
+
+		if entry.Deleted && entry.Side == journalSideRemote {
+			// the note would only be removed again, as its file was deleted locally
+			done[entry.Path] = true
+
+			uo.Results = append(uo.Results, Result{Path: entry.Path, NoteUUID: entry.NoteUUID, Action: ActionNone,
+				Error: "removed remotely, add it again to restore it"})
+			lines = append(lines, fmt.Sprintf("%s | %s", bold(entry.Path), yellow("removed remotely, not reverted")))
+
+			continue
+		}
+
+		if changed[entry.Path] {
+			done[entry.Path] = true
+
+			uo.Results = append(uo.Results, Result{Path: entry.Path, NoteUUID: entry.NoteUUID, Action: ActionNone,
+				Error: "changed since last run"})
+			lines = append(lines, fmt.Sprintf("%s | %s", bold(entry.Path), yellow("changed since, not reverted")))
+
+			continue
+		}
+
+		for _, e := range entries {
+			if e.Path != entry.Path {
+				continue
+			}
+
+			if e.Side == journalSideLocal {
+				if err = revertLocal(e, home, roots, backup); err != nil {
+					return
+				}
+
+				continue
+			}
+
+			note := notes[e.NoteUUID]
+			note.Content.SetText(e.Before)
+			note.Content.PreviewPlain = e.BeforeMode
+			toPush = append(toPush, note)
+		}
+
+		// a file restored from the trash no longer has a note, so is left untracked
+		if entry.HadBase && !entry.Deleted {
+			base := entry.Base
+			err = db.Save(&base)
+		} else {
+			err = forgetSyncBases(db, []string{entry.Path})
+		}
+
+		if err != nil {
+			return
+		}
+
+		done[entry.Path] = true
+		uo.NoReverted++
+
+		uo.Results = append(uo.Results, Result{Path: entry.Path, NoteUUID: entry.NoteUUID, Action: ActionReverted})
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(entry.Path), green("reverted")))
+	}
+
+	sort.Slice(uo.Results, func(i, j int) bool {
+		return uo.Results[i].Path < uo.Results[j].Path
+	})
+	sort.Strings(lines)
+
+	uo.Msg = columnize.SimpleFormat(lines)
+
+	return uo, toPush, err
+}
+
+// revertLocal restores the local content recorded before a run, backing up the current content first
+func revertLocal(entry journalEntry, home string, roots *Roots, backup string) error {
+	path := localPath(home, entry.Path, roots)
+
+	if pathExists(path) {
+		if err := copyLocal(path, filepath.Join(backup, entry.Path), !entry.Symlink, roots); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", entry.Path, err)
+		}
+	}
+
+	if !entry.BeforeExists {
+		return removeLocal(path, roots)
+	}
+
+	if entry.Symlink {
+		return symlinkLocal(entry.Before, path, roots)
+	}
+
+	mode, modeFound := noteMeta{Mode: entry.BeforeMode}.fileMode()
+
+	return writeLocalFile(path, entry.Before, mode, modeFound, roots)
+}
+
+type HistoryInput struct {
+	Session *cache.Session
+	Home    string
+	Roots   *Roots
+	Path    string
+}
+
+// Version is the content of one side of a path as changed by a run
+type Version struct {
+	Run        int       `json:"run"`
+	Time       time.Time `json:"time"`
+	Side       string    `json:"side"`
+	Action     string    `json:"action"`
+	Undone     bool      `json:"undone,omitempty"`
+	BeforeHash string    `json:"before_hash,omitempty"`
+	// AfterHash is unset if the run removed the path on this side
+	AfterHash string `json:"after_hash,omitempty"`
+}
+
+type HistoryOutput struct {
+	Versions []Version
+	Msg      string
+}
+
+// History returns the changes recorded in the journal for a path, most recent first
+func History(hi HistoryInput) (ho HistoryOutput, err error) {
+	path := hi.Path
+	if filepath.IsAbs(path) {
+		path = stripHome(path, hi.Home, hi.Roots)
+	}
+
+	path = filepath.Clean(path)
+
+	if _, err = os.Stat(hi.Session.CacheDBPath); os.IsNotExist(err) {
+		return ho, errors.New("no history recorded")
+	}
+
+	var db *storm.DB
+
+	db, err = openDB(hi.Session.CacheDBPath)
+	if err != nil {
+		return
+	}
+
+	defer db.Close()
+
+	ho.Versions, err = history(db, path)
+	if err != nil {
+		return
+	}
+
+	if len(ho.Versions) == 0 {
+		ho.Msg = fmt.Sprintf("no history recorded for %s", path)
+
+		return
+	}
+
+	lines := []string{bold("run | time | side | action | content")}
+
+	for _, v := range ho.Versions {
+		action := v.Action
+		if v.Undone {
+			action += " (undone)"
+		}
+
+		before := "(none)"
+		if v.BeforeHash != "" {
+			before = v.BeforeHash[:8]
+		}
+
+		after := "(none)"
+		if v.AfterHash != "" {
+			after = v.AfterHash[:8]
+		}
+
+		lines = append(lines, fmt.Sprintf("%d | %s | %s | %s | %s -> %s", v.Run,
+			v.Time.Local().Format("2006-01-02 15:04:05"), v.Side, action, before, after))
+	}
+
+	ho.Msg = columnize.SimpleFormat(lines)
+
+	return ho, err
+}
+
+// openDB opens the cache db, giving up if another process holds it for longer than dbLockTimeout
+func openDB(path string) (*storm.DB, error) {
+	db, err := storm.Open(path, storm.BoltOptions(0o600, &bolt.Options{Timeout: dbLockTimeout}))
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("database locked: %s is in use by another sn-dotfiles process, such as daemon or watch", path)
+	}
+
+	return db, err
+}
+
+func history(db *storm.DB, path string) (versions []Version, err error) {
+	var entries []journalEntry
+
+	if err = db.Find("Path", path, &entries); err != nil {
+		if errors.Is(err, storm.ErrNotFound) {
+			err = nil
+		}
+
+		return
+	}
+
+	for _, entry := range entries {
+		var run journalRun
+		if err = db.One("ID", entry.Run, &run); err != nil {
+			return
+		}
+
+		v := Version{
+			Run:    run.ID,
+			Time:   run.StartedAt,
+			Side:   entry.Side,
+			Action: entry.Action,
+			Undone: run.Undone,
+		}
+
+		if !entry.Deleted {
+			v.AfterHash = hashContent(entry.After)
+		}
+
+		if entry.BeforeExists {
+			v.BeforeHash = hashContent(entry.Before)
+		}
+
+		versions = append(versions, v)
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Run > versions[j].Run
+	})
+
+	return versions, err
+}
@@ -0,0 +1,267 @@
+package sndotfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestJournalDB(t *testing.T, home string) *storm.DB {
+	require.NoError(t, os.MkdirAll(home, 0o700))
+
+	db, err := storm.Open(filepath.Join(home, "test.db"))
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestJournalHistory(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	db := openTestJournalDB(t, home)
+
+	defer db.Close()
+
+	applePath := filepath.Join(home, ".apple")
+	require.NoError(t, createPathWithContent(applePath, "apple content"))
+
+	appleNote := createNote("apple", "new apple content")
+	appleDiff := ItemDiff{path: applePath, homeRelPath: ".apple", local: "apple content", remote: appleNote}
+
+	jrnl := newJournal(syncBases{".apple": {Path: ".apple", NoteUUID: appleNote.UUID, Hash: hashContent("apple content")}})
+	jrnl.pulling([]ItemDiff{appleDiff})
+	require.NoError(t, jrnl.save(db))
+
+	// nothing is recorded for runs that change nothing
+	require.NoError(t, newJournal(nil).save(db))
+
+	jrnl = newJournal(nil)
+	appleDiff.local = "newer apple content"
+	jrnl.pushing([]ItemDiff{appleDiff})
+	require.NoError(t, jrnl.save(db))
+
+	versions, err := history(db, ".apple")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+
+	assert.Equal(t, journalSideRemote, versions[0].Side)
+	assert.Equal(t, ActionPushed, versions[0].Action)
+	assert.Equal(t, hashContent("newer apple content"), versions[0].AfterHash)
+
+	assert.Equal(t, journalSideLocal, versions[1].Side)
+	assert.Equal(t, ActionPulled, versions[1].Action)
+	assert.Equal(t, hashContent("apple content"), versions[1].BeforeHash)
+	assert.Equal(t, hashContent("new apple content"), versions[1].AfterHash)
+
+	versions, err = history(db, ".lemon")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+
+	// only the most recent runs are kept
+	require.NoError(t, pruneJournal(db, 1))
+
+	versions, err = history(db, ".apple")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, ActionPushed, versions[0].Action)
+}
+
+func TestRevertRun(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	db := openTestJournalDB(t, home)
+
+	defer db.Close()
+
+	applePath := filepath.Join(home, ".apple")
+	figPath := filepath.Join(home, ".fig")
+	require.NoError(t, createPathWithContent(applePath, "old apple content"))
+	require.NoError(t, os.Chmod(applePath, 0o600))
+	require.NoError(t, createPathWithContent(figPath, "old fig content"))
+
+	appleNote := createNote("apple", "new apple content")
+	lemonNote := createNote("lemon", "old lemon content")
+	figNote := createNote("fig", "new fig content")
+
+	appleBase := syncBase{Path: ".apple", NoteUUID: appleNote.UUID, Hash: hashContent("old apple content")}
+
+	jrnl := newJournal(syncBases{".apple": appleBase})
+	jrnl.pulling([]ItemDiff{
+		{path: applePath, homeRelPath: ".apple", remote: appleNote},
+		{path: figPath, homeRelPath: ".fig", remote: figNote},
+	})
+	jrnl.pushing([]ItemDiff{
+		{path: filepath.Join(home, ".lemon"), homeRelPath: ".lemon", local: "new lemon content", remote: lemonNote},
+	})
+
+	// make the changes the run would have made, then change .fig again since
+	require.NoError(t, createLocal([]ItemDiff{{path: applePath, homeRelPath: ".apple", remote: appleNote}}, "", nil))
+	require.NoError(t, createPathWithContent(figPath, "newest fig content"))
+	lemonNote.Content.SetText("new lemon content")
+
+	require.NoError(t, recordSyncBases(db, []ItemDiff{{path: applePath, homeRelPath: ".apple", remote: appleNote}}))
+
+	notes := map[string]*gosn.Note{
+		appleNote.UUID: &appleNote,
+		lemonNote.UUID: &lemonNote,
+		figNote.UUID:   &figNote,
+	}
+
+	backup := filepath.Join(home, BackupDirName, timestampNow())
+
+	uo, toPush, err := revertRun(db, home, nil, backup, jrnl.entries, notes, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, uo.NoReverted)
+	require.Len(t, uo.Results, 3)
+	assert.Equal(t, Result{Path: ".apple", NoteUUID: appleNote.UUID, Action: ActionReverted}, uo.Results[0])
+	assert.Equal(t, ActionNone, uo.Results[1].Action)
+	assert.Equal(t, ".fig", uo.Results[1].Path)
+
+	// local content and mode are restored, and the overwritten content backed up
+	content, err := ioutil.ReadFile(applePath)
+	require.NoError(t, err)
+	assert.Equal(t, "old apple content", string(content))
+
+	stat, err := os.Stat(applePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+	content, err = ioutil.ReadFile(filepath.Join(backup, ".apple"))
+	require.NoError(t, err)
+	assert.Equal(t, "new apple content", string(content))
+
+	// the base from before the run is restored
+	bases, err := loadSyncBases(db)
+	require.NoError(t, err)
+	assert.Equal(t, appleBase.Hash, bases[".apple"].Hash)
+
+	// remote content is reverted, ready to push
+	require.Len(t, toPush, 1)
+	assert.Equal(t, "old lemon content", lemonNote.Content.GetText())
+
+	// paths changed since are untouched
+	content, err = ioutil.ReadFile(figPath)
+	require.NoError(t, err)
+	assert.Equal(t, "newest fig content", string(content))
+}
+
+func TestRevertRunDeletions(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	db := openTestJournalDB(t, home)
+
+	defer db.Close()
+
+	kiwiPath := filepath.Join(home, ".kiwi")
+	datePath := filepath.Join(home, ".date")
+	require.NoError(t, createPathWithContent(kiwiPath, "kiwi content"))
+	require.NoError(t, createPathWithContent(datePath, "date content"))
+
+	kiwiNote := createNote("kiwi", "kiwi content")
+	plumNote := createNote("plum", "plum content")
+
+	bases := syncBases{
+		".kiwi": {Path: ".kiwi", NoteUUID: kiwiNote.UUID, Hash: hashContent("kiwi content")},
+		".plum": {Path: ".plum", NoteUUID: plumNote.UUID, Hash: hashContent("plum content")},
+	}
+
+	// a run only deleting is still recorded, so undo reverts it rather than the run before
+	jrnl := newJournal(bases)
+	jrnl.removing([]ItemDiff{{path: filepath.Join(home, ".plum"), homeRelPath: ".plum", remote: plumNote}})
+	jrnl.trashing(ItemDiff{path: kiwiPath, homeRelPath: ".kiwi", remote: kiwiNote})
+	jrnl.trashing(ItemDiff{path: datePath, homeRelPath: ".date"})
+	require.NoError(t, jrnl.save(db))
+
+	run, found, err := lastJournalRun(db)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	var entries []journalEntry
+
+	require.NoError(t, db.Find("Run", run.ID, &entries))
+	require.Len(t, entries, 3)
+
+	// make the changes the run would have made, then replace .date since
+	trash := filepath.Join(home, TrashDirName)
+	require.NoError(t, moveToTrash(kiwiPath, home, nil, trash))
+	require.NoError(t, moveToTrash(datePath, home, nil, trash))
+	require.NoError(t, createPathWithContent(datePath, "new date content"))
+	require.NoError(t, forgetSyncBases(db, []string{".kiwi", ".plum"}))
+
+	versions, err := history(db, ".kiwi")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, ActionTrashed, versions[0].Action)
+	assert.Equal(t, hashContent("kiwi content"), versions[0].BeforeHash)
+	assert.Empty(t, versions[0].AfterHash)
+
+	backup := filepath.Join(home, BackupDirName, timestampNow())
+
+	uo, toPush, err := revertRun(db, home, nil, backup, entries, map[string]*gosn.Note{}, true)
+	require.NoError(t, err)
+	assert.Empty(t, toPush)
+	assert.Equal(t, 1, uo.NoReverted)
+	require.Len(t, uo.Results, 3)
+
+	// the file moved to the trash is restored, but left untracked as its note is gone
+	assert.Equal(t, Result{Path: ".kiwi", NoteUUID: kiwiNote.UUID, Action: ActionReverted}, uo.Results[1])
+
+	content, err := ioutil.ReadFile(kiwiPath)
+	require.NoError(t, err)
+	assert.Equal(t, "kiwi content", string(content))
+
+	bases, err = loadSyncBases(db)
+	require.NoError(t, err)
+	assert.Empty(t, bases)
+
+	// a file replaced since is left alone
+	assert.Equal(t, ".date", uo.Results[0].Path)
+	assert.Equal(t, ActionNone, uo.Results[0].Action)
+
+	content, err = ioutil.ReadFile(datePath)
+	require.NoError(t, err)
+	assert.Equal(t, "new date content", string(content))
+
+	// a remote removal isn't reverted, as the next sync would only remove it again
+	assert.Equal(t, ".plum", uo.Results[2].Path)
+	assert.Equal(t, ActionNone, uo.Results[2].Action)
+	assert.NotEmpty(t, uo.Results[2].Error)
+}
+
+func TestHistoryLocked(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	// held open as by the daemon
+	db := openTestJournalDB(t, home)
+
+	defer db.Close()
+
+	timeout := dbLockTimeout
+	dbLockTimeout = 100 * time.Millisecond
+
+	defer func() { dbLockTimeout = timeout }()
+
+	_, err := History(HistoryInput{
+		Session: &cache.Session{CacheDBPath: filepath.Join(home, "test.db")},
+		Home:    home,
+		Path:    ".apple",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database locked")
+}
@@ -31,6 +31,7 @@ var (
 	red    = color.New(color.FgRed).SprintFunc()
 	green  = color.New(color.FgGreen).SprintFunc()
 	yellow = color.New(color.FgYellow).SprintFunc()
+	cyan   = color.New(color.FgCyan).SprintFunc()
 )
 
 func getTagsWithNotes(db *storm.DB, session *cache.Session) (t tagsWithNotes, err error) {
@@ -54,16 +55,16 @@ func getTagsWithNotes(db *storm.DB, session *cache.Session) (t tagsWithNotes, er
 		return
 	}
 
-	var dotfileTags gosn.Tags
+	var allTags gosn.Tags
 
 	var notes gosn.Notes
 
 	r := regexp.MustCompile(fmt.Sprintf("%s.?.*", DotFilesTag))
 
 	for _, item := range items {
-		if item.GetContent() != nil && item.GetContentType() == "Tag" && r.MatchString(item.GetContent().(*gosn.TagContent).Title) {
+		if item.GetContent() != nil && item.GetContentType() == "Tag" {
 			tt := item.(*gosn.Tag)
-			dotfileTags = append(dotfileTags, *tt)
+			allTags = append(allTags, *tt)
 		}
 
 		if item.GetContentType() == "Note" && item.GetContent() != nil {
@@ -72,9 +73,17 @@ func getTagsWithNotes(db *storm.DB, session *cache.Session) (t tagsWithNotes, er
 		}
 	}
 
-	for _, dotfileTag := range dotfileTags {
+	fullTitles := getFullTagTitles(allTags)
+
+	for _, dotfileTag := range allTags {
+		fullTitle := fullTitles[dotfileTag.UUID]
+		if !r.MatchString(fullTitle) {
+			continue
+		}
+
 		twn := tagWithNotes{
-			tag: dotfileTag,
+			tag:       dotfileTag,
+			fullTitle: fullTitle,
 		}
 
 		for _, note := range notes {
@@ -100,10 +109,68 @@ func getItemNoteRefIds(itemRefs gosn.ItemReferences) (refIds []string) {
 	return refIds
 }
 
+// getItemParentTagRefID returns the UUID of the parent tag referenced by a nested tag
+func getItemParentTagRefID(itemRefs gosn.ItemReferences) string {
+	for _, ir := range itemRefs {
+		if ir.ContentType == "Tag" {
+			return ir.UUID
+		}
+	}
+
+	return ""
+}
+
+// getFullTagTitles returns a map of tag UUIDs to the titles they represent, where the
+// title of a nested tag is prefixed by the full titles of its parents
+func getFullTagTitles(tags gosn.Tags) map[string]string {
+	tagsByUUID := make(map[string]gosn.Tag, len(tags))
+	for _, t := range tags {
+		tagsByUUID[t.UUID] = t
+	}
+
+	fullTitles := make(map[string]string, len(tags))
+
+	var fullTitle func(tag gosn.Tag, seen []string) string
+
+	fullTitle = func(tag gosn.Tag, seen []string) string {
+		if ft, found := fullTitles[tag.UUID]; found {
+			return ft
+		}
+
+		parent, found := tagsByUUID[getItemParentTagRefID(tag.Content.References())]
+		if !found || StringInSlice(parent.UUID, seen, true) {
+			return tag.Content.GetTitle()
+		}
+
+		return fullTitle(parent, append(seen, tag.UUID)) + "." + escapeTagTitlePart(tag.Content.GetTitle())
+	}
+
+	for _, t := range tags {
+		fullTitles[t.UUID] = fullTitle(t, nil)
+	}
+
+	return fullTitles
+}
+
 //
 type tagWithNotes struct {
-	tag   gosn.Tag
-	notes gosn.Notes
+	tag       gosn.Tag
+	fullTitle string
+	notes     gosn.Notes
+}
+
+// title returns the tag's title, including the titles of any parents if nested
+func (t tagWithNotes) title() string {
+	if t.fullTitle != "" {
+		return t.fullTitle
+	}
+
+	return t.tag.Content.GetTitle()
+}
+
+// nested returns true if the tag is the child of another tag
+func (t tagWithNotes) nested() bool {
+	return t.title() != t.tag.Content.GetTitle()
 }
 
 type tagsWithNotes []tagWithNotes
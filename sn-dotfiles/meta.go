@@ -0,0 +1,79 @@
+package sndotfiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jonhadfield/gosn-v2"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// noteMetaPrefix identifies note metadata written by sn-dotfiles
+// gosn only persists the standard notes keys of a note's app data, so metadata is
+// stored in the note's plain text preview instead
+// SN apps replace the preview when a note is edited in them, so the metadata is lost until the
+// dotfile is next pushed, and until then pulls keep the local file's mode and mode drift isn't reported
+const noteMetaPrefix = "sn-dotfiles:"
+
+// noteMeta defines the file attributes recorded alongside a note's content
+type noteMeta struct {
+	Mode     string `json:"mode,omitempty"`
+	Symlink  bool   `json:"symlink,omitempty"`
+	Template bool   `json:"template,omitempty"`
+}
+
+// getNoteMeta returns the metadata recorded for a note, or empty metadata if none
+// was recorded or it has since been replaced, e.g. by editing the note in an SN app
+func getNoteMeta(note gosn.Note) (meta noteMeta) {
+	preview := note.Content.PreviewPlain
+	if !strings.HasPrefix(preview, noteMetaPrefix) {
+		return
+	}
+
+	if err := json.Unmarshal([]byte(preview[len(noteMetaPrefix):]), &meta); err != nil {
+		return noteMeta{}
+	}
+
+	return
+}
+
+func setNoteMeta(note *gosn.Note, meta noteMeta) {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	note.Content.PreviewPlain = noteMetaPrefix + string(b)
+}
+
+func (m noteMeta) fileMode() (mode os.FileMode, found bool) {
+	if m.Mode == "" {
+		return
+	}
+
+	p, err := strconv.ParseUint(m.Mode, 8, 32)
+	if err != nil {
+		return
+	}
+
+	return os.FileMode(p).Perm(), true
+}
+
+func modeString(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// setNoteMode records the permissions of a local file against its note
+func setNoteMode(note *gosn.Note, mode os.FileMode) {
+	meta := getNoteMeta(*note)
+	meta.Mode = modeString(mode)
+	setNoteMeta(note, meta)
+}
+
+// noteModeDiffers returns true if the note has a recorded mode that does not match the local mode
+func noteModeDiffers(note gosn.Note, localMode os.FileMode) bool {
+	mode, found := getNoteMeta(note).fileMode()
+
+	return found && mode != localMode.Perm()
+}
@@ -0,0 +1,28 @@
+package sndotfiles
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoteMeta(t *testing.T) {
+	note := createNote("apple", "apple content")
+	// note without metadata
+	assert.Equal(t, noteMeta{}, getNoteMeta(note))
+	assert.False(t, noteModeDiffers(note, 0600))
+
+	// note with preview replaced by an app
+	note.Content.PreviewPlain = "apple content"
+	assert.Equal(t, noteMeta{}, getNoteMeta(note))
+
+	setNoteMode(&note, 0755|os.ModeDir)
+	assert.Equal(t, "0755", getNoteMeta(note).Mode)
+
+	mode, found := getNoteMeta(note).fileMode()
+	assert.True(t, found)
+	assert.Equal(t, os.FileMode(0755), mode)
+	assert.True(t, noteModeDiffers(note, 0644))
+	assert.False(t, noteModeDiffers(note, 0755))
+}
@@ -0,0 +1,294 @@
+package sndotfiles
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/ryanuber/columnize"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type MigrateTagsInput struct {
+	Session *cache.Session
+	Home    string
+	Roots   *Roots
+	Debug   bool
+}
+
+type MigrateTagsOutput struct {
+	TagsMigrated, TagsRemoved int
+	Ambiguous                 []string
+	Msg                       string
+}
+
+// MigrateTags rewrites tags created before periods in directory names were escaped,
+// using the local filesystem to determine which periods were part of a directory name
+func MigrateTags(mi MigrateTagsInput, useStdErr bool) (mo MigrateTagsOutput, err error) {
+	if !mi.Session.Valid() {
+		err = errors.New("invalid session")
+		return
+	}
+
+	if mi.Home == "" {
+		err = errors.New("home undefined")
+		return
+	}
+
+	if !mi.Debug {
+		stop := startSpinner(mi.Session, useStdErr)
+		defer stop()
+	}
+
+	// get populated db
+	si := cache.SyncInput{
+		Session: mi.Session,
+		Close:   false,
+	}
+
+	var cso cache.SyncOutput
+
+	cso, err = cache.Sync(si)
+	if err != nil {
+		return
+	}
+
+	var twn tagsWithNotes
+
+	twn, err = getTagsWithNotes(cso.DB, mi.Session)
+	if err != nil {
+		return
+	}
+
+	plan := planTagMigration(twn, mi.Home, mi.Roots, mi.Debug)
+
+	var results []string
+
+	var itemsToSave gosn.Items
+
+	for _, t := range twn {
+		oldTitle := t.title()
+		tag := t.tag
+
+		if newTitle, found := plan.renames[oldTitle]; found {
+			tag.Content.SetTitle(newTitle)
+			itemsToSave = append(itemsToSave, &tag)
+			results = append(results, fmt.Sprintf("%s | %s %s", bold(oldTitle), green("migrated to"), bold(newTitle)))
+			mo.TagsMigrated++
+
+			continue
+		}
+
+		if StringInSlice(oldTitle, plan.removals, true) {
+			tag.SetDeleted(true)
+			itemsToSave = append(itemsToSave, &tag)
+			results = append(results, fmt.Sprintf("%s | %s", bold(oldTitle), green("removed")))
+			mo.TagsRemoved++
+		}
+	}
+
+	for _, a := range plan.ambiguous {
+		results = append(results, fmt.Sprintf("%s | %s", bold(a), yellow("ambiguous")))
+	}
+
+	mo.Ambiguous = plan.ambiguous
+
+	if len(itemsToSave) == 0 {
+		if err = cso.DB.Close(); err != nil {
+			return
+		}
+
+		mo.Msg = fmt.Sprint(bold("nothing to do"))
+		if len(results) > 0 {
+			mo.Msg = fmt.Sprint(columnize.SimpleFormat(results))
+		}
+
+		return
+	}
+
+	if err = cache.SaveItems(cso.DB, mi.Session, itemsToSave, true); err != nil {
+		return
+	}
+
+	// sync changes back to SN
+	si.Close = true
+
+	_, err = cache.Sync(si)
+	if err != nil {
+		return
+	}
+
+	mo.Msg = fmt.Sprint(columnize.SimpleFormat(results))
+
+	return mo, err
+}
+
+type tagMigrationPlan struct {
+	renames   map[string]string
+	removals  []string
+	ambiguous []string
+}
+
+// planTagMigration finds tags with titles that were generated from directory names containing periods
+// and determines their new titles, along with any tags that were only created as a consequence of the
+// ambiguity, and those tags for which more than one matching local directory exists
+// tags in a root that isn't set are left alone, as there's nothing local to check them against
+func planTagMigration(twn tagsWithNotes, home string, roots *Roots, debug bool) (plan tagMigrationPlan) {
+	plan.renames = make(map[string]string)
+
+	existing := make(map[string]bool)
+	for _, t := range twn {
+		existing[t.title()] = true
+	}
+
+	for _, t := range twn {
+		// nested tags hold a single directory name so are never ambiguous
+		if t.nested() {
+			continue
+		}
+
+		title := t.title()
+
+		groupings := legacyTagTitleGroupings(title, home, roots)
+		if len(groupings) == 0 {
+			continue
+		}
+
+		if len(groupings) > 1 {
+			debugPrint(debug, fmt.Sprintf("planTagMigration | %s matches %d local dirs", title, len(groupings)))
+			plan.ambiguous = append(plan.ambiguous, title)
+
+			continue
+		}
+
+		newTitle := pathToTag(filepath.Join(groupings[0]...))
+		if newTitle == title {
+			continue
+		}
+
+		if existing[newTitle] {
+			debugPrint(debug, fmt.Sprintf("planTagMigration | %s would duplicate %s", title, newTitle))
+			plan.ambiguous = append(plan.ambiguous, title)
+
+			continue
+		}
+
+		debugPrint(debug, fmt.Sprintf("planTagMigration | %s becomes %s", title, newTitle))
+		plan.renames[title] = newTitle
+	}
+
+	// find the titles all tags will have once migrated
+	var newTitles []string
+
+	for _, t := range twn {
+		title := t.title()
+		if newTitle, found := plan.renames[title]; found {
+			title = newTitle
+		}
+
+		newTitles = append(newTitles, title)
+	}
+
+	// remove tags created for the parts of a directory name either side of a period
+	// as long as they have no notes and no longer have children
+	for oldTitle := range plan.renames {
+		legacyParts := strings.Split(oldTitle, ".")
+		for x := 2; x < len(legacyParts); x++ {
+			candidate := strings.Join(legacyParts[:x], ".")
+			if _, renamed := plan.renames[candidate]; renamed || !existing[candidate] || StringInSlice(candidate, plan.removals, true) {
+				continue
+			}
+
+			if tagHasNotes(candidate, twn) || tagHasChildren(candidate, newTitles) {
+				continue
+			}
+
+			plan.removals = append(plan.removals, candidate)
+		}
+	}
+
+	sort.Strings(plan.removals)
+	sort.Strings(plan.ambiguous)
+
+	return plan
+}
+
+// legacyTagTitleGroupings returns each way of grouping the period separated parts of an unescaped
+// tag title into directory names, such that every directory exists locally
+// the first part of a tag in a root, e.g. root:etc, names the root so is never grouped
+func legacyTagTitleGroupings(title, home string, roots *Roots) (groupings [][]string) {
+	if strings.Contains(title, `\`) || !strings.HasPrefix(title, DotFilesTag+".") {
+		return
+	}
+
+	parts := strings.Split(title, ".")[1:]
+
+	var walk func(dir string, idx int, acc []string)
+
+	walk = func(dir string, idx int, acc []string) {
+		if idx == len(parts) {
+			groupings = append(groupings, append([]string{}, acc...))
+			return
+		}
+
+		for end := idx + 1; end <= len(parts); end++ {
+			component := strings.Join(parts[idx:end], ".")
+			if idx == 0 {
+				component = addDot(component)
+			}
+
+			p := filepath.Join(dir, component)
+			if pathType, _ := getPathType(p); pathType == "dir" {
+				walk(p, end, append(acc, component))
+			}
+		}
+	}
+
+	if strings.HasPrefix(parts[0], RootPrefix) {
+		dir, ok := roots.dir(parts[0])
+		if !ok {
+			return nil
+		}
+
+		walk(dir, 1, []string{parts[0]})
+
+		return groupings
+	}
+
+	walk(home, 0, nil)
+
+	return groupings
+}
+
+// tagsNeedingMigration returns the titles of tags that can be migrated without ambiguity
+func tagsNeedingMigration(twn tagsWithNotes, home string, roots *Roots) (titles []string) {
+	for oldTitle := range planTagMigration(twn, home, roots, false).renames {
+		titles = append(titles, oldTitle)
+	}
+
+	sort.Strings(titles)
+
+	return titles
+}
+
+func tagHasNotes(title string, twn tagsWithNotes) bool {
+	for _, t := range twn {
+		if t.title() == title && len(t.notes) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tagHasChildren(title string, titles []string) bool {
+	for _, t := range titles {
+		if strings.HasPrefix(t, title+".") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanTagMigration(t *testing.T) {
+	home := getTemporaryHome()
+	require.NoError(t, os.MkdirAll(fmt.Sprintf("%s/.config/foo.d/bar", home), os.ModePerm))
+	require.NoError(t, os.MkdirAll(fmt.Sprintf("%s/.config/nvim", home), os.ModePerm))
+	require.NoError(t, os.MkdirAll(fmt.Sprintf("%s/.ambiguous/a.b", home), os.ModePerm))
+	require.NoError(t, os.MkdirAll(fmt.Sprintf("%s/.ambiguous/a/b", home), os.ModePerm))
+
+	barNote := createNote("bar.conf", "bar content")
+	initNote := createNote("init.vim", "init content")
+	abNote := createNote("ab", "ab content")
+
+	// tags as created before directory names were escaped
+	twn := tagsWithNotes{
+		tagWithNotes{tag: createTag(DotFilesTag)},
+		tagWithNotes{tag: createTag("dotfiles.config")},
+		tagWithNotes{tag: createTag("dotfiles.config.foo")},
+		tagWithNotes{tag: createTag("dotfiles.config.foo.d")},
+		tagWithNotes{tag: createTag("dotfiles.config.foo.d.bar"), notes: gosn.Notes{barNote}},
+		tagWithNotes{tag: createTag("dotfiles.config.nvim"), notes: gosn.Notes{initNote}},
+		tagWithNotes{tag: createTag("dotfiles.ambiguous.a.b"), notes: gosn.Notes{abNote}},
+	}
+
+	plan := planTagMigration(twn, home, nil, true)
+	assert.Len(t, plan.renames, 2)
+	assert.Equal(t, `dotfiles.config.foo\.d`, plan.renames["dotfiles.config.foo.d"])
+	assert.Equal(t, `dotfiles.config.foo\.d.bar`, plan.renames["dotfiles.config.foo.d.bar"])
+	assert.Equal(t, []string{"dotfiles.config.foo"}, plan.removals)
+	assert.Equal(t, []string{"dotfiles.ambiguous.a.b"}, plan.ambiguous)
+
+	assert.Equal(t, []string{"dotfiles.config.foo.d", "dotfiles.config.foo.d.bar"}, tagsNeedingMigration(twn, home, nil))
+}
+
+func TestPlanTagMigrationRoot(t *testing.T) {
+	home := getTemporaryHome()
+	etc := fmt.Sprintf("%s-etc", home)
+	require.NoError(t, os.MkdirAll(fmt.Sprintf("%s/nginx/conf.d", etc), os.ModePerm))
+
+	roots, err := NewRoots(map[string]string{"etc": etc}, "")
+	require.NoError(t, err)
+
+	twn := tagsWithNotes{
+		tagWithNotes{tag: createTag("dotfiles.root:etc")},
+		tagWithNotes{tag: createTag("dotfiles.root:etc.nginx")},
+		tagWithNotes{tag: createTag("dotfiles.root:etc.nginx.conf")},
+		tagWithNotes{tag: createTag("dotfiles.root:etc.nginx.conf.d"), notes: gosn.Notes{createNote("site.conf", "site")}},
+	}
+
+	// the name of the root is never grouped with the directory names that follow it
+	plan := planTagMigration(twn, home, roots, true)
+	assert.Equal(t, map[string]string{"dotfiles.root:etc.nginx.conf.d": `dotfiles.root:etc.nginx.conf\.d`}, plan.renames)
+	assert.Equal(t, []string{"dotfiles.root:etc.nginx.conf"}, plan.removals)
+	assert.Empty(t, plan.ambiguous)
+
+	// without the root set there's nothing local to check the tags against, so they're left alone
+	plan = planTagMigration(twn, home, nil, true)
+	assert.Empty(t, plan.renames)
+	assert.Empty(t, plan.removals)
+}
@@ -0,0 +1,279 @@
+package sndotfiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	planVersion = 1
+
+	planActionPush   = "push"
+	planActionPull   = "pull"
+	planActionRemove = "remove"
+	planActionTrash  = "trash"
+)
+
+// SyncPlan records the changes a sync would make, along with the state of each item they were
+// determined from, so they can be reviewed before being applied
+type SyncPlan struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	Home      string       `json:"home"`
+	Paths     []string     `json:"paths,omitempty"`
+	Exclude   []string     `json:"exclude,omitempty"`
+	Actions   []PlanAction `json:"actions"`
+}
+
+// PlanAction is a single planned change to a path, relative to home
+type PlanAction struct {
+	Path       string `json:"path"`
+	Action     string `json:"action"`
+	Diff       string `json:"diff"`
+	NoteUUID   string `json:"note_uuid,omitempty"`
+	RemoteHash string `json:"remote_hash,omitempty"`
+	LocalHash  string `json:"local_hash,omitempty"`
+	LocalMode  string `json:"local_mode,omitempty"`
+}
+
+type PlanInput struct {
+	Session        *cache.Session
+	Home           string
+	Roots          *Roots
+	Paths, Exclude []string
+	TemplateVars   map[string]string
+	Debug          bool
+}
+
+type PlanOutput struct {
+	Plan SyncPlan
+	Msg  string
+}
+
+type ApplyInput struct {
+	Session      *cache.Session
+	Home         string
+	Roots        *Roots
+	Plan         SyncPlan
+	TemplateVars map[string]string
+	Debug        bool
+	// Progress, if set, is called with the result for each path as its change is made, so results can be streamed
+	Progress func(Result)
+}
+
+// Plan compares local and remote items, as Sync does, and returns the changes a sync would make as a plan
+func Plan(pi PlanInput, useStdErr bool) (po PlanOutput, err error) {
+	if err = checkPathsExist(pi.Exclude); err != nil {
+		return
+	}
+
+	if !pi.Debug {
+		stop := startSpinner(pi.Session, useStdErr)
+		defer stop()
+	}
+
+	output, err := sync(syncInput{
+		session:      pi.Session,
+		home:         pi.Home,
+		roots:        pi.Roots,
+		paths:        pi.Paths,
+		exclude:      pi.Exclude,
+		templateVars: pi.TemplateVars,
+		debug:        pi.Debug,
+		makePlan:     true,
+	})
+	if err != nil {
+		return
+	}
+
+	output.plan.Paths = pi.Paths
+	output.plan.Exclude = pi.Exclude
+
+	return PlanOutput{
+		Plan: output.plan,
+		Msg:  output.msg,
+	}, err
+}
+
+// Apply makes the changes recorded in a plan, and no others
+// nothing is changed if any planned item has changed locally or remotely since the plan was made
+func Apply(ai ApplyInput, useStdErr bool) (so SyncOutput, err error) {
+	if ai.Plan.Version != planVersion {
+		err = fmt.Errorf("unsupported plan version: %d", ai.Plan.Version)
+		return
+	}
+
+	roots := ai.Roots
+
+	if !ai.Debug {
+		stop := startSpinner(ai.Session, useStdErr)
+		defer stop()
+
+		// the spinner would draw over the privilege helper asking for a password
+		roots = roots.withBeforeHelper(stop)
+	}
+
+	output, err := sync(syncInput{
+		session:      ai.Session,
+		home:         ai.Home,
+		roots:        roots,
+		paths:        ai.Plan.Paths,
+		exclude:      ai.Plan.Exclude,
+		templateVars: ai.TemplateVars,
+		debug:        ai.Debug,
+		plan:         &ai.Plan,
+		progress:     ai.Progress,
+	})
+
+	return output.export(), err
+}
+
+// WritePlan saves a plan as JSON
+func WritePlan(plan SyncPlan, path string) error {
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// ReadPlan loads a plan saved by WritePlan
+func ReadPlan(path string) (plan SyncPlan, err error) {
+	var b []byte
+
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(b, &plan); err != nil {
+		return plan, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+
+	return plan, err
+}
+
+// remoteStateHash returns a hash of everything about an item's note that a planned change depends on
+func remoteStateHash(itemDiff ItemDiff) string {
+	if itemDiff.remote.UUID == "" {
+		return ""
+	}
+
+	return hashContent(strings.Join([]string{
+		itemDiff.remote.Content.GetText(),
+		itemDiff.remote.Content.PreviewPlain,
+		itemDiff.rendered,
+	}, "\x00"))
+}
+
+func newPlanAction(itemDiff ItemDiff, action string) PlanAction {
+	pa := PlanAction{
+		Path:       itemDiff.homeRelPath,
+		Action:     action,
+		Diff:       itemDiff.diff,
+		NoteUUID:   itemDiff.remote.UUID,
+		RemoteHash: remoteStateHash(itemDiff),
+	}
+
+	if itemDiff.diff != localMissing && itemDiff.diff != localDeleted {
+		pa.LocalHash = hashContent(itemDiff.local)
+	}
+
+	if itemDiff.localMode != 0 {
+		pa.LocalMode = modeString(itemDiff.localMode)
+	}
+
+	return pa
+}
+
+// plannedActions returns the changes to be made for each classified item, by path
+func plannedActions(actions syncActions) map[string]PlanAction {
+	planned := make(map[string]PlanAction)
+
+	for action, items := range map[string][]ItemDiff{
+		planActionPush:   actions.push,
+		planActionPull:   actions.pull,
+		planActionRemove: actions.remove,
+		planActionTrash:  actions.trash,
+	} {
+		for _, itemDiff := range items {
+			planned[itemDiff.homeRelPath] = newPlanAction(itemDiff, action)
+		}
+	}
+
+	return planned
+}
+
+func newSyncPlan(home string, actions syncActions) SyncPlan {
+	plan := SyncPlan{
+		Version:   planVersion,
+		CreatedAt: time.Now().UTC(),
+		Home:      home,
+		Actions:   []PlanAction{},
+	}
+
+	for _, pa := range plannedActions(actions) {
+		plan.Actions = append(plan.Actions, pa)
+	}
+
+	sort.Slice(plan.Actions, func(i, j int) bool {
+		return plan.Actions[i].Path < plan.Actions[j].Path
+	})
+
+	return plan
+}
+
+// actionsForPlan returns only the classified items the plan acts on, as long as
+// each would still be acted on in the same way and its state matches that recorded in the plan
+func actionsForPlan(plan SyncPlan, home string, actions syncActions) (planActions syncActions, err error) {
+	if plan.Home != home {
+		return planActions, fmt.Errorf("plan was made for home %s", plan.Home)
+	}
+
+	current := plannedActions(actions)
+
+	var changed []string
+
+	wanted := make(map[string]bool)
+
+	for _, pa := range plan.Actions {
+		if current[pa.Path] != pa {
+			changed = append(changed, pa.Path)
+		}
+
+		wanted[pa.Path] = true
+	}
+
+	if len(changed) > 0 {
+		return planActions, fmt.Errorf("plan is out of date as changes have been made to: %s", strings.Join(changed, ", "))
+	}
+
+	filter := func(items []ItemDiff) (res []ItemDiff) {
+		for _, itemDiff := range items {
+			if wanted[itemDiff.homeRelPath] {
+				res = append(res, itemDiff)
+			}
+		}
+
+		return res
+	}
+
+	if len(plan.Actions) == 0 {
+		return planActions, errors.New("plan has no changes to apply")
+	}
+
+	return syncActions{
+		push:   filter(actions.push),
+		pull:   filter(actions.pull),
+		remove: filter(actions.remove),
+		trash:  filter(actions.trash),
+		bases:  actions.bases,
+	}, err
+}
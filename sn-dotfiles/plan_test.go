@@ -0,0 +1,135 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testPlanApple = createNote(".apple", "old apple")
+	testPlanLemon = createNote(".lemon", "lemon")
+)
+
+func testPlanActions() syncActions {
+	return syncActions{
+		push: []ItemDiff{{
+			homeRelPath: ".apple",
+			diff:        localNewer,
+			remote:      testPlanApple,
+			local:       "new apple",
+			localMode:   0o644,
+		}},
+		pull: []ItemDiff{{
+			homeRelPath: ".lemon",
+			diff:        localMissing,
+			remote:      testPlanLemon,
+		}},
+		trash: []ItemDiff{{
+			homeRelPath: ".pear",
+			diff:        remoteDeleted,
+			local:       "pear",
+		}},
+		identical: []ItemDiff{{
+			homeRelPath: ".fig",
+			diff:        identical,
+		}},
+	}
+}
+
+func TestNewSyncPlan(t *testing.T) {
+	actions := testPlanActions()
+	plan := newSyncPlan("/home/user", actions)
+	assert.Equal(t, planVersion, plan.Version)
+	assert.Equal(t, "/home/user", plan.Home)
+	require.Len(t, plan.Actions, 3)
+
+	// sorted by path
+	assert.Equal(t, ".apple", plan.Actions[0].Path)
+	assert.Equal(t, planActionPush, plan.Actions[0].Action)
+	assert.Equal(t, actions.push[0].remote.UUID, plan.Actions[0].NoteUUID)
+	assert.Equal(t, hashContent("new apple"), plan.Actions[0].LocalHash)
+	assert.Equal(t, "0644", plan.Actions[0].LocalMode)
+	assert.NotEmpty(t, plan.Actions[0].RemoteHash)
+
+	assert.Equal(t, ".lemon", plan.Actions[1].Path)
+	assert.Equal(t, planActionPull, plan.Actions[1].Action)
+	assert.Empty(t, plan.Actions[1].LocalHash)
+
+	assert.Equal(t, ".pear", plan.Actions[2].Path)
+	assert.Equal(t, planActionTrash, plan.Actions[2].Action)
+	assert.Empty(t, plan.Actions[2].NoteUUID)
+	assert.Empty(t, plan.Actions[2].RemoteHash)
+}
+
+func TestActionsForPlan(t *testing.T) {
+	plan := newSyncPlan("/home/user", testPlanActions())
+
+	// unchanged
+	actions, err := actionsForPlan(plan, "/home/user", testPlanActions())
+	require.NoError(t, err)
+	assert.Len(t, actions.push, 1)
+	assert.Len(t, actions.pull, 1)
+	assert.Len(t, actions.trash, 1)
+	assert.Empty(t, actions.identical)
+
+	// items not in the plan are left alone
+	current := testPlanActions()
+	current.pull = append(current.pull, ItemDiff{homeRelPath: ".grape", diff: remoteNewer, remote: createNote(".grape", "grape")})
+	actions, err = actionsForPlan(plan, "/home/user", current)
+	require.NoError(t, err)
+	assert.Len(t, actions.pull, 1)
+	assert.Equal(t, ".lemon", actions.pull[0].homeRelPath)
+
+	// local content changed
+	current = testPlanActions()
+	current.push[0].local = "newer apple"
+	_, err = actionsForPlan(plan, "/home/user", current)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ".apple")
+
+	// remote content changed
+	current = testPlanActions()
+	current.pull[0].remote.Content.SetText("new lemon")
+	_, err = actionsForPlan(plan, "/home/user", current)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ".lemon")
+
+	// no longer to be acted on in the same way
+	current = testPlanActions()
+	current.trash = nil
+	current.conflicting = []ItemDiff{{homeRelPath: ".pear", diff: conflict, local: "pear"}}
+	_, err = actionsForPlan(plan, "/home/user", current)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ".pear")
+
+	// different home
+	_, err = actionsForPlan(plan, "/home/other", testPlanActions())
+	require.Error(t, err)
+
+	// nothing planned
+	_, err = actionsForPlan(newSyncPlan("/home/user", syncActions{}), "/home/user", testPlanActions())
+	require.Error(t, err)
+}
+
+func TestWriteAndReadPlan(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("sn-dotfiles-plan-%d.json", os.Getpid()))
+	defer os.Remove(path)
+
+	plan := newSyncPlan("/home/user", testPlanActions())
+	plan.Paths = []string{"/home/user/.apple"}
+	require.NoError(t, WritePlan(plan, path))
+
+	read, err := ReadPlan(path)
+	require.NoError(t, err)
+	assert.Equal(t, plan.Actions, read.Actions)
+	assert.Equal(t, plan.Paths, read.Paths)
+	assert.True(t, plan.CreatedAt.Equal(read.CreatedAt))
+
+	_, err = ReadPlan(path + ".missing")
+	assert.Error(t, err)
+}
@@ -4,12 +4,21 @@ import (
 	"errors"
 	"fmt"
 	"github.com/fatih/set"
-	"path/filepath"
 	"strings"
 )
 
 // preflight validates and tidies up the home directory and paths provided
 func preflight(home string, in []string) (out []string, err error) {
+	return preflightPaths(home, in, true)
+}
+
+// preflightTracked prepares paths as preflight does, but allows those no longer existing locally
+// as they may still be tracked
+func preflightTracked(home string, in []string) (out []string, err error) {
+	return preflightPaths(home, in, false)
+}
+
+func preflightPaths(home string, in []string, mustExist bool) (out []string, err error) {
 	// check home is present
 	if len(home) == 0 {
 		err = errors.New("home undefined")
@@ -22,37 +31,42 @@ func preflight(home string, in []string) (out []string, err error) {
 	// handle shell expansion
 	var v bool
 	for _, inPath := range in {
-		if strings.HasPrefix(inPath, "~") {
-			inPath = strings.Replace(inPath, "~", home, 1)
-			if v, err = pathValid(inPath); !v {
-				return
-			}
-			out = append(out, inPath)
+		path := expandHome(home, inPath)
+		// patterns are expanded by the operation using them
+		if isGlob(path) {
+			out = append(out, path)
 			continue
 		}
-		if !strings.HasPrefix(inPath, "/") {
-			out = append(out, filepath.Join(home, inPath))
-			if v, err = pathValid(inPath); !v {
-				return
-			}
+		if !mustExist && !pathExists(path) {
+			out = append(out, path)
 			continue
 		}
-		if v, err = pathValid(inPath); !v {
+		if v, err = preflightPathValid(path); !v {
 			return
 		}
-		out = append(out, inPath)
+		out = append(out, path)
 	}
 
 	return
 }
 
+// preflightPathValid checks a path is valid, leaving symlinks to be validated
+// by the operation using them
+func preflightPathValid(path string) (bool, error) {
+	if isSymlink(path) {
+		return true, nil
+	}
+
+	return pathValid(path)
+}
+
 func checkNoteTagConflicts(twn tagsWithNotes) error {
 	// check for path conflict where tag and note overlap
 	tagPaths := set.New(set.NonThreadSafe)
 	notePaths := set.New(set.NonThreadSafe)
 
 	for _, t := range twn {
-		tagPath := t.tag.Content.GetTitle()
+		tagPath := t.title()
 		tagPaths.Add(tagPath)
 		// loop through tag related notes and generate a list
 		// of all combinations to check for duplicates
@@ -61,10 +75,10 @@ func checkNoteTagConflicts(twn tagsWithNotes) error {
 			// if tag path is not root (DotFilesTag) then it's a sub tag/dir
 			// so add tag path (plus period) to note title
 			if tagPath != DotFilesTag {
-				notePath = tagPath + "." + n.Content.GetTitle()
+				notePath = tagPath + "." + escapeTagTitlePart(n.Content.GetTitle())
 			} else {
-				// otherwise, just add note title to DotFilesTag
-				notePath = tagPath + n.Content.GetTitle()
+				// otherwise, the note title is a top level path
+				notePath = pathToTag(n.Content.GetTitle())
 			}
 
 			notePaths.Add(notePath)
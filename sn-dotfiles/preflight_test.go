@@ -3,9 +3,12 @@ package sndotfiles
 import (
 	"fmt"
 	"github.com/jonhadfield/gosn-v2"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPreflightInvalidPaths(t *testing.T) {
@@ -15,14 +18,47 @@ func TestPreflightInvalidPaths(t *testing.T) {
 	_, err := preflight(home, []string{duffPath})
 	assert.Error(t, err)
 }
+
+func TestPreflightTracked(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	// paths no longer existing locally are kept as they may still be tracked
+	paths, err := preflightTracked(home, []string{"~/.gone", ".config/gone"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{filepath.Join(home, ".gone"), filepath.Join(home, ".config/gone")}, paths)
+
+	tooLarge := filepath.Join(home, ".large")
+	require.NoError(t, createPathWithContent(tooLarge, "large"))
+	require.NoError(t, os.Truncate(tooLarge, maxFileSize+1))
+
+	_, err = preflightTracked(home, []string{tooLarge})
+	assert.Error(t, err)
+}
+
+func TestGetNotesToRemoveMissingLocally(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	gone := createNote("gone", "")
+	twn := tagsWithNotes{
+		tagWithNotes{tag: createTag("dotfiles.config"), notes: gosn.Notes{gone}},
+	}
+
+	homeRelPath, pathsToRemove, notes := getNotesToRemove(filepath.Join(home, ".config/gone"), home, nil, twn, false)
+	assert.Equal(t, ".config/gone", homeRelPath)
+	assert.Equal(t, []string{".config/gone"}, pathsToRemove)
+	require.Len(t, notes, 1)
+	assert.Equal(t, gone.UUID, notes[0].UUID)
+}
 func TestPreflightOverlaps(t *testing.T) {
 	// with overlap
 	noteOne := createNote("noteOne", "hello world")
 	twn := tagsWithNotes{tagWithNotes{
 		tag: createTag("something.else.noteOne"),
 	},
-		tagWithNotes{createTag("something.else"),
-			gosn.Notes{noteOne}},
+		tagWithNotes{tag: createTag("something.else"),
+			notes: gosn.Notes{noteOne}},
 	}
 	err := checkNoteTagConflicts(twn)
 	assert.Error(t, err)
@@ -34,8 +70,8 @@ func TestPreflightOverlaps1(t *testing.T) {
 	twn := tagsWithNotes{tagWithNotes{
 		tag: createTag("something.else.noteOne"),
 	},
-		tagWithNotes{createTag("something.else"),
-			gosn.Notes{noteOne}},
+		tagWithNotes{tag: createTag("something.else"),
+			notes: gosn.Notes{noteOne}},
 	}
 	err := checkNoteTagConflicts(twn)
 	assert.NoError(t, err)
@@ -3,35 +3,37 @@ package sndotfiles
 import (
 	"errors"
 	"fmt"
-	"github.com/briandowns/spinner"
 	"github.com/jonhadfield/gosn-v2"
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/ryanuber/columnize"
-	"os"
-	"time"
 )
 
 type RemoveInput struct {
 	Session  *cache.Session
 	Home     string
+	Roots    *Roots
 	Paths    []string
 	PageSize int
 	Debug    bool
+	DryRun   bool
 }
 
 type RemoveOutput struct {
 	NotesRemoved, TagsRemoved, NotTracked int
+	Results                               []Result
 	Msg                                   string
 }
 
-// Remove stops tracking local Paths by removing the related notes from SN
+// Remove deletes the notes for local Paths from SN, keeping the local files
+// as with any remote deletion, other machines move their copies to the trash when they next sync
+// if DryRun is set, the notes and tags that would be removed are reported instead
 func Remove(ri RemoveInput, useStdErr bool) (ro RemoveOutput, err error) {
 	if StringInSlice(ri.Home, []string{"/", "/home"}, true) {
 		err = fmt.Errorf("not a good idea to use '%s' as home dir", ri.Home)
 		return
 	}
 
-	ri.Paths, err = preflight(ri.Home, ri.Paths)
+	ri.Paths, err = preflightTracked(ri.Home, ri.Paths)
 	if err != nil {
 		return
 	}
@@ -45,22 +47,9 @@ func Remove(ri RemoveInput, useStdErr bool) (ro RemoveOutput, err error) {
 	ri.Paths = dedupe(ri.Paths)
 	debugPrint(ri.Debug, fmt.Sprintf("Remove | paths after dedupe: %d", len(ri.Paths)))
 
-	ri.Paths, err = preflight(ri.Home, ri.Paths)
-
 	if !ri.Debug {
-		prefix := HiWhite("syncing ")
-		if _, err = os.Stat(ri.Session.CacheDBPath); os.IsNotExist(err) {
-			prefix = HiWhite("initializing ")
-		}
-
-		s := spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stdout))
-		if useStdErr {
-			s = spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stderr))
-		}
-
-		s.Prefix = prefix
-		s.Start()
-		defer s.Stop()
+		stop := startSpinner(ri.Session, useStdErr)
+		defer stop()
 	}
 
 	// get populated db
@@ -91,20 +80,70 @@ func Remove(ri RemoveInput, useStdErr bool) (ro RemoveOutput, err error) {
 
 	var notesToRemove gosn.Notes
 
+	// patterns are matched against the tracked paths, so those no longer existing locally can be removed
+	var paths []string
+
 	for _, path := range ri.Paths {
-		homeRelPath, pathsToRemove, matchingItems := getNotesToRemove(path, ri.Home, twn, ri.Debug)
+		if !isGlob(path) {
+			paths = append(paths, path)
+			continue
+		}
+
+		var matches []string
+
+		matches, err = globTracked(path, ri.Home, ri.Roots, twn)
+		if err != nil {
+			return
+		}
+
+		if len(matches) == 0 {
+			// reported as not tracked
+			matches = []string{path}
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	for _, path := range paths {
+		homeRelPath, pathsToRemove, matchingItems := getNotesToRemove(path, ri.Home, ri.Roots, twn, ri.Debug)
 
 		debugPrint(ri.Debug, fmt.Sprintf("Remove | items matching path '%s': %d", path, len(matchingItems)))
 
 		if len(matchingItems) == 0 {
 			boldHomeRelPath := bold(stripTrailingSlash(homeRelPath))
 			results = append(results, fmt.Sprintf("%s | %s", boldHomeRelPath, yellow("not tracked")))
+			ro.Results = append(ro.Results, Result{
+				Path:   stripTrailingSlash(homeRelPath),
+				Diff:   untracked,
+				Action: ActionNone,
+			})
 			ro.NotTracked++
 
 			continue
 		}
 
-		for _, ptr := range pathsToRemove {
+		for x, ptr := range pathsToRemove {
+			result := Result{
+				Path:   ptr,
+				Action: ActionRemoved,
+			}
+
+			if x < len(matchingItems) {
+				result.NoteUUID = matchingItems[x].UUID
+				result.Tag = noteTagTitle(twn, matchingItems[x].UUID)
+			}
+
+			if ri.DryRun {
+				result.Action = ActionWouldRemove
+			}
+
+			ro.Results = append(ro.Results, result)
+
+			if ri.DryRun {
+				results = append(results, fmt.Sprintf("%s | %s", bold(ptr), yellow("would remove")))
+				continue
+			}
+
 			results = append(results, fmt.Sprintf("%s | %s", bold(ptr), green("removed")))
 		}
 
@@ -135,6 +174,18 @@ func Remove(ri RemoveInput, useStdErr bool) (ro RemoveOutput, err error) {
 		debugPrint(ri.Debug, fmt.Sprintf("Remove | notes to removeFromDB: [%d] %s", x, n.Content.GetTitle()))
 	}
 
+	if ri.DryRun {
+		for _, et := range emptyTags {
+			results = append(results, fmt.Sprintf("%s | %s", bold(et.Content.GetTitle()), yellow("would remove tag")))
+		}
+
+		ro.Msg = fmt.Sprint(columnize.SimpleFormat(results))
+		ro.NotesRemoved = len(notesToRemove)
+		ro.TagsRemoved = len(emptyTags)
+
+		return ro, cso.DB.Close()
+	}
+
 	var a gosn.Items
 
 	for i := range notesToRemove {
@@ -144,6 +195,11 @@ func Remove(ri RemoveInput, useStdErr bool) (ro RemoveOutput, err error) {
 	for i := range emptyTags {
 		a = append(a, &emptyTags[i])
 	}
+	// forget the removed paths so sync doesn't treat them as deleted remotely
+	if err = forgetSyncBasesForNotes(cso.DB, notesToRemove); err != nil {
+		return
+	}
+
 	ri.Session.CacheDB = cso.DB
 	x := removeInput{items: a, session: ri.Session}
 	if err = removeFromDB(x); err != nil {
@@ -164,6 +220,19 @@ func Remove(ri RemoveInput, useStdErr bool) (ro RemoveOutput, err error) {
 	return ro, err
 }
 
+// noteTagTitle returns the title of the tag a note is tracked under
+func noteTagTitle(twn tagsWithNotes, uuid string) string {
+	for _, t := range twn {
+		for _, note := range t.notes {
+			if note.UUID == uuid {
+				return t.title()
+			}
+		}
+	}
+
+	return ""
+}
+
 type removeInput struct {
 	session *cache.Session
 	items   gosn.Items
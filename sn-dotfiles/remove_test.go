@@ -5,6 +5,8 @@ import (
 	"github.com/jonhadfield/gosn-v2"
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 )
@@ -50,10 +52,18 @@ func TestRemoveInvalidSession(t *testing.T) {
 }
 
 func TestRemoveInvalidPath(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	// paths missing locally may still be tracked, but those existing must be valid
+	tooLarge := filepath.Join(home, ".large")
+	require.NoError(t, createPathWithContent(tooLarge, "large"))
+	require.NoError(t, os.Truncate(tooLarge, maxFileSize+1))
+
 	ri := RemoveInput{
 		Session: testCacheSession,
-		Home:    getTemporaryHome(),
-		Paths:   []string{"/invalid"},
+		Home:    home,
+		Paths:   []string{tooLarge},
 		Debug:   true,
 	}
 	_, err := Remove(ri, true)
@@ -0,0 +1,93 @@
+package sndotfiles
+
+const (
+	ActionNone     = "none"
+	ActionPushed   = "pushed"
+	ActionPulled   = "pulled"
+	ActionRemoved  = "removed"
+	ActionTrashed  = "trashed"
+	ActionAdded    = "added"
+	ActionMerged   = "merged"
+	ActionRestored = "restored"
+	ActionReverted = "reverted"
+
+	// actions reported by a dry run
+	ActionWouldPush   = "would push"
+	ActionWouldPull   = "would pull"
+	ActionWouldRemove = "would remove"
+	ActionWouldTrash  = "would trash"
+	ActionWouldAdd    = "would add"
+)
+
+// Result describes a single path and what was done with it, for machine-readable output
+type Result struct {
+	Path     string `json:"path"`
+	Tag      string `json:"tag,omitempty"`
+	NoteUUID string `json:"note_uuid,omitempty"`
+	Diff     string `json:"diff,omitempty"`
+	Action   string `json:"action"`
+	// Error is set if the change to this path failed, leaving it as it was, while the others were still made
+	Error string `json:"error,omitempty"`
+}
+
+func newResult(itemDiff ItemDiff, action string) Result {
+	result := Result{
+		Path:     itemDiff.homeRelPath,
+		Tag:      itemDiff.tagTitle,
+		NoteUUID: itemDiff.remote.UUID,
+		Diff:     displayDiff(itemDiff),
+		Action:   action,
+	}
+
+	if itemDiff.err != nil {
+		result.Error = itemDiff.err.Error()
+	}
+
+	return result
+}
+
+// Failed returns true if the change to any path failed
+func Failed(results []Result) bool {
+	for _, result := range results {
+		if result.Error != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Results returns a result for each item compared by Status or Diff, none of which are acted on
+func Results(diffs []ItemDiff) []Result {
+	results := make([]Result, len(diffs))
+	for i := range diffs {
+		results[i] = newResult(diffs[i], ActionNone)
+	}
+
+	return results
+}
+
+// results returns a result for each classified item, with the action a sync takes, or would take, with it
+func (sa syncActions) results(dryRun bool) (results []Result) {
+	add := func(items []ItemDiff, action, dryRunAction string) {
+		if dryRun {
+			action = dryRunAction
+		}
+
+		for _, itemDiff := range items {
+			results = append(results, newResult(itemDiff, action))
+		}
+	}
+
+	add(sa.push, ActionPushed, ActionWouldPush)
+	add(sa.pull, ActionPulled, ActionWouldPull)
+	add(sa.merged, ActionMerged, ActionMerged)
+	add(sa.remove, ActionRemoved, ActionWouldRemove)
+	add(sa.trash, ActionTrashed, ActionWouldTrash)
+	add(sa.conflicting, ActionNone, ActionNone)
+	add(sa.notPushed, ActionNone, ActionNone)
+	add(sa.identical, ActionNone, ActionNone)
+	add(sa.failed, ActionNone, ActionNone)
+
+	return results
+}
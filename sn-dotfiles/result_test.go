@@ -0,0 +1,153 @@
+package sndotfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResults(t *testing.T) {
+	note := createNote(".apple", "apple")
+	results := Results([]ItemDiff{
+		{homeRelPath: ".apple", tagTitle: DotFilesTag, remote: note, diff: localNewer},
+		{homeRelPath: ".link", symlink: true, diff: remoteNewer},
+	})
+	require.Len(t, results, 2)
+	assert.Equal(t, Result{Path: ".apple", Tag: DotFilesTag, NoteUUID: note.UUID, Diff: localNewer, Action: ActionNone}, results[0])
+	assert.Equal(t, targetChanged, results[1].Diff)
+}
+
+func TestSyncActionsResults(t *testing.T) {
+	actions := syncActions{
+		push:        []ItemDiff{{homeRelPath: ".apple", diff: localNewer}},
+		pull:        []ItemDiff{{homeRelPath: ".lemon", diff: localMissing}},
+		remove:      []ItemDiff{{homeRelPath: ".pear", diff: localDeleted}},
+		trash:       []ItemDiff{{homeRelPath: ".grape", diff: remoteDeleted}},
+		conflicting: []ItemDiff{{homeRelPath: ".fig", diff: conflict}},
+		identical:   []ItemDiff{{homeRelPath: ".kiwi", diff: identical}},
+	}
+
+	actionsByPath := func(results []Result) map[string]string {
+		res := make(map[string]string)
+		for _, r := range results {
+			res[r.Path] = r.Action
+		}
+
+		return res
+	}
+
+	assert.Equal(t, map[string]string{
+		".apple": ActionPushed,
+		".lemon": ActionPulled,
+		".pear":  ActionRemoved,
+		".grape": ActionTrashed,
+		".fig":   ActionNone,
+		".kiwi":  ActionNone,
+	}, actionsByPath(actions.results(false)))
+
+	assert.Equal(t, map[string]string{
+		".apple": ActionWouldPush,
+		".lemon": ActionWouldPull,
+		".pear":  ActionWouldRemove,
+		".grape": ActionWouldTrash,
+		".fig":   ActionNone,
+		".kiwi":  ActionNone,
+	}, actionsByPath(actions.results(true)))
+}
+
+func TestAddResults(t *testing.T) {
+	home := "/home/user"
+	existing := createNote(".apple", "apple")
+	twn := tagsWithNotes{{tag: createTag(DotFilesTag), notes: gosn.Notes{existing}}}
+
+	added := createNote("config", "config")
+	tagToItemMap := map[string]gosn.Items{
+		DotFilesTag + ".config": {&added},
+	}
+
+	results := addResults([]string{home + "/.apple"}, tagToItemMap, home, nil, twn, false)
+	require.Len(t, results, 2)
+	assert.Equal(t, Result{Path: ".apple", Tag: DotFilesTag, NoteUUID: existing.UUID, Action: ActionNone}, results[0])
+	assert.Equal(t, Result{Path: ".config/config", Tag: DotFilesTag + ".config", NoteUUID: added.UUID, Action: ActionAdded}, results[1])
+
+	results = addResults(nil, tagToItemMap, home, nil, twn, true)
+	require.Len(t, results, 1)
+	assert.Equal(t, ActionWouldAdd, results[0].Action)
+}
+
+func TestFailed(t *testing.T) {
+	assert.False(t, Failed(nil))
+	assert.False(t, Failed([]Result{{Path: ".apple", Action: ActionPulled}}))
+	assert.True(t, Failed([]Result{{Path: ".apple", Action: ActionPulled}, {Path: ".lemon", Action: ActionNone, Error: "denied"}}))
+}
+
+func TestExecuteSyncReportsFailures(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	db := openTestJournalDB(t, home)
+
+	defer db.Close()
+
+	// a file where a directory is needed can't be written to, even by root
+	require.NoError(t, createPathWithContent(filepath.Join(home, ".blocked"), "not a directory"))
+
+	appleNote := createNote("apple", "apple content")
+	pearNote := createNote("pear", "pear content")
+
+	actions := syncActions{
+		pull: []ItemDiff{
+			{path: filepath.Join(home, ".apple"), homeRelPath: ".apple", remote: appleNote, diff: localMissing},
+			{path: filepath.Join(home, ".blocked", "pear"), homeRelPath: ".blocked/pear", remote: pearNote, diff: localMissing},
+		},
+		trash: []ItemDiff{
+			{path: filepath.Join(home, ".gone"), homeRelPath: ".gone", diff: remoteDeleted},
+		},
+		bases: syncBases{},
+	}
+
+	var streamed []Result
+
+	so, err := executeSync(syncInput{
+		db:       db,
+		session:  &cache.Session{CacheDBPath: filepath.Join(home, "test.db")},
+		home:     home,
+		progress: func(result Result) { streamed = append(streamed, result) },
+	}, actions)
+	require.NoError(t, err)
+
+	// the other changes are still made
+	assert.Equal(t, 1, so.noPulled)
+	assert.Zero(t, so.noTrashed)
+
+	content, err := ioutil.ReadFile(filepath.Join(home, ".apple"))
+	require.NoError(t, err)
+	assert.Equal(t, "apple content", string(content))
+
+	require.Len(t, so.results, 3)
+	assert.Equal(t, so.results, streamed)
+	assert.True(t, Failed(so.results))
+
+	assert.Equal(t, ActionPulled, so.results[0].Action)
+	assert.Empty(t, so.results[0].Error)
+	assert.Equal(t, ".blocked/pear", so.results[1].Path)
+	assert.Equal(t, ActionNone, so.results[1].Action)
+	assert.NotEmpty(t, so.results[1].Error)
+	assert.Equal(t, ".gone", so.results[2].Path)
+	assert.Equal(t, ActionNone, so.results[2].Action)
+	assert.NotEmpty(t, so.results[2].Error)
+	assert.Contains(t, so.msg, "failed")
+
+	// only the file written is recorded as synced
+	bases, err := loadSyncBases(db)
+	require.NoError(t, err)
+	assert.Contains(t, bases, ".apple")
+	assert.NotContains(t, bases, ".blocked/pear")
+}
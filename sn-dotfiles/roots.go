@@ -0,0 +1,270 @@
+package sndotfiles
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// RootPrefix starts the first element of the paths, and tags, of files in a root, e.g. root:etc/hosts
+// is tracked with the tag dotfiles.root:etc
+const RootPrefix = "root:"
+
+// Roots are the directories outside home that can be tracked, by name, passed to each command alongside home
+// a nil Roots has none, so only paths in home are tracked
+// notes tracked in a root that isn't set are left alone
+type Roots struct {
+	// Dirs maps the name of each root to its absolute path
+	Dirs map[string]string
+	// PrivilegeHelper is the command, such as sudo, used to write to paths in roots the user can't write to
+	// if not set, such writes fail
+	PrivilegeHelper string
+	// beforeHelper is called before the privilege helper runs, so a spinner doesn't draw over its prompt
+	beforeHelper func()
+}
+
+// NewRoots validates the directories, by name, and privilege helper used to track files outside home
+func NewRoots(dirs map[string]string, privilegeHelper string) (*Roots, error) {
+	r := &Roots{Dirs: make(map[string]string, len(dirs)), PrivilegeHelper: privilegeHelper}
+
+	for name, dir := range dirs {
+		if name == "" || strings.ContainsAny(name, `./\:`) {
+			return nil, fmt.Errorf("invalid root name '%s': must not contain '.', '/', '\\' or ':'", name)
+		}
+
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("invalid root '%s': %s is not an absolute path", name, dir)
+		}
+
+		r.Dirs[name] = filepath.Clean(dir)
+	}
+
+	return r, nil
+}
+
+// Contains returns true if path is within one of the roots
+func (r *Roots) Contains(path string) bool {
+	_, dir := r.rootOf(path)
+
+	return dir != ""
+}
+
+// withBeforeHelper returns a copy of the roots calling fn before the privilege helper runs
+func (r *Roots) withBeforeHelper(fn func()) *Roots {
+	if r == nil {
+		return nil
+	}
+
+	c := *r
+	c.beforeHelper = fn
+
+	return &c
+}
+
+// dirs returns the paths of the roots
+func (r *Roots) dirs() (dirs []string) {
+	if r == nil {
+		return nil
+	}
+
+	for _, dir := range r.Dirs {
+		dirs = append(dirs, dir)
+	}
+
+	return dirs
+}
+
+// rootOf returns the name and path of the root containing path, preferring the deepest if roots are nested
+func (r *Roots) rootOf(path string) (name, dir string) {
+	if r == nil {
+		return "", ""
+	}
+
+	path = filepath.Clean(path)
+
+	for n, d := range r.Dirs {
+		if (path == d || strings.HasPrefix(path, ensureTrailingPathSep(d))) && len(d) > len(dir) {
+			name, dir = n, d
+		}
+	}
+
+	return name, dir
+}
+
+// relPath returns the path tracked for a path in a root, e.g. root:etc/hosts for /etc/hosts
+// a trailing separator is kept, as with paths in home
+func (r *Roots) relPath(path string) (rel string, ok bool) {
+	name, dir := r.rootOf(path)
+	if dir == "" {
+		return "", false
+	}
+
+	rel = RootPrefix + name
+
+	if rest := strings.TrimPrefix(path, dir); rest != "" && rest != string(os.PathSeparator) {
+		rel += string(os.PathSeparator) + strings.TrimPrefix(rest, string(os.PathSeparator))
+	} else if strings.HasSuffix(path, string(os.PathSeparator)) {
+		rel += string(os.PathSeparator)
+	}
+
+	return rel, true
+}
+
+// dir returns the path of the root referred to by the first element of a tracked path or tag, e.g. root:etc
+func (r *Roots) dir(element string) (dir string, ok bool) {
+	if r == nil || !strings.HasPrefix(element, RootPrefix) {
+		return "", false
+	}
+
+	dir, ok = r.Dirs[strings.TrimPrefix(element, RootPrefix)]
+
+	return dir, ok
+}
+
+// rootResolved returns false if a tracked path is in a root that isn't set, so has no local path
+func rootResolved(rel string, roots *Roots) bool {
+	element := strings.SplitN(rel, string(os.PathSeparator), 2)[0]
+	if !strings.HasPrefix(element, RootPrefix) {
+		return true
+	}
+
+	_, ok := roots.dir(element)
+
+	return ok
+}
+
+// localPath returns the local path of a path relative to home, or to a root if it starts with RootPrefix
+func localPath(home, rel string, roots *Roots) string {
+	parts := strings.SplitN(rel, string(os.PathSeparator), 2)
+
+	if dir, ok := roots.dir(parts[0]); ok {
+		if len(parts) == 1 {
+			return dir
+		}
+
+		return filepath.Join(dir, parts[1])
+	}
+
+	return filepath.Join(home, rel)
+}
+
+// runPrivileged runs a command with a privilege helper, connected to the terminal so it can ask for a password
+// a variable so it can be replaced in tests
+var runPrivileged = func(helper string, args ...string) error {
+	fields := strings.Fields(helper)
+
+	cmd := exec.Command(fields[0], append(fields[1:], args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %w", helper, strings.Join(args, " "), err)
+	}
+
+	return nil
+}
+
+// privileged runs a command with the privilege helper, if the user was denied permission to change a path in a root,
+// returning the original error otherwise
+func (r *Roots) privileged(err error, path string, args ...string) error {
+	if !errors.Is(err, os.ErrPermission) || !r.Contains(path) {
+		return err
+	}
+
+	if strings.TrimSpace(r.PrivilegeHelper) == "" {
+		return fmt.Errorf("%w: set privilege_helper, e.g. sudo, to write to %s", err, path)
+	}
+
+	if r.beforeHelper != nil {
+		r.beforeHelper()
+	}
+
+	return runPrivileged(r.PrivilegeHelper, args...)
+}
+
+// mkdirLocal creates a directory and any parents, using the privilege helper if required
+func mkdirLocal(dir string, perm os.FileMode, roots *Roots) error {
+	err := os.MkdirAll(dir, perm)
+	if err != nil {
+		return roots.privileged(err, dir, "mkdir", "-p", dir)
+	}
+
+	return nil
+}
+
+// writeLocalFile replaces a local file atomically, or using the privilege helper if required
+func writeLocalFile(path, content string, mode os.FileMode, modeFound bool, roots *Roots) error {
+	err := writeFileAtomic(path, content, mode, modeFound)
+	if err == nil || !errors.Is(err, os.ErrPermission) || !roots.Contains(path) {
+		return err
+	}
+
+	// as when written directly, a symlink is written through
+	target := path
+	if resolved, rErr := filepath.EvalSymlinks(path); rErr == nil {
+		target = resolved
+	}
+
+	if !modeFound {
+		mode = 0o644
+	}
+
+	args := []string{"install"}
+
+	// install gives the file the owner and group running it, so those of the file replaced are kept
+	if stat, sErr := os.Stat(target); sErr == nil {
+		if !modeFound {
+			mode = stat.Mode().Perm()
+		}
+
+		if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+			args = append(args, "-o", strconv.FormatUint(uint64(sys.Uid), 10), "-g", strconv.FormatUint(uint64(sys.Gid), 10))
+		}
+	}
+
+	// the content is staged where the user can write it, then installed by the helper
+	tmp, tErr := ioutil.TempFile("", SNAppName)
+	if tErr != nil {
+		return tErr
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, tErr = tmp.WriteString(content); tErr != nil {
+		_ = tmp.Close()
+		return tErr
+	}
+
+	if tErr = tmp.Close(); tErr != nil {
+		return tErr
+	}
+
+	return roots.privileged(err, path, append(args, "-m", fmt.Sprintf("%04o", mode.Perm()), tmp.Name(), target)...)
+}
+
+// symlinkLocal replaces a local symlink atomically, or using the privilege helper if required
+func symlinkLocal(target, path string, roots *Roots) error {
+	err := symlinkAtomic(target, path)
+	if err != nil {
+		return roots.privileged(err, path, "ln", "-sfn", target, path)
+	}
+
+	return nil
+}
+
+// removeLocal removes a local file, using the privilege helper if required
+func removeLocal(path string, roots *Roots) error {
+	err := os.Remove(path)
+	if err != nil {
+		return roots.privileged(err, path, "rm", "-f", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package sndotfiles
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRoots(t *testing.T) {
+	_, err := NewRoots(map[string]string{"e.tc": "/etc"}, "")
+	assert.Error(t, err)
+	_, err = NewRoots(map[string]string{"root:etc": "/etc"}, "")
+	assert.Error(t, err)
+	_, err = NewRoots(map[string]string{"etc": "etc"}, "")
+	assert.Error(t, err)
+
+	roots, err := NewRoots(map[string]string{"etc": "/etc/", "srv": "/srv"}, "sudo")
+	require.NoError(t, err)
+	assert.Equal(t, "sudo", roots.PrivilegeHelper)
+
+	assert.True(t, roots.Contains("/etc/hosts"))
+	assert.True(t, roots.Contains("/etc"))
+	assert.False(t, roots.Contains("/etcetera"))
+	assert.False(t, roots.Contains("/var/lib"))
+
+	// without roots only paths in home are tracked
+	var none *Roots
+	assert.False(t, none.Contains("/etc/hosts"))
+}
+
+func TestRootPaths(t *testing.T) {
+	home := getTemporaryHome()
+
+	roots, err := NewRoots(map[string]string{"etc": "/etc", "nginx": "/etc/nginx"}, "")
+	require.NoError(t, err)
+
+	// the deepest root is preferred
+	assert.Equal(t, "root:etc/hosts", stripHome("/etc/hosts", home, roots))
+	assert.Equal(t, "root:nginx/sites/default", stripHome("/etc/nginx/sites/default", home, roots))
+	assert.Equal(t, "root:etc/ssh/", stripHome("/etc/ssh/", home, roots))
+	assert.Equal(t, ".zshrc", stripHome(filepath.Join(home, ".zshrc"), home, roots))
+
+	assert.Equal(t, "/etc/nginx/sites/default", localPath(home, "root:nginx/sites/default", roots))
+	assert.Equal(t, "/etc", localPath(home, "root:etc", roots))
+	assert.Equal(t, filepath.Join(home, ".zshrc"), localPath(home, ".zshrc", roots))
+
+	assert.Equal(t, "dotfiles.root:nginx.sites", pathToTag("root:nginx/sites/"))
+
+	dir, err := tagTitleToFSDir("dotfiles.root:nginx.sites", home, roots)
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/nginx/sites/", dir)
+
+	// notes in roots that aren't set are left alone
+	dir, err = tagTitleToFSDir("dotfiles.root:srv.www", home, roots)
+	require.NoError(t, err)
+	assert.Empty(t, dir)
+
+	dir, err = tagTitleToFSDir("dotfiles.root:nginx.sites", home, nil)
+	require.NoError(t, err)
+	assert.Empty(t, dir)
+}
+
+func TestPrivileged(t *testing.T) {
+	root, err := ioutil.TempDir("", "root")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(root)
+
+	roots, err := NewRoots(map[string]string{"test": root}, "")
+	require.NoError(t, err)
+
+	path := filepath.Join(root, "hosts")
+	denied := &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+
+	// other errors, and paths outside roots, are returned as they are
+	other := errors.New("other")
+	assert.Equal(t, other, roots.privileged(other, path, "rm", "-f", path))
+	assert.Equal(t, denied, roots.privileged(denied, "/var/hosts", "rm", "-f", "/var/hosts"))
+
+	err = roots.privileged(denied, path, "rm", "-f", path)
+	assert.True(t, errors.Is(err, os.ErrPermission))
+	assert.Contains(t, err.Error(), "privilege_helper")
+
+	orig := runPrivileged
+
+	defer func() { runPrivileged = orig }()
+
+	var ran []string
+
+	runPrivileged = func(helper string, args ...string) error {
+		ran = append([]string{helper}, args...)
+		return nil
+	}
+
+	roots.PrivilegeHelper = "sudo"
+
+	var before bool
+
+	require.NoError(t, roots.withBeforeHelper(func() { before = true }).privileged(denied, path, "rm", "-f", path))
+	assert.Equal(t, "sudo rm -f "+path, strings.Join(ran, " "))
+	assert.True(t, before)
+}
+
+func TestWriteLocalFilePrivileged(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission is never denied to root")
+	}
+
+	root, err := ioutil.TempDir("", "root")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "hosts")
+	require.NoError(t, ioutil.WriteFile(path, []byte("old"), 0o640))
+	require.NoError(t, os.Chmod(root, 0o555))
+
+	defer func() { _ = os.Chmod(root, 0o755) }()
+
+	roots, err := NewRoots(map[string]string{"test": root}, "sudo")
+	require.NoError(t, err)
+
+	orig := runPrivileged
+
+	defer func() { runPrivileged = orig }()
+
+	var ran []string
+
+	runPrivileged = func(helper string, args ...string) error {
+		ran = args
+		return nil
+	}
+
+	require.NoError(t, writeLocalFile(path, "new", 0, false, roots))
+	require.Len(t, ran, 9)
+
+	// the owner, group and mode of the file replaced are kept
+	assert.Equal(t, []string{"install", "-o", strconv.Itoa(os.Getuid()), "-g", strconv.Itoa(os.Getgid()), "-m", "0640"}, ran[:7])
+	assert.Equal(t, path, ran[8])
+}
@@ -0,0 +1,212 @@
+package sndotfiles
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	// ServiceName is the name of the systemd user service and timer that sync on a schedule
+	ServiceName = SNAppName + "-sync"
+	// DefaultServiceSchedule is when the timer runs sync, as a systemd calendar event
+	DefaultServiceSchedule = "hourly"
+)
+
+// systemctl runs systemctl for the user's service manager, returning its output
+// a variable so it can be replaced in tests
+var systemctl = func(args ...string) (string, error) {
+	out, err := exec.Command("systemctl", append([]string{"--user", "--no-pager"}, args...)...).CombinedOutput()
+
+	return string(out), err
+}
+
+type ServiceInput struct {
+	// Executable is the path of the binary to run, defaulting to the running binary
+	Executable string
+	// Args are the global options to run sync with, before the command
+	Args []string
+	// Exclude is passed to sync
+	Exclude []string
+	// Schedule is a systemd calendar event, defaulting to DefaultServiceSchedule
+	Schedule string
+	// UnitDir is where the units are written, defaulting to the user's systemd unit directory
+	UnitDir string
+}
+
+// serviceUnitDir returns the directory systemd loads the user's units from
+func serviceUnitDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "systemd", "user"), nil
+}
+
+// systemdQuote quotes an argument for an ExecStart line, escaping specifiers
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;$") {
+		return arg
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`)
+
+	return `"` + r.Replace(arg) + `"`
+}
+
+func serviceUnit(executable string, args, exclude []string) string {
+	command := []string{systemdQuote(executable)}
+	for _, arg := range args {
+		command = append(command, systemdQuote(arg))
+	}
+
+	command = append(command, "sync")
+	for _, path := range exclude {
+		command = append(command, "--exclude", systemdQuote(path))
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=Sync dotfiles with Standard Notes
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, strings.Join(command, " "))
+}
+
+func timerUnit(schedule string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Sync dotfiles with Standard Notes on a schedule
+
+[Timer]
+OnCalendar=%s
+RandomizedDelaySec=5m
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, schedule)
+}
+
+func checkSystemd() error {
+	if runtime.GOOS != "linux" {
+		return errors.New("services are only supported with systemd on Linux")
+	}
+
+	return nil
+}
+
+// InstallService writes a systemd user service that syncs, and a timer that runs it on a schedule, then enables the timer
+// the service uses the session stored in the keyring, so one must have been added without a key
+func InstallService(si ServiceInput) (msg string, err error) {
+	if err = checkSystemd(); err != nil {
+		return
+	}
+
+	if si.Executable == "" {
+		if si.Executable, err = os.Executable(); err != nil {
+			return
+		}
+
+		if si.Executable, err = filepath.EvalSymlinks(si.Executable); err != nil {
+			return
+		}
+	}
+
+	if si.Schedule == "" {
+		si.Schedule = DefaultServiceSchedule
+	}
+
+	if si.UnitDir == "" {
+		if si.UnitDir, err = serviceUnitDir(); err != nil {
+			return
+		}
+	}
+
+	if err = os.MkdirAll(si.UnitDir, 0o755); err != nil {
+		return
+	}
+
+	servicePath := filepath.Join(si.UnitDir, ServiceName+".service")
+	if err = ioutil.WriteFile(servicePath, []byte(serviceUnit(si.Executable, si.Args, si.Exclude)), 0o644); err != nil {
+		return
+	}
+
+	timerPath := filepath.Join(si.UnitDir, ServiceName+".timer")
+	if err = ioutil.WriteFile(timerPath, []byte(timerUnit(si.Schedule)), 0o644); err != nil {
+		return
+	}
+
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", ServiceName + ".timer"}} {
+		if out, sErr := systemctl(args...); sErr != nil {
+			return msg, fmt.Errorf("systemctl %s failed: %w: %s", strings.Join(args, " "), sErr, strings.TrimSpace(out))
+		}
+	}
+
+	return fmt.Sprintf("installed %s and %s\nsyncing %s", servicePath, timerPath, si.Schedule), err
+}
+
+// UninstallService disables the timer and removes the units written by InstallService
+func UninstallService(unitDir string) (msg string, err error) {
+	if err = checkSystemd(); err != nil {
+		return
+	}
+
+	if unitDir == "" {
+		if unitDir, err = serviceUnitDir(); err != nil {
+			return
+		}
+	}
+
+	servicePath := filepath.Join(unitDir, ServiceName+".service")
+	timerPath := filepath.Join(unitDir, ServiceName+".timer")
+
+	if !pathExists(servicePath) && !pathExists(timerPath) {
+		return "service not installed", nil
+	}
+
+	// the timer may already have been disabled
+	_, _ = systemctl("disable", "--now", ServiceName+".timer")
+
+	for _, path := range []string{timerPath, servicePath} {
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+
+	if out, sErr := systemctl("daemon-reload"); sErr != nil {
+		return msg, fmt.Errorf("systemctl daemon-reload failed: %w: %s", sErr, strings.TrimSpace(out))
+	}
+
+	return fmt.Sprintf("removed %s and %s", servicePath, timerPath), nil
+}
+
+// ServiceStatus returns the state of the timer and the service's last run, along with its most recent log lines
+func ServiceStatus() (msg string, err error) {
+	if err = checkSystemd(); err != nil {
+		return
+	}
+
+	out, err := systemctl("status", ServiceName+".timer", ServiceName+".service")
+	if err != nil {
+		// systemctl exits non-zero when units are inactive, which is expected between runs
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return msg, fmt.Errorf("failed to run systemctl: %w", err)
+		}
+
+		err = nil
+	}
+
+	return strings.TrimRight(out, "\n"), err
+}
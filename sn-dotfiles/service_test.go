@@ -0,0 +1,70 @@
+package sndotfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdQuote(t *testing.T) {
+	assert.Equal(t, "/usr/bin/sn-dotfiles", systemdQuote("/usr/bin/sn-dotfiles"))
+	assert.Equal(t, `"/home/me/my files/.x"`, systemdQuote("/home/me/my files/.x"))
+	assert.Equal(t, "100%%", systemdQuote("100%"))
+	assert.Equal(t, `"a\"b$$c"`, systemdQuote(`a"b$c`))
+	assert.Equal(t, `""`, systemdQuote(""))
+}
+
+func TestInstallAndUninstallService(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd only")
+	}
+
+	var calls [][]string
+
+	defer func(orig func(args ...string) (string, error)) { systemctl = orig }(systemctl)
+
+	systemctl = func(args ...string) (string, error) {
+		calls = append(calls, args)
+		return "", nil
+	}
+
+	unitDir := getTemporaryHome()
+
+	defer os.RemoveAll(unitDir)
+
+	_, err := InstallService(ServiceInput{
+		Executable: "/usr/bin/sn-dotfiles",
+		Args:       []string{"--use-session", "--quiet", "--no-stdout"},
+		Exclude:    []string{"/home/me/.secret"},
+		UnitDir:    unitDir,
+	})
+	require.NoError(t, err)
+
+	service, err := ioutil.ReadFile(filepath.Join(unitDir, ServiceName+".service"))
+	require.NoError(t, err)
+	assert.Contains(t, string(service),
+		"ExecStart=/usr/bin/sn-dotfiles --use-session --quiet --no-stdout sync --exclude /home/me/.secret\n")
+
+	timer, err := ioutil.ReadFile(filepath.Join(unitDir, ServiceName+".timer"))
+	require.NoError(t, err)
+	assert.Contains(t, string(timer), "OnCalendar=hourly\n")
+
+	assert.Equal(t, [][]string{{"daemon-reload"}, {"enable", "--now", ServiceName + ".timer"}}, calls)
+
+	calls = nil
+
+	_, err = UninstallService(unitDir)
+	require.NoError(t, err)
+	assert.False(t, pathExists(filepath.Join(unitDir, ServiceName+".service")))
+	assert.False(t, pathExists(filepath.Join(unitDir, ServiceName+".timer")))
+	assert.Equal(t, [][]string{{"disable", "--now", ServiceName + ".timer"}, {"daemon-reload"}}, calls)
+
+	msg, err := UninstallService(unitDir)
+	require.NoError(t, err)
+	assert.Equal(t, "service not installed", msg)
+}
@@ -2,40 +2,29 @@ package sndotfiles
 
 import (
 	"fmt"
-	"github.com/briandowns/spinner"
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/ryanuber/columnize"
-	"os"
-	"time"
 )
 
 // Status compares and then outputs status of all items (or a subset defined by Paths param):
 // - local items that missing
 // - local items that are newer
 // - remote items that are newer
+// - items deleted locally or remotely since the last sync
+// - items changed both locally and remotely since the last sync
 // - local items that are untracked (if Paths specified)
 // - identical local and remote items
-func Status(session *cache.Session, home string, paths []string, pageSize int, debug bool, useStdErr bool) (diffs []ItemDiff, msg string, err error) {
+// if quiet is set, nothing is written to stdout or stderr
+func Status(session *cache.Session, home string, roots *Roots, paths []string, templateVars map[string]string, pageSize int, debug, quiet, useStdErr bool) (diffs []ItemDiff, msg string, err error) {
 	// preflight checks
 	paths, err = preflight(home, paths)
 	if err != nil {
 		return
 	}
 
-	if !debug {
-		prefix := HiWhite("syncing ")
-		if _, err = os.Stat(session.CacheDBPath); os.IsNotExist(err) {
-			prefix = HiWhite("initializing ")
-		}
-
-		s := spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stdout))
-		if useStdErr {
-			s = spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stderr))
-		}
-
-		s.Prefix = prefix
-		s.Start()
-		defer s.Stop()
+	if !debug && !quiet {
+		stop := startSpinner(session, useStdErr)
+		defer stop()
 	}
 
 	// get populated db
@@ -56,10 +45,17 @@ func Status(session *cache.Session, home string, paths []string, pageSize int, d
 		return diffs, msg, err
 	}
 
-	return status(remote, home, paths, debug)
+	var bases syncBases
+
+	bases, err = loadSyncBases(cso.DB)
+	if err != nil {
+		return diffs, msg, err
+	}
+
+	return status(remote, home, roots, paths, templateVars, bases, debug)
 }
 
-func status(twn tagsWithNotes, home string, paths []string, debug bool) (diffs []ItemDiff, msg string, err error) {
+func status(twn tagsWithNotes, home string, roots *Roots, paths []string, templateVars map[string]string, bases syncBases, debug bool) (diffs []ItemDiff, msg string, err error) {
 	debugPrint(debug, fmt.Sprintf("status | %d remote items", len(twn)))
 
 	err = checkNoteTagConflicts(twn)
@@ -72,11 +68,16 @@ func status(twn tagsWithNotes, home string, paths []string, debug bool) (diffs [
 		return
 	}
 
-	diffs, err = compare(twn, home, paths, []string{}, debug)
+	diffs, err = compare(twn, home, roots, paths, []string{}, templateVars, debug)
 	if err != nil {
 		return diffs, msg, err
 	}
 
+	diffs = applySyncBases(diffs, bases, debug)
+
+	remoteDeletedItems, _ := findRemoteDeleted(twn, bases, home, roots, paths, debug)
+	diffs = append(diffs, remoteDeletedItems...)
+
 	debugPrint(debug, fmt.Sprintf("status | %d diffs generated", len(diffs)))
 
 	if len(diffs) == 0 {
@@ -86,10 +87,29 @@ func status(twn tagsWithNotes, home string, paths []string, debug bool) (diffs [
 	lines := make([]string, len(diffs))
 
 	for i, diff := range diffs {
-		lines[i] = fmt.Sprintf("%s | %s \n", bold(diff.homeRelPath), colourDiff(diff.diff))
+		lines[i] = fmt.Sprintf("%s | %s \n", bold(diff.homeRelPath), colourDiff(displayDiff(diff)))
+		if diff.err != nil {
+			lines[i] = fmt.Sprintf("%s | %s \n", bold(diff.homeRelPath), red(fmt.Sprintf("%s: %s", failed, diff.err)))
+		}
 	}
 
 	msg = columnize.SimpleFormat(lines)
 
+	if pending := tagsNeedingMigration(twn, home, roots); len(pending) > 0 {
+		msg += fmt.Sprintf("\n%s\n", yellow(fmt.Sprintf("%d tag(s) need migrating with 'migrate-tags'", len(pending))))
+	}
+
 	return diffs, msg, err
 }
+
+// Drifted returns whether any tracked item differs between local and remote, including being missing or deleted on either side
+// untracked items are not drift
+func Drifted(diffs []ItemDiff) bool {
+	for _, d := range diffs {
+		if d.diff != identical && d.diff != untracked {
+			return true
+		}
+	}
+
+	return false
+}
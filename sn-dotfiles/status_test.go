@@ -13,7 +13,7 @@ import (
 
 func TestStatusEmptyTWN(t *testing.T) {
 	home := getTemporaryHome()
-	_, msg, _ := status(tagsWithNotes{}, home, []string{}, true)
+	_, msg, _ := status(tagsWithNotes{}, home, nil, []string{}, nil, nil, true)
 	assert.Equal(t, "no dotfiles being tracked", msg)
 }
 
@@ -59,7 +59,7 @@ func TestStatus(t *testing.T) {
 	var diffs []ItemDiff
 	var err error
 
-	diffs, _, err = status(twn, home, []string{gitConfigPath, applePath, yellowPath, premiumPath}, true)
+	diffs, _, err = status(twn, home, nil, []string{gitConfigPath, applePath, yellowPath, premiumPath}, nil, nil, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 4)
 	var pDiff int
@@ -111,7 +111,7 @@ func TestStatus1(t *testing.T) {
 
 	twn := tagsWithNotes{dotfilesTagWithNote, awsTagWithNotes}
 
-	diffs, _, err := status(twn, home, []string{gitConfigPath}, true)
+	diffs, _, err := status(twn, home, nil, []string{gitConfigPath}, nil, nil, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 1)
 	assert.Equal(t, ".gitconfig", diffs[0].noteTitle)
@@ -177,7 +177,7 @@ func TestStatus2(t *testing.T) {
 
 	var diffs []ItemDiff
 
-	diffs, _, err = status(twn, home, []string{fmt.Sprintf("%s/.fruit", home), fmt.Sprintf("%s/.cars", home)}, true)
+	diffs, _, err = status(twn, home, nil, []string{fmt.Sprintf("%s/.fruit", home), fmt.Sprintf("%s/.cars", home)}, nil, nil, true)
 	assert.NoError(t, err)
 	assert.Len(t, diffs, 4)
 	var pDiff int
@@ -211,3 +211,11 @@ func TestStatus2(t *testing.T) {
 	}
 	assert.Equal(t, 4, pDiff)
 }
+
+func TestDrifted(t *testing.T) {
+	assert.False(t, Drifted(nil))
+	assert.False(t, Drifted([]ItemDiff{{diff: identical}, {diff: untracked}}))
+	assert.True(t, Drifted([]ItemDiff{{diff: identical}, {diff: localMissing}}))
+	assert.True(t, Drifted([]ItemDiff{{diff: remoteDeleted}}))
+	assert.True(t, Drifted([]ItemDiff{{diff: conflict}}))
+}
@@ -0,0 +1,142 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"github.com/jonhadfield/gosn-v2"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SymlinksTrack stores a symlink as a note containing its target
+	SymlinksTrack = "track"
+	// SymlinksFollow stores the content of the file a symlink points to
+	SymlinksFollow = "follow"
+)
+
+func symlinkModeValid(mode string) bool {
+	return StringInSlice(mode, []string{"", SymlinksTrack, SymlinksFollow}, true)
+}
+
+func isSymlink(path string) bool {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeSymlink != 0
+}
+
+// symlinkPathValid checks a symlink can be added with the specified symlink mode
+func symlinkPathValid(path, symlinkMode string) (valid bool, err error) {
+	switch symlinkMode {
+	case SymlinksTrack:
+		return true, nil
+	case SymlinksFollow:
+		var target string
+
+		target, err = filepath.EvalSymlinks(path)
+		if err != nil {
+			return false, fmt.Errorf("failed to follow symlink: %s", path)
+		}
+
+		if t, _ := getPathType(target); t != "file" {
+			return false, fmt.Errorf("symlink does not point to a file: %s", path)
+		}
+
+		return pathValid(target)
+	default:
+		return pathValid(path)
+	}
+}
+
+func createSymlinkItem(path, title string) (item gosn.Note, err error) {
+	var target string
+
+	target, err = os.Readlink(path)
+	if err != nil {
+		return
+	}
+
+	item = gosn.NewNote()
+	itemContent := gosn.NewNoteContent()
+	item.Content = *itemContent
+	item.Content.SetTitle(title)
+	item.Content.SetText(target)
+	// prevent a default editor parsing as html when selected via app
+	item.Content.SetPrefersPlainEditor(true)
+	setNoteMeta(&item, noteMeta{Symlink: true})
+
+	return item, err
+}
+
+func compareSymlinkWithNote(tagTitle, path, home string, roots *Roots, remote gosn.Note, debug bool) ItemDiff {
+	debugPrint(debug, fmt.Sprintf("compareSymlinkWithNote | title: %s path: <home>/%s",
+		tagTitle, stripHome(path, home, roots)))
+
+	itemDiff := ItemDiff{
+		tagTitle:    tagTitle,
+		path:        path,
+		homeRelPath: stripHome(path, home, roots),
+		noteTitle:   remote.Content.GetTitle(),
+		symlink:     true,
+		remote:      remote,
+	}
+
+	localStat, err := os.Lstat(path)
+	if err != nil {
+		return itemDiff.fail(err)
+	}
+
+	// refuse to choose between a symlink and an existing file or directory
+	if localStat.Mode()&os.ModeSymlink == 0 {
+		debugPrint(debug, fmt.Sprintf("compareSymlinkWithNote | <home>/%s is not a symlink", itemDiff.homeRelPath))
+		itemDiff.diff = conflict
+
+		return itemDiff
+	}
+
+	itemDiff.local, err = os.Readlink(path)
+	if err != nil {
+		return itemDiff.fail(err)
+	}
+
+	if itemDiff.local == remote.Content.GetText() {
+		itemDiff.diff = identical
+
+		return itemDiff
+	}
+
+	remoteUpdated, err := time.Parse("2006-01-02T15:04:05.000Z", remote.UpdatedAt)
+	if err != nil {
+		return itemDiff.fail(fmt.Errorf("failed to parse update time of note: %w", err))
+	}
+
+	itemDiff.diff = remoteNewer
+	if !localStat.ModTime().UTC().Before(remoteUpdated.UTC()) {
+		itemDiff.diff = localNewer
+	}
+
+	return itemDiff
+}
+
+// createLocalSymlink replaces any existing symlink at the item's path with one pointing to the remote target
+func createLocalSymlink(item ItemDiff, roots *Roots) error {
+	if stat, err := os.Lstat(item.path); err == nil {
+		if stat.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("refusing to replace non-symlink with symlink: %s", item.path)
+		}
+	}
+
+	return symlinkLocal(item.remote.Content.GetText(), item.path, roots)
+}
+
+// displayDiff returns the diff to show for an item, with symlink changes shown as target changes
+func displayDiff(itemDiff ItemDiff) string {
+	if itemDiff.symlink && (itemDiff.diff == localNewer || itemDiff.diff == remoteNewer) {
+		return targetChanged
+	}
+
+	return itemDiff.diff
+}
@@ -0,0 +1,97 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymlinkPathValid(t *testing.T) {
+	home := getTemporaryHome()
+	applePath := fmt.Sprintf("%s/.fruit/apple", home)
+	require.NoError(t, createPathWithContent(applePath, "apple content"))
+	fileLinkPath := fmt.Sprintf("%s/.apple", home)
+	require.NoError(t, os.Symlink(applePath, fileLinkPath))
+	dirLinkPath := fmt.Sprintf("%s/.fruits", home)
+	require.NoError(t, os.Symlink(fmt.Sprintf("%s/.fruit", home), dirLinkPath))
+
+	_, err := symlinkPathValid(fileLinkPath, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "symlink not supported")
+
+	v, err := symlinkPathValid(dirLinkPath, SymlinksTrack)
+	assert.NoError(t, err)
+	assert.True(t, v)
+
+	v, err = symlinkPathValid(fileLinkPath, SymlinksFollow)
+	assert.NoError(t, err)
+	assert.True(t, v)
+
+	_, err = symlinkPathValid(dirLinkPath, SymlinksFollow)
+	assert.Error(t, err)
+
+	paths, err := getLocalFSPaths([]string{fileLinkPath, dirLinkPath}, false, SymlinksTrack, nil)
+	assert.NoError(t, err)
+	assert.Len(t, paths, 2)
+}
+
+func TestCompareSymlinkWithNote(t *testing.T) {
+	home := getTemporaryHome()
+	require.NoError(t, os.MkdirAll(home, os.ModePerm))
+	linkPath := fmt.Sprintf("%s/.apple", home)
+	require.NoError(t, os.Symlink("/shared/apple", linkPath))
+
+	note, err := createSymlinkItem(linkPath, ".apple")
+	require.NoError(t, err)
+	assert.Equal(t, "/shared/apple", note.Content.GetText())
+	assert.True(t, getNoteMeta(note).Symlink)
+
+	iDiff := compareSymlinkWithNote(DotFilesTag, linkPath, home, nil, note, true)
+	assert.Equal(t, identical, iDiff.diff)
+	assert.True(t, iDiff.symlink)
+
+	note.Content.SetText("/shared/lemon")
+	iDiff = compareSymlinkWithNote(DotFilesTag, linkPath, home, nil, note, true)
+	assert.Equal(t, targetChanged, displayDiff(iDiff))
+
+	// pulling should repoint the symlink
+	require.NoError(t, createLocal([]ItemDiff{iDiff}, "", nil))
+	target, err := os.Readlink(linkPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "/shared/lemon", target)
+
+	// a regular file should never be replaced by a symlink
+	filePath := fmt.Sprintf("%s/.lemon", home)
+	require.NoError(t, createPathWithContent(filePath, "lemon content"))
+	iDiff = compareSymlinkWithNote(DotFilesTag, filePath, home, nil, note, true)
+	assert.Equal(t, conflict, iDiff.diff)
+	assert.Error(t, createLocal([]ItemDiff{iDiff}, "", nil))
+}
+
+func TestCompareSymlinkWithNoteFailed(t *testing.T) {
+	home := getTemporaryHome()
+	require.NoError(t, os.MkdirAll(home, os.ModePerm))
+	linkPath := fmt.Sprintf("%s/.apple", home)
+	require.NoError(t, os.Symlink("/shared/apple", linkPath))
+
+	note, err := createSymlinkItem(linkPath, ".apple")
+	require.NoError(t, err)
+	note.Content.SetText("/shared/lemon")
+	note.UpdatedAt = "invalid"
+
+	// the item is reported as failed rather than the comparison exiting
+	iDiff := compareSymlinkWithNote(DotFilesTag, linkPath, home, nil, note, true)
+	assert.Equal(t, failed, iDiff.diff)
+	assert.Error(t, iDiff.err)
+
+	result := newResult(iDiff, ActionNone)
+	assert.Contains(t, result.Error, "failed to parse update time")
+	assert.True(t, Failed([]Result{result}))
+
+	iDiff = compareSymlinkWithNote(DotFilesTag, fmt.Sprintf("%s/.missing", home), home, nil, note, true)
+	assert.Equal(t, failed, iDiff.diff)
+	assert.Error(t, iDiff.err)
+}
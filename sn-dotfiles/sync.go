@@ -4,12 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/asdine/storm/v3"
-	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
 	"github.com/jonhadfield/gosn-v2/cache"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/ryanuber/columnize"
 )
@@ -21,41 +19,42 @@ var (
 // Sync compares local and remote items and then:
 // - pulls remotes if locals are older or missing
 // - pushes locals if remotes are newer
+// - removes remotes deleted locally since the last sync
+// - moves locals deleted remotely since the last sync to the trash
+// - leaves items that changed on both sides since the last sync untouched
+// - never pushes local changes to templated items, which are rendered from their notes
+// if DryRun is set, the changes are reported without being made
 func Sync(si SNDotfilesSyncInput, useStdErr bool) (so SyncOutput, err error) {
 	if err = checkPathsExist(si.Exclude); err != nil {
 		return
 	}
 
-	if !si.Debug {
-		prefix := HiWhite("syncing ")
-		if _, err = os.Stat(si.Session.CacheDBPath); os.IsNotExist(err) {
-			prefix = HiWhite("initializing ")
-		}
+	roots := si.Roots
 
-		s := spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stdout))
-		if useStdErr {
-			s = spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stderr))
-		}
+	// the spinner would draw over the prompts, and fill logs when not run in a terminal
+	if !si.Debug && !si.Interactive {
+		stop := startSpinner(si.Session, useStdErr)
+		defer stop()
 
-		s.Prefix = prefix
-		s.Start()
-		defer s.Stop()
+		// or over the privilege helper asking for a password
+		roots = roots.withBeforeHelper(stop)
 	}
 
 	output, err := sync(syncInput{
-		session: si.Session,
-		home:    si.Home,
-		paths:   si.Paths,
-		exclude: si.Exclude,
-		debug:   si.Debug,
-		close:   false,
+		session:      si.Session,
+		home:         si.Home,
+		roots:        roots,
+		paths:        si.Paths,
+		exclude:      si.Exclude,
+		templateVars: si.TemplateVars,
+		debug:        si.Debug,
+		close:        false,
+		dryRun:       si.DryRun,
+		interactive:  si.Interactive,
+		progress:     si.Progress,
 	})
 
-	return SyncOutput{
-		NoPushed: output.noPushed,
-		NoPulled: output.noPulled,
-		Msg:      output.msg,
-	}, err
+	return output.export(), err
 }
 
 func sync(input syncInput) (output syncOutput, err error) {
@@ -83,13 +82,21 @@ func sync(input syncInput) (output syncOutput, err error) {
 	}
 
 	output, err = syncDBwithFS(syncInput{
-		db:      cso.DB,
-		session: input.session,
-		twn:     remote,
-		home:    input.home,
-		paths:   input.paths,
-		exclude: input.exclude,
-		debug:   input.debug})
+		db:           cso.DB,
+		session:      input.session,
+		twn:          remote,
+		home:         input.home,
+		roots:        input.roots,
+		paths:        input.paths,
+		exclude:      input.exclude,
+		templateVars: input.templateVars,
+		debug:        input.debug,
+		dryRun:       input.dryRun,
+		makePlan:     input.makePlan,
+		plan:         input.plan,
+		interactive:  input.interactive,
+		direction:    input.direction,
+		progress:     input.progress})
 	if err != nil {
 
 		return
@@ -99,6 +106,11 @@ func sync(input syncInput) (output syncOutput, err error) {
 		return
 	}
 
+	// leave the remote untouched
+	if input.dryRun || input.makePlan {
+		return
+	}
+
 	// TODO: Check every editor component and ensure no dotfiles are associated (ensure plain text editor)
 
 	// persist changes
@@ -111,73 +123,289 @@ func sync(input syncInput) (output syncOutput, err error) {
 type SNDotfilesSyncInput struct {
 	Session        *cache.Session
 	Home           string
+	Roots          *Roots
 	Paths, Exclude []string
+	TemplateVars   map[string]string
 	PageSize       int
 	Debug          bool
+	DryRun         bool
+	// Interactive asks what to do with each item to be changed, and each conflict, before syncing
+	Interactive bool
+	// Progress, if set, is called with the result for each path as its change is made, so results can be streamed
+	Progress func(Result)
 }
 type SyncOutput struct {
-	NoPushed, NoPulled int
-	Msg                string
+	NoPushed, NoPulled, NoDeleted, NoTrashed int
+	Results                                  []Result
+	Msg                                      string
 }
 
 func syncDBwithFS(si syncInput) (so syncOutput, err error) {
 	if si.db == nil {
 		panic("didn't get db sent to syncDBwithFS")
 	}
+
+	var actions syncActions
+
+	actions, err = classifySync(si)
+	if err != nil {
+		return
+	}
+
+	actions = actions.only(si.direction)
+
+	switch {
+	case si.dryRun:
+		so = planSync(actions)
+
+		if si.progress != nil {
+			for _, result := range so.results {
+				si.progress(result)
+			}
+		}
+
+		return so, err
+	case si.makePlan:
+		so.plan = newSyncPlan(si.home, actions)
+		so.msg = planSync(actions).msg
+
+		return so, err
+	case si.plan != nil:
+		// only act on the planned items, and only if nothing has changed since they were planned
+		actions, err = actionsForPlan(*si.plan, si.home, actions)
+		if err != nil {
+			return
+		}
+	case si.interactive:
+		actions, err = resolveInteractively(actions)
+		if err != nil {
+			return
+		}
+	}
+
+	return executeSync(si, actions)
+}
+
+const (
+	directionPush = "push"
+	directionPull = "pull"
+)
+
+// only returns the actions that change remotes, for push, or locals, for pull, or all actions if direction isn't set
+func (sa syncActions) only(direction string) syncActions {
+	switch direction {
+	case directionPush:
+		sa.pull, sa.trash, sa.merged = nil, nil, nil
+	case directionPull:
+		sa.push, sa.remove, sa.merged = nil, nil, nil
+	}
+
+	return sa
+}
+
+// syncActions holds the items a sync acts on, classified by what will be done with them
+type syncActions struct {
+	push, pull, remove, trash []ItemDiff
+	// items whose local content was merged with the remote, to be both pushed and written locally
+	merged                 []ItemDiff
+	identical, conflicting []ItemDiff
+	notPushed              []ItemDiff
+	// items that couldn't be compared, so are left untouched
+	failed []ItemDiff
+	// paths deleted both locally and remotely since the last sync
+	gone  []string
+	bases syncBases
+}
+
+func (sa syncActions) itemsToSync() bool {
+	return len(sa.push)+len(sa.pull)+len(sa.merged)+len(sa.remove)+len(sa.trash) > 0
+}
+
+// classifySync compares local and remote items and determines what a sync should do with each
+func classifySync(si syncInput) (actions syncActions, err error) {
+	actions.bases, err = loadSyncBases(si.db)
+	if err != nil {
+		return
+	}
+
+	// paths are also used to find items deleted remotely, so are tidied up before comparing
+	si.paths, err = preflight(si.home, si.paths)
+	if err != nil {
+		return
+	}
+
 	var itemDiffs []ItemDiff
 
-	itemDiffs, err = compare(si.twn, si.home, si.paths, si.exclude, si.debug)
+	itemDiffs, err = compare(si.twn, si.home, si.roots, si.paths, si.exclude, si.templateVars, si.debug)
 	if err != nil {
-		if strings.Contains(err.Error(), "tags with notes not supplied") {
+		if !strings.Contains(err.Error(), "tags with notes not supplied") {
+			return
+		}
+
+		// with nothing tracked remotely, the only thing left to do is propagate remote deletions
+		if len(actions.bases) == 0 {
 			err = errors.New("no remote dotfiles found")
+			return
 		}
 
-		return
+		err = nil
 	}
 
-	var itemsToPush, itemsToPull []ItemDiff
+	itemDiffs = applySyncBases(itemDiffs, actions.bases, si.debug)
+
+	var remoteDeletedItems []ItemDiff
+
+	remoteDeletedItems, actions.gone = findRemoteDeleted(si.twn, actions.bases, si.home, si.roots, si.paths, si.debug)
+	itemDiffs = append(itemDiffs, remoteDeletedItems...)
+
+	ig := newIgnorer(si.home)
 
-	var itemsToSync bool
 	for _, itemDiff := range itemDiffs {
 		// check if itemDiff is for a path to be excluded
-		if matchesPathsToExclude(si.home, itemDiff.homeRelPath, si.exclude) {
+		if matchesPathsToExclude(si.home, si.roots, itemDiff.homeRelPath, si.exclude, ig) {
 			debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | excluding: %s", itemDiff.homeRelPath))
 			continue
 		}
 
 		switch itemDiff.diff {
+		case identical:
+			actions.identical = append(actions.identical, itemDiff)
+		case conflict:
+			// neither side can be chosen automatically so leave both untouched
+			debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | %s changed locally and remotely", itemDiff.homeRelPath))
+			actions.conflicting = append(actions.conflicting, itemDiff)
 		case localNewer:
+			if itemDiff.template {
+				// pushing would replace the template with its rendered output
+				debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | local %s is newer but templated", itemDiff.homeRelPath))
+				actions.notPushed = append(actions.notPushed, itemDiff)
+
+				continue
+			}
 			//addToDB
 			debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | local %s is newer", itemDiff.homeRelPath))
-			itemDiff.remote.Content.SetText(itemDiff.local)
-			itemsToPush = append(itemsToPush, itemDiff)
-			itemsToSync = true
+			actions.push = append(actions.push, itemDiff)
+		case modeChanged:
+			if localModeChanged(itemDiff, actions.bases) {
+				debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | local %s mode changed", itemDiff.homeRelPath))
+				actions.push = append(actions.push, itemDiff)
+			} else {
+				debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | remote %s mode changed", itemDiff.homeRelPath))
+				actions.pull = append(actions.pull, itemDiff)
+			}
+		case localDeleted:
+			debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | %s was deleted locally", itemDiff.homeRelPath))
+			actions.remove = append(actions.remove, itemDiff)
+		case remoteDeleted:
+			debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | %s was deleted remotely", itemDiff.homeRelPath))
+			actions.trash = append(actions.trash, itemDiff)
 		case localMissing:
 			// createLocal
 			debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | %s is missing", itemDiff.homeRelPath))
-			itemsToPull = append(itemsToPull, itemDiff)
-			itemsToSync = true
+			actions.pull = append(actions.pull, itemDiff)
 		case remoteNewer:
 			// createLocal
 			debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | remote %s is newer", itemDiff.homeRelPath))
-			itemsToPull = append(itemsToPull, itemDiff)
-			itemsToSync = true
+			actions.pull = append(actions.pull, itemDiff)
+		case failed:
+			debugPrint(si.debug, fmt.Sprintf("syncDBwithFS | %s couldn't be compared: %s", itemDiff.homeRelPath, itemDiff.err))
+			actions.failed = append(actions.failed, itemDiff)
+		}
+	}
+
+	return actions, err
+}
+
+// executeSync makes the changes determined by classifySync
+func executeSync(si syncInput, actions syncActions) (so syncOutput, err error) {
+	// forget paths deleted on both sides
+	if err = forgetSyncBases(si.db, actions.gone); err != nil {
+		return
+	}
+
+	// record identical items so later changes can be attributed to one side
+	if err = recordSyncBases(si.db, actions.identical); err != nil {
+		return
+	}
+
+	strConflict := red("conflict")
+	strNotPushed := yellow("templated, not pushed")
+
+	failedLine := func(itemDiff ItemDiff) string {
+		return fmt.Sprintf("%s | %s", bold(itemDiff.homeRelPath), red(fmt.Sprintf("%s: %s", failed, itemDiff.err)))
+	}
+
+	// each result is reported as its change is made, so they can be streamed
+	report := func(itemDiff ItemDiff, action string, rErr error) {
+		result := newResult(itemDiff, action)
+		if rErr != nil {
+			result.Error = rErr.Error()
+		}
+
+		so.results = append(so.results, result)
+
+		if si.progress != nil {
+			si.progress(result)
+		}
+	}
+
+	reportAll := func(items []ItemDiff, action string) {
+		for _, itemDiff := range items {
+			report(itemDiff, action, nil)
 		}
 	}
 
 	// check items to sync
-	if !itemsToSync {
+	if !actions.itemsToSync() {
+		reportAll(actions.conflicting, ActionNone)
+		reportAll(actions.notPushed, ActionNone)
+		reportAll(actions.failed, ActionNone)
+		reportAll(actions.identical, ActionNone)
+
 		so.msg = fmt.Sprint(bold("nothing to do"))
+
+		if len(actions.conflicting) > 0 || len(actions.notPushed) > 0 || len(actions.failed) > 0 {
+			var lines []string
+			for _, conflictItem := range actions.conflicting {
+				lines = append(lines, fmt.Sprintf("%s | %s", bold(conflictItem.homeRelPath), strConflict))
+			}
+
+			for _, notPushedItem := range actions.notPushed {
+				lines = append(lines, fmt.Sprintf("%s | %s", bold(notPushedItem.homeRelPath), strNotPushed))
+			}
+
+			for _, failedItem := range actions.failed {
+				lines = append(lines, failedLine(failedItem))
+			}
+
+			so.msg = fmt.Sprint(columnize.SimpleFormat(lines))
+		}
+
 		return
 	}
 
+	// record the content being replaced so the run can be undone
+	jrnl := newJournal(actions.bases)
+
+	itemsToPush := actions.push
+
 	// addToDB
 	if len(itemsToPush) > 0 {
+		jrnl.pushing(itemsToPush)
+
+		preparePush(itemsToPush)
+
 		err = addToDB(si.db, si.session, itemsToPush, si.close)
 		if err != nil {
 			return
 		}
 		so.noPushed = len(itemsToPush)
+
+		if err = recordSyncBases(si.db, itemsToPush); err != nil {
+			return
+		}
+
+		reportAll(itemsToPush, ActionPushed)
 	}
 
 	res := make([]string, len(itemsToPush))
@@ -185,40 +413,236 @@ func syncDBwithFS(si syncInput) (so syncOutput, err error) {
 	strPulled := green("pulled")
 
 	for i, pushItem := range itemsToPush {
-		line := fmt.Sprintf("%s | %s", bold(addDot(pushItem.homeRelPath)), strPushed)
+		line := fmt.Sprintf("%s | %s", bold(pushItem.homeRelPath), strPushed)
 		res[i] = line
 	}
 
+	itemsToPull := actions.pull
+
+	// keep the versions of local files about to be overwritten
+	var backup string
+	if len(itemsToPull) > 0 || len(actions.merged) > 0 {
+		backup = backupDir(si.session)
+	}
+
+	jrnl.pulling(itemsToPull)
+
 	// create local
-	if err = createLocal(itemsToPull); err != nil {
+	var pulled []ItemDiff
+
+	for _, pullItem := range itemsToPull {
+		// a file that can't be written is reported, rather than stopping the others being synced
+		if pErr := createLocal([]ItemDiff{pullItem}, backup, si.roots); pErr != nil {
+			jrnl.forget(pullItem.homeRelPath)
+			report(pullItem, ActionNone, pErr)
+			res = append(res, fmt.Sprintf("%s | %s\n", bold(pullItem.homeRelPath), red("failed: "+pErr.Error())))
+
+			continue
+		}
+
+		pulled = append(pulled, pullItem)
+		report(pullItem, ActionPulled, nil)
+		res = append(res, fmt.Sprintf("%s | %s\n", bold(pullItem.homeRelPath), strPulled))
+	}
+
+	so.noPulled = len(pulled)
+
+	if err = recordSyncBases(si.db, pulled); err != nil {
 		return
 	}
 
-	so.noPulled = len(itemsToPull)
+	// push merged content and write it locally
+	if len(actions.merged) > 0 {
+		itemsMerged := actions.merged
+		jrnl.merging(itemsMerged)
 
-	for _, pullItem := range itemsToPull {
-		line := fmt.Sprintf("%s | %s\n", bold(addDot(pullItem.homeRelPath)), strPulled)
+		for i := range itemsMerged {
+			itemsMerged[i].remote.Content.SetText(itemsMerged[i].local)
+			setNoteMode(&itemsMerged[i].remote, itemsMerged[i].localMode)
+		}
+
+		if err = addToDB(si.db, si.session, itemsMerged, si.close); err != nil {
+			return
+		}
+
+		so.noPushed += len(itemsMerged)
+
+		var written []ItemDiff
+
+		for _, mergedItem := range itemsMerged {
+			// without a recorded base, the merged content is pulled by the next sync
+			if mErr := createLocal([]ItemDiff{mergedItem}, backup, si.roots); mErr != nil {
+				jrnl.forget(mergedItem.homeRelPath)
+				report(mergedItem, ActionNone, mErr)
+				res = append(res, fmt.Sprintf("%s | %s\n", bold(mergedItem.homeRelPath), red("failed: "+mErr.Error())))
+
+				continue
+			}
+
+			written = append(written, mergedItem)
+			report(mergedItem, ActionMerged, nil)
+			res = append(res, fmt.Sprintf("%s | %s\n", bold(mergedItem.homeRelPath), green("merged")))
+		}
+
+		if err = recordSyncBases(si.db, written); err != nil {
+			return
+		}
+	}
+
+	if backup != "" {
+		if err = pruneBackups(si.session, maxBackups); err != nil {
+			return
+		}
+	}
+
+	var deletedPaths []string
+
+	// remove remotes deleted locally
+	if len(actions.remove) > 0 {
+		jrnl.removing(actions.remove)
+
+		if err = deleteRemote(si.db, si.session, si.twn, actions.remove, si.debug); err != nil {
+			return
+		}
+
+		so.noDeleted = len(actions.remove)
+		reportAll(actions.remove, ActionRemoved)
+
+		for _, deleteItem := range actions.remove {
+			deletedPaths = append(deletedPaths, deleteItem.homeRelPath)
+			res = append(res, fmt.Sprintf("%s | %s\n", bold(deleteItem.homeRelPath), green("removed")))
+		}
+	}
+
+	// move locals deleted remotely to the trash
+	if len(actions.trash) > 0 {
+		trash := trashDir(si.session)
+
+		for _, trashItem := range actions.trash {
+			jrnl.trashing(trashItem)
+
+			// the base is kept for a file that can't be moved, so the next sync tries again
+			if tErr := moveToTrash(trashItem.path, si.home, si.roots, trash); tErr != nil {
+				jrnl.forget(trashItem.homeRelPath)
+				report(trashItem, ActionNone, tErr)
+				res = append(res, fmt.Sprintf("%s | %s\n", bold(trashItem.homeRelPath), red("failed: "+tErr.Error())))
+
+				continue
+			}
+
+			so.noTrashed++
+			deletedPaths = append(deletedPaths, trashItem.homeRelPath)
+			report(trashItem, ActionTrashed, nil)
+			res = append(res, fmt.Sprintf("%s | %s\n", bold(trashItem.homeRelPath), green("trashed")))
+		}
+	}
+
+	if err = forgetSyncBases(si.db, deletedPaths); err != nil {
+		return
+	}
+
+	if err = jrnl.save(si.db); err != nil {
+		return
+	}
+
+	for _, conflictItem := range actions.conflicting {
+		line := fmt.Sprintf("%s | %s\n", bold(conflictItem.homeRelPath), strConflict)
+		res = append(res, line)
+	}
+
+	for _, notPushedItem := range actions.notPushed {
+		line := fmt.Sprintf("%s | %s\n", bold(notPushedItem.homeRelPath), strNotPushed)
 		res = append(res, line)
 	}
 
+	for _, failedItem := range actions.failed {
+		res = append(res, failedLine(failedItem)+"\n")
+	}
+
+	reportAll(actions.conflicting, ActionNone)
+	reportAll(actions.notPushed, ActionNone)
+	reportAll(actions.failed, ActionNone)
+	reportAll(actions.identical, ActionNone)
+
 	so.msg = fmt.Sprint(columnize.SimpleFormat(res))
 
 	return so, err
 }
 
+// planSync reports what a sync would do with the classified items, without changing anything
+func planSync(actions syncActions) (so syncOutput) {
+	var lines []string
+
+	addLines := func(items []ItemDiff, action string) {
+		for _, item := range items {
+			lines = append(lines, fmt.Sprintf("%s | %s", bold(item.homeRelPath), action))
+		}
+	}
+
+	addLines(actions.push, yellow("would push"))
+	addLines(actions.pull, yellow("would pull"))
+	addLines(actions.remove, yellow("would remove"))
+	addLines(actions.trash, yellow("would trash"))
+	addLines(actions.conflicting, red("conflict"))
+	addLines(actions.notPushed, yellow("templated, not pushed"))
+
+	for _, item := range actions.failed {
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(item.homeRelPath), red(fmt.Sprintf("%s: %s", failed, item.err))))
+	}
+
+	so.noPushed = len(actions.push)
+	so.noPulled = len(actions.pull)
+	so.noDeleted = len(actions.remove)
+	so.noTrashed = len(actions.trash)
+	so.results = actions.results(true)
+
+	so.msg = fmt.Sprint(bold("nothing to do"))
+	if len(lines) > 0 {
+		so.msg = fmt.Sprint(columnize.SimpleFormat(lines))
+	}
+
+	return so
+}
+
 type syncInput struct {
 	db             *storm.DB
 	session        *cache.Session
 	twn            tagsWithNotes
 	home           string
+	roots          *Roots
 	paths, exclude []string
+	templateVars   map[string]string
 	debug          bool
 	close          bool
+	dryRun         bool
+	// makePlan records the changes as a plan rather than making them
+	makePlan bool
+	// plan restricts the changes made to those planned
+	plan *SyncPlan
+	// interactive asks the user what to do with each item to be changed
+	interactive bool
+	// direction limits the changes made to those pushing or pulling, if set
+	direction string
+	// progress is called with each result as its change is made
+	progress func(Result)
 }
 
 type syncOutput struct {
-	noPushed, noPulled int
-	msg                string
+	noPushed, noPulled, noDeleted, noTrashed int
+	results                                  []Result
+	msg                                      string
+	plan                                     SyncPlan
+}
+
+func (so syncOutput) export() SyncOutput {
+	return SyncOutput{
+		NoPushed:  so.noPushed,
+		NoPulled:  so.noPulled,
+		NoDeleted: so.noDeleted,
+		NoTrashed: so.noTrashed,
+		Results:   so.results,
+		Msg:       so.msg,
+	}
 }
 
 func ensureTrailingPathSep(in string) string {
@@ -229,10 +653,23 @@ func ensureTrailingPathSep(in string) string {
 	return in + string(os.PathSeparator)
 }
 
-func matchesPathsToExclude(home, path string, pathsToExclude []string) bool {
+// matchesPathsToExclude returns true if the home relative path is, or is within, a path to exclude, or is ignored
+func matchesPathsToExclude(home string, roots *Roots, path string, pathsToExclude []string, ig *ignorer) bool {
+	if ig.ignoredHomeRel(path) {
+		return true
+	}
+
 	for _, pte := range pathsToExclude {
-		homeStrippedPath := stripHome(pte, home)
+		homeStrippedPath := stripHome(pte, home, roots)
 		// return match if Paths match exactly
+		if isGlob(pte) {
+			if globMatches(expandHome(home, pte), localPath(home, path, roots)) {
+				return true
+			}
+
+			continue
+		}
+
 		if homeStrippedPath == path {
 			return true
 		}
@@ -244,3 +681,18 @@ func matchesPathsToExclude(home, path string, pathsToExclude []string) bool {
 
 	return false
 }
+
+// preparePush sets the notes of items being pushed to their local text and mode
+// including conflicts and remote changes the local versions were chosen over
+// a mode change leaves the text alone, as does a template, whose note holds the source rather than the rendered output
+func preparePush(itemDiffs []ItemDiff) {
+	for i := range itemDiffs {
+		if itemDiffs[i].diff != modeChanged && !itemDiffs[i].template {
+			itemDiffs[i].remote.Content.SetText(itemDiffs[i].local)
+		}
+
+		if !itemDiffs[i].symlink {
+			setNoteMode(&itemDiffs[i].remote, itemDiffs[i].localMode)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"testing"
 	"time"
 
@@ -381,3 +382,22 @@ func TestSyncWithExcludeParentPaths(t *testing.T) {
 	assert.Equal(t, 0, so.noPushed)
 	assert.Equal(t, 2, so.noPulled)
 }
+
+func TestPlanSync(t *testing.T) {
+	so := planSync(syncActions{
+		push:        []ItemDiff{{homeRelPath: ".apple"}},
+		pull:        []ItemDiff{{homeRelPath: ".lemon"}, {homeRelPath: ".grape"}},
+		trash:       []ItemDiff{{homeRelPath: ".pear"}},
+		conflicting: []ItemDiff{{homeRelPath: ".fig"}},
+	})
+	assert.Equal(t, 1, so.noPushed)
+	assert.Equal(t, 2, so.noPulled)
+	assert.Equal(t, 0, so.noDeleted)
+	assert.Equal(t, 1, so.noTrashed)
+	assert.Regexp(t, regexp.MustCompile(`\.apple\s*would push`), so.msg)
+	assert.Regexp(t, regexp.MustCompile(`\.grape\s*would pull`), so.msg)
+	assert.Regexp(t, regexp.MustCompile(`\.pear\s*would trash`), so.msg)
+	assert.Regexp(t, regexp.MustCompile(`\.fig\s*conflict`), so.msg)
+
+	assert.Contains(t, planSync(syncActions{}).msg, "nothing to do")
+}
@@ -0,0 +1,84 @@
+package sndotfiles
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jonhadfield/gosn-v2"
+	"os"
+	"os/user"
+	"runtime"
+	"text/template"
+)
+
+// TemplateData is the context templated dotfiles are rendered with
+type TemplateData struct {
+	Hostname string
+	OS       string
+	Arch     string
+	User     string
+	Home     string
+	Vars     map[string]string
+}
+
+func newTemplateData(home string, vars map[string]string) TemplateData {
+	hostname, _ := os.Hostname()
+
+	var username string
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+
+	return TemplateData{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		User:     username,
+		Home:     home,
+		Vars:     vars,
+	}
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// setNoteTemplate marks a note as a template, once its content is known to parse
+func setNoteTemplate(note *gosn.Note) error {
+	if _, err := parseTemplate(note.Content.GetTitle(), note.Content.GetText()); err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", note.Content.GetTitle(), err)
+	}
+
+	meta := getNoteMeta(*note)
+	meta.Template = true
+	setNoteMeta(note, meta)
+
+	return nil
+}
+
+// renderTemplate executes a templated note's content with the supplied data
+func renderTemplate(note gosn.Note, data TemplateData) (string, error) {
+	t, err := parseTemplate(note.Content.GetTitle(), note.Content.GetText())
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", note.Content.GetTitle(), err)
+	}
+
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", note.Content.GetTitle(), err)
+	}
+
+	return buf.String(), nil
+}
+
+// remoteContent returns the content the item's note materialises as locally
+func (i ItemDiff) remoteContent() string {
+	if i.template {
+		return i.rendered
+	}
+
+	return i.remote.Content.GetText()
+}
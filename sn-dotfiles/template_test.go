@@ -0,0 +1,136 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	note := createNote(".gitconfig", "email = {{ .Vars.email }}\nos = {{ .OS }}\nhome = {{ .Home }}")
+	require.NoError(t, setNoteTemplate(&note))
+	assert.True(t, getNoteMeta(note).Template)
+
+	rendered, err := renderTemplate(note, newTemplateData("/home/me", map[string]string{"email": "me@example.com"}))
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("email = me@example.com\nos = %s\nhome = /home/me", runtime.GOOS), rendered)
+
+	// missing variables are an error rather than rendered empty
+	_, err = renderTemplate(note, newTemplateData("/home/me", nil))
+	assert.Error(t, err)
+
+	invalid := createNote(".vimrc", "{{ .OS ")
+	assert.Error(t, setNoteTemplate(&invalid))
+}
+
+func TestCompareTemplate(t *testing.T) {
+	home := getTemporaryHome()
+	gitConfigPath := fmt.Sprintf("%s/.gitconfig", home)
+	require.NoError(t, createPathWithContent(gitConfigPath, "email = old@example.com"))
+
+	note := createNote(".gitconfig", "email = {{ .Vars.email }}")
+	require.NoError(t, setNoteTemplate(&note))
+
+	twn := tagsWithNotes{tagWithNotes{tag: createTag(DotFilesTag), notes: gosn.Notes{note}}}
+	vars := map[string]string{"email": "me@example.com"}
+
+	diffs, err := compare(twn, home, nil, nil, nil, vars, true)
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.True(t, diffs[0].template)
+	assert.Equal(t, "email = me@example.com", diffs[0].remoteContent())
+	assert.NotEqual(t, identical, diffs[0].diff)
+
+	// pulling writes the rendered content rather than the template
+	require.NoError(t, createLocal(diffs, "", nil))
+
+	content, err := ioutil.ReadFile(gitConfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, "email = me@example.com", string(content))
+
+	diffs, err = compare(twn, home, nil, nil, nil, vars, true)
+	require.NoError(t, err)
+	assert.Equal(t, identical, diffs[0].diff)
+}
+
+func TestCompareTemplateFailed(t *testing.T) {
+	home := getTemporaryHome()
+	require.NoError(t, createPathWithContent(fmt.Sprintf("%s/.gitconfig", home), "email = old@example.com"))
+	require.NoError(t, createPathWithContent(fmt.Sprintf("%s/.vimrc", home), "set nu"))
+
+	note := createNote(".gitconfig", "email = {{ .Vars.email }}")
+	require.NoError(t, setNoteTemplate(&note))
+
+	twn := tagsWithNotes{tagWithNotes{tag: createTag(DotFilesTag), notes: gosn.Notes{note, createNote(".vimrc", "set nu")}}}
+
+	// a missing variable fails only the template, and the others are still compared
+	paths := []string{fmt.Sprintf("%s/.gitconfig", home), fmt.Sprintf("%s/.vimrc", home)}
+	diffs, err := compare(twn, home, nil, paths, nil, nil, true)
+	require.NoError(t, err)
+	require.Len(t, diffs, 2)
+
+	for _, d := range diffs {
+		switch d.homeRelPath {
+		case ".gitconfig":
+			assert.Equal(t, failed, d.diff)
+			assert.Error(t, d.err)
+			assert.Contains(t, newResult(d, ActionNone).Error, "failed to render template")
+		case ".vimrc":
+			assert.Equal(t, identical, d.diff)
+		default:
+			t.Errorf("unexpected diff for %s", d.homeRelPath)
+		}
+	}
+}
+
+// TestSyncTemplateModeChange checks pushing a local mode change to a templated dotfile keeps its template
+func TestSyncTemplateModeChange(t *testing.T) {
+	defer func() {
+		if err := CleanUp(*testCacheSession); err != nil {
+			fmt.Println("failed to wipe")
+		}
+	}()
+
+	home := getTemporaryHome()
+	gitConfigPath := fmt.Sprintf("%s/.gitconfig", home)
+	require.NoError(t, createTemporaryFiles(map[string]string{gitConfigPath: "os = {{ .OS }}"}))
+
+	_, err := Add(AddInput{Session: testCacheSession, Home: home, Paths: []string{gitConfigPath}, Template: true}, true)
+	require.NoError(t, err)
+
+	// pull the rendered dotfile, then change only its mode
+	require.NoError(t, os.Remove(gitConfigPath))
+
+	syncInput := SNDotfilesSyncInput{Session: testCacheSession, Home: home, Debug: true}
+
+	so, err := Sync(syncInput, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, so.NoPulled)
+	require.NoError(t, os.Chmod(gitConfigPath, 0o600))
+
+	so, err = Sync(syncInput, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, so.NoPushed)
+
+	cso, err := cache.Sync(cache.SyncInput{Session: testCacheSession})
+	require.NoError(t, err)
+
+	twn, err := getTagsWithNotes(cso.DB, testCacheSession)
+	require.NoError(t, err)
+	require.NoError(t, cso.DB.Close())
+	require.Len(t, twn, 1)
+	require.Len(t, twn[0].notes, 1)
+	assert.Equal(t, "os = {{ .OS }}", twn[0].notes[0].Content.GetText())
+	assert.Equal(t, "0600", getNoteMeta(twn[0].notes[0]).Mode)
+
+	content, err := ioutil.ReadFile(gitConfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, "os = "+runtime.GOOS, string(content))
+}
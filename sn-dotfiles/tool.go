@@ -0,0 +1,479 @@
+package sndotfiles
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/ryanuber/columnize"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// defaultDiffToolArgs are appended to a diff tool that doesn't reference the files to compare itself
+	defaultDiffToolArgs = `"$LOCAL" "$REMOTE"`
+	// defaultMergeToolArgs are appended to a merge tool that doesn't reference the files to merge itself
+	defaultMergeToolArgs = `"$LOCAL" "$BASE" "$REMOTE" "$MERGED"`
+	// defaultTwoWayMergeToolArgs are appended instead if the content when last synced isn't known
+	defaultTwoWayMergeToolArgs = `"$LOCAL" "$REMOTE" "$MERGED"`
+)
+
+// diffToolPresets are the commands for diff tools that don't take the default arguments
+var diffToolPresets = map[string]string{
+	"code": `code --wait --diff "$LOCAL" "$REMOTE"`,
+}
+
+// mergeToolPresets are the commands for merge tools that don't take the default arguments
+var mergeToolPresets = map[string]string{
+	"vimdiff":  `vimdiff -f -d -c '4wincmd w | wincmd J' "$LOCAL" "$BASE" "$REMOTE" "$MERGED"`,
+	"nvimdiff": `nvim -d -c '4wincmd w | wincmd J' "$LOCAL" "$BASE" "$REMOTE" "$MERGED"`,
+	"meld":     `meld "$LOCAL" "$BASE" "$REMOTE" --output "$MERGED"`,
+	"kdiff3":   `kdiff3 --auto "$BASE" "$LOCAL" "$REMOTE" -o "$MERGED"`,
+	"code":     `code --wait --merge "$REMOTE" "$LOCAL" "$BASE" "$MERGED"`,
+}
+
+// mergeToolTwoWayPresets are the commands for merge tools if the content when last synced isn't known,
+// leaving the conflict markers in $MERGED to be resolved
+var mergeToolTwoWayPresets = map[string]string{
+	"vimdiff":  `vimdiff -f -d -c 'wincmd l' "$LOCAL" "$MERGED" "$REMOTE"`,
+	"nvimdiff": `nvim -d -c 'wincmd l' "$LOCAL" "$MERGED" "$REMOTE"`,
+	"meld":     `meld "$LOCAL" "$MERGED" "$REMOTE" --output "$MERGED"`,
+	"kdiff3":   `kdiff3 --auto "$LOCAL" "$REMOTE" -o "$MERGED"`,
+	"code":     `code --wait "$MERGED"`,
+}
+
+// toolCommand returns the shell command to run for a tool, which is either the name of a preset,
+// a command referencing the files with $LOCAL, $BASE, $REMOTE and $MERGED, or a command to append the default arguments to
+func toolCommand(tool string, presets map[string]string, defaultArgs string) string {
+	if command, found := presets[tool]; found {
+		return command
+	}
+
+	for _, v := range []string{"$LOCAL", "$BASE", "$REMOTE", "$MERGED"} {
+		if strings.Contains(tool, v) {
+			return tool
+		}
+	}
+
+	return tool + " " + defaultArgs
+}
+
+// runTool runs a tool's command attached to the terminal, with the paths of the files it operates on in its environment
+func runTool(command string, files map[string]string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	cmd.Env = os.Environ()
+	for name, path := range files {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", name, path))
+	}
+
+	return cmd.Run()
+}
+
+// writeToolFile writes content to a file, only readable by the user, named after the item in a
+// subdirectory of dir for the side it represents, so tools can show which side is which
+func writeToolFile(dir, side, name, content string) (path string, err error) {
+	sideDir := filepath.Join(dir, side)
+	if err = os.MkdirAll(sideDir, 0o700); err != nil {
+		return
+	}
+
+	path = filepath.Join(sideDir, name)
+
+	return path, ioutil.WriteFile(path, []byte(content), 0o600)
+}
+
+type DiffToolInput struct {
+	Session      *cache.Session
+	Home         string
+	Roots        *Roots
+	Paths        []string
+	TemplateVars map[string]string
+	Tool         string
+	Debug        bool
+}
+
+// DiffTool launches a tool to compare each local item with a private temporary copy of its remote content
+func DiffTool(di DiffToolInput, useStdErr bool) (msg string, err error) {
+	if di.Tool == "" {
+		return msg, errors.New("diff tool not specified")
+	}
+
+	var diffs []ItemDiff
+
+	diffs, _, err = Diff(di.Session, di.Home, di.Roots, di.Paths, di.TemplateVars, 0, DiffOptions{NameOnly: true}, true, useStdErr)
+	if err != nil {
+		return
+	}
+
+	command := toolCommand(di.Tool, diffToolPresets, defaultDiffToolArgs)
+
+	var lines []string
+
+	for _, itemDiff := range diffs {
+		if itemDiff.symlink || itemDiff.local == itemDiff.remoteContent() {
+			continue
+		}
+
+		if err = diffWithTool(itemDiff, command); err != nil {
+			return
+		}
+
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(itemDiff.homeRelPath), green("compared")))
+	}
+
+	if len(lines) == 0 {
+		return "no differences found", err
+	}
+
+	return columnize.SimpleFormat(lines), err
+}
+
+func diffWithTool(itemDiff ItemDiff, command string) error {
+	dir, err := ioutil.TempDir("", SNAppName+"-")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(itemDiff.path)
+
+	local := itemDiff.path
+	if itemDiff.diff == localMissing {
+		if local, err = writeToolFile(dir, "local", name, ""); err != nil {
+			return err
+		}
+	}
+
+	remote, err := writeToolFile(dir, "remote", name, itemDiff.remoteContent())
+	if err != nil {
+		return err
+	}
+
+	// tools such as diff exit non-zero when differences are found, so only a failure to start is an error
+	if err = runTool(command, map[string]string{"LOCAL": local, "REMOTE": remote}); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("failed to run diff tool: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type MergeInput struct {
+	Session      *cache.Session
+	Home         string
+	Roots        *Roots
+	Paths        []string
+	TemplateVars map[string]string
+	Tool         string
+	Debug        bool
+}
+
+type MergeOutput struct {
+	NoMerged int
+	Results  []Result
+	Msg      string
+}
+
+// Merge launches a merge tool for each conflicting item with its local, remote and last synced content
+// and the result of each successful merge is written locally and pushed
+// symlinks, templates and items deleted on one side are not merged
+func Merge(mi MergeInput, useStdErr bool) (mo MergeOutput, err error) {
+	if mi.Tool == "" {
+		return mo, errors.New("merge tool not specified")
+	}
+
+	var stop func()
+	if !mi.Debug {
+		stop = startSpinner(mi.Session, useStdErr)
+	}
+
+	// get populated db
+	si := cache.SyncInput{
+		Session: mi.Session,
+		Close:   false,
+	}
+
+	var cso cache.SyncOutput
+
+	cso, err = cache.Sync(si)
+	if stop != nil {
+		// the spinner would draw over the merge tool
+		stop()
+	}
+
+	if err != nil {
+		return
+	}
+
+	// closing again once closed, as before pushing, does nothing
+	defer cso.DB.Close()
+
+	var twn tagsWithNotes
+
+	twn, err = getTagsWithNotes(cso.DB, mi.Session)
+	if err != nil {
+		return
+	}
+
+	if err = checkNoteTagConflicts(twn); err != nil {
+		return
+	}
+
+	var bases syncBases
+
+	bases, err = loadSyncBases(cso.DB)
+	if err != nil {
+		return
+	}
+
+	var itemDiffs []ItemDiff
+
+	itemDiffs, err = compare(twn, mi.Home, mi.Roots, mi.Paths, []string{}, mi.TemplateVars, mi.Debug)
+	if err != nil {
+		return
+	}
+
+	itemDiffs = applySyncBases(itemDiffs, bases, mi.Debug)
+
+	command := toolCommand(mi.Tool, mergeToolPresets, defaultMergeToolArgs)
+	twoWayCommand := toolCommand(mi.Tool, mergeToolTwoWayPresets, defaultTwoWayMergeToolArgs)
+
+	var lines []string
+
+	var merged []ItemDiff
+
+	// record the content being replaced so the merge can be undone
+	jrnl := newJournal(bases)
+
+	for _, itemDiff := range itemDiffs {
+		if itemDiff.diff != conflict {
+			continue
+		}
+
+		result := newResult(itemDiff, ActionNone)
+
+		var reason string
+
+		// without the content when last synced, the tool is only shown each side
+		base, baseKnown := bases[itemDiff.homeRelPath].content()
+
+		itemCommand := command
+		if !baseKnown {
+			itemCommand = twoWayCommand
+		}
+
+		switch {
+		case itemDiff.symlink:
+			reason = "symlink"
+		case itemDiff.template:
+			reason = "templated"
+		case !pathExists(itemDiff.path):
+			reason = "deleted locally"
+		case !baseKnown && strings.Contains(itemCommand, "$BASE"):
+			reason = "last synced content unknown"
+		}
+
+		if reason != "" {
+			lines = append(lines, fmt.Sprintf("%s | %s", bold(itemDiff.homeRelPath), yellow("not merged: "+reason)))
+			mo.Results = append(mo.Results, result)
+
+			continue
+		}
+
+		var content string
+
+		var ok bool
+
+		content, ok, err = mergeWithTool(itemDiff, base, baseKnown, itemCommand)
+		if err != nil {
+			return
+		}
+
+		if !ok {
+			lines = append(lines, fmt.Sprintf("%s | %s", bold(itemDiff.homeRelPath), yellow("merge abandoned")))
+			mo.Results = append(mo.Results, result)
+
+			continue
+		}
+
+		// as git's mergetool, a merge left with conflicts isn't accepted
+		if hasConflictMarkers(content) {
+			lines = append(lines, fmt.Sprintf("%s | %s", bold(itemDiff.homeRelPath), yellow("not merged: conflict markers remain")))
+			mo.Results = append(mo.Results, result)
+
+			continue
+		}
+
+		itemDiff.local = content
+		jrnl.merging([]ItemDiff{itemDiff})
+
+		itemDiff.remote.Content.SetText(content)
+		setNoteMode(&itemDiff.remote, itemDiff.localMode)
+		merged = append(merged, itemDiff)
+
+		result.Action = ActionMerged
+		mo.Results = append(mo.Results, result)
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(itemDiff.homeRelPath), green("merged")))
+	}
+
+	if len(merged) == 0 {
+		if err = cso.DB.Close(); err != nil {
+			return
+		}
+
+		mo.Msg = fmt.Sprint(bold("nothing to merge"))
+		if len(lines) > 0 {
+			mo.Msg = columnize.SimpleFormat(lines)
+		}
+
+		return
+	}
+
+	if err = addToDB(cso.DB, mi.Session, merged, false); err != nil {
+		return
+	}
+
+	if err = createLocal(merged, backupDir(mi.Session), mi.Roots); err != nil {
+		return
+	}
+
+	if err = pruneBackups(mi.Session, maxBackups); err != nil {
+		return
+	}
+
+	if err = recordSyncBases(cso.DB, merged); err != nil {
+		return
+	}
+
+	if err = jrnl.save(cso.DB); err != nil {
+		return
+	}
+
+	if err = cso.DB.Close(); err != nil {
+		return
+	}
+
+	// push merged notes
+	si.Close = true
+	if _, err = cache.Sync(si); err != nil {
+		return
+	}
+
+	mo.NoMerged = len(merged)
+	mo.Msg = columnize.SimpleFormat(lines)
+
+	return mo, err
+}
+
+// mergeWithTool runs a merge tool on private temporary copies of an item's local, base and remote content
+// and returns the merged content if the tool succeeds
+// $MERGED starts with conflict markers, so a tool quit without saving, leaving it unchanged, abandons the merge
+func mergeWithTool(itemDiff ItemDiff, base string, baseKnown bool, command string) (merged string, ok bool, err error) {
+	var dir string
+
+	dir, err = ioutil.TempDir("", SNAppName+"-")
+	if err != nil {
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(itemDiff.path)
+	files := make(map[string]string)
+
+	sides := map[string]string{
+		"LOCAL":  itemDiff.local,
+		"REMOTE": itemDiff.remoteContent(),
+		"MERGED": conflictMarkers(itemDiff.local, base, itemDiff.remoteContent(), baseKnown),
+	}
+
+	if baseKnown {
+		sides["BASE"] = base
+	}
+
+	for side, content := range sides {
+		if files[side], err = writeToolFile(dir, strings.ToLower(side), name, content); err != nil {
+			return
+		}
+	}
+
+	if err = runTool(command, files); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// the tool exits non-zero if the merge was abandoned
+			return merged, false, nil
+		}
+
+		return merged, false, fmt.Errorf("failed to run merge tool: %w", err)
+	}
+
+	var b []byte
+
+	b, err = ioutil.ReadFile(files["MERGED"])
+	if err != nil {
+		return
+	}
+
+	if string(b) == sides["MERGED"] {
+		return merged, false, nil
+	}
+
+	return string(b), true, err
+}
+
+// conflictMarkers returns the content of each side between conflict markers, as git leaves a file it can't merge
+func conflictMarkers(local, base, remote string, baseKnown bool) string {
+	var b strings.Builder
+
+	section := func(marker, content string) {
+		b.WriteString(marker + "\n" + content)
+
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	section("<<<<<<< local", local)
+
+	if baseKnown {
+		section("||||||| base", base)
+	}
+
+	section("=======", remote)
+	b.WriteString(">>>>>>> remote\n")
+
+	return b.String()
+}
+
+// hasConflictMarkers returns true if any line of content is a conflict marker, as left by conflictMarkers
+func hasConflictMarkers(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if line == "=======" {
+			return true
+		}
+
+		for _, marker := range []string{"<<<<<<<", "|||||||", ">>>>>>>"} {
+			if line == marker || strings.HasPrefix(line, marker+" ") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+
+	return err == nil
+}
@@ -0,0 +1,106 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolCommand(t *testing.T) {
+	assert.Equal(t, `vimdiff "$LOCAL" "$REMOTE"`, toolCommand("vimdiff", diffToolPresets, defaultDiffToolArgs))
+	assert.Equal(t, diffToolPresets["code"], toolCommand("code", diffToolPresets, defaultDiffToolArgs))
+	assert.Equal(t, mergeToolPresets["meld"], toolCommand("meld", mergeToolPresets, defaultMergeToolArgs))
+	assert.Equal(t, `mytool "$MERGED" "$LOCAL"`, toolCommand(`mytool "$MERGED" "$LOCAL"`, mergeToolPresets, defaultMergeToolArgs))
+	assert.Equal(t, `mytool "$LOCAL" "$BASE" "$REMOTE" "$MERGED"`, toolCommand("mytool", mergeToolPresets, defaultMergeToolArgs))
+}
+
+func TestHasConflictMarkers(t *testing.T) {
+	assert.True(t, hasConflictMarkers(conflictMarkers("local\n", "base\n", "remote\n", true)))
+	assert.True(t, hasConflictMarkers("resolved\n=======\nremote\n"))
+	assert.True(t, hasConflictMarkers("<<<<<<<\nlocal"))
+	assert.False(t, hasConflictMarkers("resolved\n"))
+	// markers must start a line, and separators be alone on it
+	assert.False(t, hasConflictMarkers("> <<<<<<< local\n"))
+	assert.False(t, hasConflictMarkers("=========\n<<<<<<<<\n"))
+}
+
+func TestDiffWithTool(t *testing.T) {
+	home := getTemporaryHome()
+	defer os.RemoveAll(home)
+
+	applePath := filepath.Join(home, ".apple")
+	require.NoError(t, createPathWithContent(applePath, "local apple"))
+
+	out := filepath.Join(home, "out")
+	itemDiff := ItemDiff{path: applePath, homeRelPath: ".apple", local: "local apple", diff: localNewer, remote: createNote(".apple", "remote apple")}
+
+	// tools may exit non-zero when differences are found
+	require.NoError(t, diffWithTool(itemDiff, fmt.Sprintf(`cat "$LOCAL" "$REMOTE" > %s; echo "$REMOTE" >> %s; exit 1`, out, out)))
+
+	b, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "local appleremote apple")
+
+	// the remote copy is named after the item and removed afterwards
+	remotePath := strings.TrimSpace(strings.TrimPrefix(string(b), "local appleremote apple"))
+	assert.Equal(t, filepath.Join("remote", ".apple"), filepath.Join(filepath.Base(filepath.Dir(remotePath)), filepath.Base(remotePath)))
+	_, err = os.Stat(remotePath)
+	assert.True(t, os.IsNotExist(err))
+
+	// missing locals are compared with an empty file
+	itemDiff.diff = localMissing
+	require.NoError(t, diffWithTool(itemDiff, fmt.Sprintf(`cat "$LOCAL" "$REMOTE" > %s`, out)))
+
+	b, err = ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "remote apple", string(b))
+}
+
+func TestMergeWithTool(t *testing.T) {
+	itemDiff := ItemDiff{path: "/home/user/.apple", local: "local\n", diff: conflict, remote: createNote(".apple", "remote\n")}
+
+	merged, ok, err := mergeWithTool(itemDiff, "base\n", true, `cat "$LOCAL" "$BASE" "$REMOTE" > "$MERGED"`)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "local\nbase\nremote\n", merged)
+
+	// merged starts with conflict markers
+	merged, ok, err = mergeWithTool(itemDiff, "base", true, `sed -i 's/^/> /' "$MERGED"`)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "> <<<<<<< local\n> local\n> ||||||| base\n> base\n> =======\n> remote\n> >>>>>>> remote\n", merged)
+
+	// choosing one side is a merge
+	merged, ok, err = mergeWithTool(itemDiff, "base\n", true, `cp "$LOCAL" "$MERGED"`)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "local\n", merged)
+
+	// quitting without saving, or failing, abandons the merge
+	_, ok, err = mergeWithTool(itemDiff, "base\n", true, `true`)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = mergeWithTool(itemDiff, "", true, `exit 1`)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// without the content when last synced, there's no base
+	merged, ok, err = mergeWithTool(itemDiff, "", false, `echo >> "$MERGED"`)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "<<<<<<< local\nlocal\n=======\nremote\n>>>>>>> remote\n\n", merged)
+
+	// markers left in place are rejected by Merge
+	assert.True(t, hasConflictMarkers(merged))
+
+	assert.Equal(t, `vimdiff -f -d -c 'wincmd l' "$LOCAL" "$MERGED" "$REMOTE"`,
+		toolCommand("vimdiff", mergeToolTwoWayPresets, defaultTwoWayMergeToolArgs))
+	assert.Equal(t, `mytool "$LOCAL" "$REMOTE" "$MERGED"`, toolCommand("mytool", mergeToolTwoWayPresets, defaultTwoWayMergeToolArgs))
+}
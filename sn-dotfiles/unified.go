@@ -0,0 +1,276 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultDiffContext is the number of unchanged lines shown either side of a change
+const DefaultDiffContext = 3
+
+type editOp int
+
+const (
+	editEqual editOp = iota
+	editDelete
+	editInsert
+)
+
+// edit is a single line of a line by line diff, with its index in the old and new content
+type edit struct {
+	op         editOp
+	line       string
+	aIdx, bIdx int
+}
+
+// splitLines splits content into lines, each keeping its trailing newline
+// so a final line without one differs from the same line with one
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffLines returns the shortest set of edits that turns a into b, using Myers' algorithm
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	max := n + m
+	offset := max + 1
+
+	v := make([]int, 2*max+3)
+
+	// the furthest reaching x for diagonals -d-1 to d+1 at the start of each step
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int{}, v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backtrack walks the trace recorded by diffLines from the end of both inputs back to the start
+func backtrack(a, b []string, trace [][]int, d int) []edit {
+	x, y := len(a), len(b)
+
+	var edits []edit
+
+	for ; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int {
+			return v[k+d+1]
+		}
+
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		if d == 0 {
+			prevX, prevY = 0, 0
+		}
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{op: editEqual, line: a[x], aIdx: x, bIdx: y})
+		}
+
+		if d == 0 {
+			break
+		}
+
+		if x == prevX {
+			y--
+			edits = append(edits, edit{op: editInsert, line: b[y], aIdx: x, bIdx: y})
+		} else {
+			x--
+			edits = append(edits, edit{op: editDelete, line: a[x], aIdx: x, bIdx: y})
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+
+	return edits
+}
+
+// hunk is a run of edits containing changes, along with the unchanged lines around them
+type hunk struct {
+	edits []edit
+}
+
+// hunks groups edits into hunks with up to context unchanged lines either side of each change,
+// merging changes separated by no more than twice that
+func hunks(edits []edit, context int) (res []hunk) {
+	if context < 0 {
+		context = 0
+	}
+
+	var changes []int
+
+	for i, e := range edits {
+		if e.op != editEqual {
+			changes = append(changes, i)
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	start := changes[0]
+	end := changes[0]
+
+	flush := func() {
+		from := start - context
+		if from < 0 {
+			from = 0
+		}
+
+		to := end + context + 1
+		if to > len(edits) {
+			to = len(edits)
+		}
+
+		res = append(res, hunk{edits: edits[from:to]})
+	}
+
+	for _, c := range changes[1:] {
+		if c-end-1 > 2*context {
+			flush()
+
+			start = c
+		}
+
+		end = c
+	}
+
+	flush()
+
+	return res
+}
+
+// hunkRange returns a unified diff range, where start is the zero based index of the first line
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func (h hunk) header() string {
+	aStart, bStart := h.edits[0].aIdx, h.edits[0].bIdx
+
+	var aCount, bCount int
+
+	for _, e := range h.edits {
+		if e.op != editInsert {
+			aCount++
+		}
+
+		if e.op != editDelete {
+			bCount++
+		}
+	}
+
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+}
+
+// unifiedDiff returns a coloured unified diff turning from into to, or an empty string if they are the same
+func unifiedDiff(fromName, toName, from, to string, context int) string {
+	hs := hunks(diffLines(splitLines(from), splitLines(to)), context)
+	if len(hs) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(bold(fmt.Sprintf("--- %s", fromName)) + "\n")
+	sb.WriteString(bold(fmt.Sprintf("+++ %s", toName)) + "\n")
+
+	for _, h := range hs {
+		sb.WriteString(cyan(h.header()) + "\n")
+
+		for _, e := range h.edits {
+			line := strings.TrimSuffix(e.line, "\n")
+
+			switch e.op {
+			case editEqual:
+				sb.WriteString(" " + line)
+			case editDelete:
+				sb.WriteString(red("-" + line))
+			case editInsert:
+				sb.WriteString(green("+" + line))
+			}
+
+			sb.WriteString("\n")
+
+			if !strings.HasSuffix(e.line, "\n") {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// diffStat returns the number of lines inserted and deleted to turn from into to
+func diffStat(from, to string) (insertions, deletions int) {
+	for _, e := range diffLines(splitLines(from), splitLines(to)) {
+		switch e.op {
+		case editInsert:
+			insertions++
+		case editDelete:
+			deletions++
+		case editEqual:
+		}
+	}
+
+	return insertions, deletions
+}
@@ -0,0 +1,155 @@
+package sndotfiles
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLines(t *testing.T) {
+	assert.Nil(t, splitLines(""))
+	assert.Equal(t, []string{"a\n", "b\n"}, splitLines("a\nb\n"))
+	assert.Equal(t, []string{"a\n", "b"}, splitLines("a\nb"))
+}
+
+func TestDiffLines(t *testing.T) {
+	apply := func(a []string, edits []edit) (res []string) {
+		for _, e := range edits {
+			if e.op != editDelete {
+				res = append(res, e.line)
+			}
+		}
+
+		return res
+	}
+
+	for _, tc := range []struct {
+		a, b    string
+		changes int
+	}{
+		{"", "", 0},
+		{"a\n", "a\n", 0},
+		{"", "a\nb\n", 2},
+		{"a\nb\n", "", 2},
+		{"a\nb\nc\n", "a\nc\n", 1},
+		{"a\nb\nc\n", "a\nx\nc\n", 2},
+		{"a\nb\nc\nd\n", "b\nc\nd\ne\n", 2},
+		{"a", "a\n", 2},
+	} {
+		a, b := splitLines(tc.a), splitLines(tc.b)
+		edits := diffLines(a, b)
+		assert.Equal(t, b, apply(a, edits), "%q -> %q", tc.a, tc.b)
+
+		var changes int
+
+		for _, e := range edits {
+			if e.op != editEqual {
+				changes++
+			}
+		}
+
+		assert.Equal(t, tc.changes, changes, "%q -> %q", tc.a, tc.b)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+
+	defer func() { color.NoColor = noColor }()
+
+	assert.Empty(t, unifiedDiff("local/.a", "remote/.a", "same\n", "same\n", DefaultDiffContext))
+
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	to := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+
+	assert.Equal(t, strings.Join([]string{
+		"--- local/.a",
+		"+++ remote/.a",
+		"@@ -1,6 +1,6 @@",
+		" 1",
+		" 2",
+		"-3",
+		"+three",
+		" 4",
+		" 5",
+		" 6",
+		"@@ -10,3 +10,4 @@",
+		" 10",
+		" 11",
+		" 12",
+		"+13",
+		"",
+	}, "\n"), unifiedDiff("local/.a", "remote/.a", from, to, DefaultDiffContext))
+
+	// changes within twice the context of each other share a hunk
+	assert.Equal(t, 1, strings.Count(unifiedDiff("a", "b", from, to, 5), "@@ -"))
+
+	// no context
+	assert.Equal(t, strings.Join([]string{
+		"--- a",
+		"+++ b",
+		"@@ -3 +3 @@",
+		"-3",
+		"+three",
+		"@@ -12,0 +13 @@",
+		"+13",
+		"",
+	}, "\n"), unifiedDiff("a", "b", from, to, 0))
+
+	// new file and missing newline
+	assert.Equal(t, strings.Join([]string{
+		"--- a",
+		"+++ b",
+		"@@ -0,0 +1 @@",
+		"+x",
+		`\ No newline at end of file`,
+		"",
+	}, "\n"), unifiedDiff("a", "b", "", "x", DefaultDiffContext))
+}
+
+func TestDiffStat(t *testing.T) {
+	ins, dels := diffStat("a\nb\nc\n", "a\nx\nc\nd\n")
+	assert.Equal(t, 2, ins)
+	assert.Equal(t, 1, dels)
+}
+
+func TestProcessContentDiffs(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+
+	defer func() { color.NoColor = noColor }()
+
+	diffs := []ItemDiff{
+		{homeRelPath: ".apple", local: "apple\n", remote: createNote(".apple", "apple\n")},
+		{homeRelPath: ".lemon", local: "lemon\n", remote: createNote(".lemon", "lime\nlemon\n")},
+		{homeRelPath: ".grape", local: "grape\n", remote: createNote(".grape", "")},
+	}
+
+	assert.Equal(t, ".lemon\n.grape", processContentDiffs(diffs, DiffOptions{NameOnly: true}))
+
+	stat := processContentDiffs(diffs, DiffOptions{Stat: true})
+	assert.Regexp(t, `\.lemon\s+1 \+\n`, stat)
+	assert.Regexp(t, `\.grape\s+1 -\n`, stat)
+	assert.Contains(t, stat, "2 file(s) changed, 1 insertion(s)(+), 1 deletion(s)(-)")
+
+	out := processContentDiffs(diffs, DiffOptions{Context: DefaultDiffContext})
+	assert.NotContains(t, out, ".apple")
+	assert.Contains(t, out, "--- local/.lemon\n+++ remote/.lemon\n@@ -1 +1,2 @@\n+lime\n lemon\n")
+	assert.Contains(t, out, "--- local/.grape\n+++ remote/.grape\n@@ -1 +0,0 @@\n-grape")
+
+	assert.Empty(t, processContentDiffs(diffs[:1], DiffOptions{}))
+}
+
+func TestStatBar(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+
+	defer func() { color.NoColor = noColor }()
+
+	assert.Equal(t, "++-", statBar(2, 1))
+	assert.Len(t, statBar(200, 100), maxStatBarWidth)
+	assert.Equal(t, "+"+strings.Repeat("-", maxStatBarWidth-1), statBar(1, 1000))
+}
@@ -0,0 +1,366 @@
+package sndotfiles
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultWatchDebounce is how long to wait after the last local change before syncing
+	DefaultWatchDebounce = 2 * time.Second
+	// DefaultWatchPollInterval is how often to sync to pick up remote changes
+	DefaultWatchPollInterval = 5 * time.Minute
+)
+
+type WatchInput struct {
+	Session      *cache.Session
+	Home         string
+	Roots        *Roots
+	Exclude      []string
+	TemplateVars map[string]string
+	// Debounce is how long to wait for further local changes before syncing
+	Debounce time.Duration
+	// PollInterval is how often to sync to pick up remote changes
+	PollInterval time.Duration
+	Debug        bool
+	// Report is called with the outcome of each sync
+	Report func(so SyncOutput, err error)
+}
+
+// Watch syncs, then syncs again whenever tracked dotfiles change locally, and every poll interval,
+// until stop is closed
+// only a failure of the first sync, or to watch the filesystem, ends watching early
+func Watch(wi WatchInput, stop <-chan struct{}) error {
+	w, err := newWatcher(wi)
+	if err != nil {
+		return err
+	}
+
+	defer w.fsw.Close()
+
+	if err = w.start(); err != nil {
+		return err
+	}
+
+	return w.run(stop, nil)
+}
+
+func newWatcher(wi WatchInput) (*watcher, error) {
+	if err := checkPathsExist(wi.Exclude); err != nil {
+		return nil, err
+	}
+
+	if wi.Debounce <= 0 {
+		wi.Debounce = DefaultWatchDebounce
+	}
+
+	if wi.PollInterval <= 0 {
+		wi.PollInterval = DefaultWatchPollInterval
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		home:    wi.Home,
+		roots:   wi.Roots,
+		quiet:   wi.Debounce,
+		poll:    wi.PollInterval,
+		fsw:     fsw,
+		tracked: make(map[string]bool),
+		watched: make(map[string]bool),
+		pending: make(map[string]bool),
+		debug:   wi.Debug,
+		report:  wi.Report,
+		sync: func(si syncInput) (SyncOutput, error) {
+			si.session = wi.Session
+			si.home = wi.Home
+			si.roots = wi.Roots
+			si.exclude = wi.Exclude
+			si.templateVars = wi.TemplateVars
+			si.debug = wi.Debug
+
+			output, sErr := sync(si)
+
+			return output.export(), sErr
+		},
+	}
+
+	if w.report == nil {
+		w.report = func(SyncOutput, error) {}
+	}
+
+	return w, nil
+}
+
+// watcher syncs tracked dotfiles as they change, watching the directories containing them
+// so changes made by replacing a file, as many editors do, aren't missed
+type watcher struct {
+	home  string
+	roots *Roots
+	quiet time.Duration
+	poll  time.Duration
+	fsw   *fsnotify.Watcher
+	// tracked is the set of absolute paths of tracked dotfiles
+	tracked map[string]bool
+	// watched is the set of directories being watched
+	watched map[string]bool
+	// pending is the set of changed paths waiting to be synced
+	pending  map[string]bool
+	debounce *time.Timer
+	// paused stops changes, and polling, from triggering syncs
+	paused   bool
+	lastSync time.Time
+	lastErr  error
+	debug    bool
+	sync     func(si syncInput) (SyncOutput, error)
+	report   func(so SyncOutput, err error)
+}
+
+// start makes the first sync and watches the paths it tracks
+func (w *watcher) start() error {
+	so, err := w.sync(syncInput{})
+	w.synced(so, err)
+
+	if err != nil {
+		return err
+	}
+
+	return w.track(so.Results)
+}
+
+// track updates the paths tracked, from the results of a sync, and the directories watched for them
+// if a tracked path's directory doesn't exist, its nearest existing parent is watched instead
+func (w *watcher) track(results []Result) error {
+	tracked := make(map[string]bool)
+	dirs := make(map[string]bool)
+
+	for _, result := range results {
+		if result.Diff == untracked {
+			continue
+		}
+
+		path := localPath(w.home, result.Path, w.roots)
+		tracked[path] = true
+
+		dir := filepath.Dir(path)
+		for !pathExists(dir) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+		}
+
+		dirs[dir] = true
+	}
+
+	for dir := range w.watched {
+		if !dirs[dir] {
+			debugPrint(w.debug, fmt.Sprintf("watcher.track | unwatching: %s", dir))
+
+			_ = w.fsw.Remove(dir)
+
+			delete(w.watched, dir)
+		}
+	}
+
+	for dir := range dirs {
+		if w.watched[dir] {
+			continue
+		}
+
+		debugPrint(w.debug, fmt.Sprintf("watcher.track | watching: %s", dir))
+
+		if err := w.fsw.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+
+		w.watched[dir] = true
+	}
+
+	w.tracked = tracked
+
+	return nil
+}
+
+// relevant returns true if an event is for a tracked path, or for a directory that may contain one
+func (w *watcher) relevant(event fsnotify.Event) bool {
+	if w.tracked[event.Name] {
+		return true
+	}
+
+	if event.Op&fsnotify.Create == 0 {
+		return false
+	}
+
+	for path := range w.tracked {
+		if strings.HasPrefix(path, event.Name+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// changed records an event for a path to be synced, once events stop arriving
+func (w *watcher) changed(event fsnotify.Event) {
+	if !w.relevant(event) {
+		return
+	}
+
+	debugPrint(w.debug, fmt.Sprintf("watcher.changed | %s", event))
+
+	w.pending[event.Name] = true
+
+	stopTimer(w.debounce)
+	w.debounce.Reset(w.quiet)
+}
+
+// run handles events, and runs each call received, until stop is closed
+func (w *watcher) run(stop <-chan struct{}, calls <-chan func()) error {
+	w.debounce = time.NewTimer(w.quiet)
+	stopTimer(w.debounce)
+
+	defer stopTimer(w.debounce)
+
+	poll := time.NewTicker(w.poll)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case call := <-calls:
+			call()
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return nil
+			}
+
+			w.changed(event)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return nil
+			}
+
+			w.report(SyncOutput{}, fmt.Errorf("watch error: %w", err))
+		case <-w.debounce.C:
+			if w.paused {
+				// sync once resumed
+				continue
+			}
+
+			pending := w.pending
+			w.pending = make(map[string]bool)
+
+			w.syncPaths(pending)
+		case <-poll.C:
+			if !w.paused {
+				w.syncPaths(nil)
+			}
+		}
+	}
+}
+
+// resume allows syncs again, syncing any changes made while paused
+func (w *watcher) resume() {
+	w.paused = false
+
+	if len(w.pending) > 0 {
+		stopTimer(w.debounce)
+		w.debounce.Reset(w.quiet)
+	}
+}
+
+// syncPaths syncs the changed paths, or everything if none are specified or any have been removed
+func (w *watcher) syncPaths(changed map[string]bool) {
+	var paths []string
+
+	for path := range changed {
+		if !pathExists(path) {
+			// removing a path can only be synced as part of a full sync
+			paths = nil
+			break
+		}
+
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	_, _ = w.syncWith(syncInput{paths: paths})
+}
+
+// syncWith makes a sync, reports it, then updates the paths watched
+func (w *watcher) syncWith(si syncInput) (so SyncOutput, err error) {
+	so, err = w.sync(si)
+	w.synced(so, err)
+
+	if err != nil || si.dryRun {
+		return
+	}
+
+	results := so.Results
+
+	if len(si.paths) > 0 {
+		// a partial sync only reports the paths synced
+		for path := range w.tracked {
+			results = append(results, Result{Path: stripHome(path, w.home, w.roots)})
+		}
+	}
+
+	if tErr := w.track(results); tErr != nil {
+		w.report(SyncOutput{}, tErr)
+	}
+
+	w.ignoreWritten(so.Results)
+
+	return so, err
+}
+
+func (w *watcher) synced(so SyncOutput, err error) {
+	w.lastSync = time.Now().UTC()
+	w.lastErr = err
+
+	w.report(so, err)
+}
+
+// ignoreWritten handles the events already queued, discarding those for the paths a sync has just written
+func (w *watcher) ignoreWritten(results []Result) {
+	written := make(map[string]bool)
+
+	for _, result := range results {
+		if result.Action == ActionPulled || result.Action == ActionMerged {
+			written[localPath(w.home, result.Path, w.roots)] = true
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+
+			if !written[event.Name] {
+				w.changed(event)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// stopTimer stops a timer and drains its channel, so it can be reset
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
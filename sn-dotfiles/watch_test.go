@@ -0,0 +1,123 @@
+package sndotfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWatcher(t *testing.T, home string, synced chan []string) *watcher {
+	fsw, err := fsnotify.NewWatcher()
+	require.NoError(t, err)
+
+	return &watcher{
+		home:    home,
+		quiet:   50 * time.Millisecond,
+		poll:    time.Hour,
+		fsw:     fsw,
+		tracked: make(map[string]bool),
+		watched: make(map[string]bool),
+		pending: make(map[string]bool),
+		sync: func(si syncInput) (SyncOutput, error) {
+			synced <- si.paths
+			return SyncOutput{}, nil
+		},
+		report: func(SyncOutput, error) {},
+	}
+}
+
+func TestWatcherTrack(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	require.NoError(t, createPathWithContent(filepath.Join(home, ".fruit", "apple"), "apple content"))
+
+	w := newTestWatcher(t, home, make(chan []string, 1))
+
+	defer w.fsw.Close()
+
+	require.NoError(t, w.track([]Result{
+		{Path: ".fruit/apple"},
+		{Path: ".config/missing/lemon"},
+		{Path: ".fig", Diff: untracked},
+	}))
+
+	assert.Equal(t, map[string]bool{
+		filepath.Join(home, ".fruit", "apple"):             true,
+		filepath.Join(home, ".config", "missing", "lemon"): true,
+	}, w.tracked)
+
+	// the directories of missing paths are watched from home
+	assert.Equal(t, map[string]bool{
+		filepath.Join(home, ".fruit"): true,
+		home:                          true,
+	}, w.watched)
+
+	// directories no longer needed are unwatched
+	require.NoError(t, w.track([]Result{{Path: ".fruit/apple"}}))
+	assert.Equal(t, map[string]bool{filepath.Join(home, ".fruit"): true}, w.watched)
+}
+
+func TestWatcherRun(t *testing.T) {
+	home := getTemporaryHome()
+
+	defer os.RemoveAll(home)
+
+	applePath := filepath.Join(home, ".fruit", "apple")
+	require.NoError(t, createPathWithContent(applePath, "apple content"))
+	require.NoError(t, createPathWithContent(filepath.Join(home, ".fruit", "lemon"), "lemon content"))
+
+	synced := make(chan []string, 1)
+	w := newTestWatcher(t, home, synced)
+
+	defer w.fsw.Close()
+
+	require.NoError(t, w.track([]Result{{Path: ".fruit/apple"}}))
+
+	stop := make(chan struct{})
+	done := make(chan error)
+
+	go func() {
+		done <- w.run(stop, nil)
+	}()
+
+	// a burst of changes to a tracked path is synced once, and untracked paths are ignored
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ioutil.WriteFile(applePath, []byte("new apple content"), 0o600))
+	}
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, ".fruit", "lemon"), []byte("new lemon content"), 0o600))
+
+	select {
+	case paths := <-synced:
+		assert.Equal(t, []string{applePath}, paths)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for sync")
+	}
+
+	select {
+	case paths := <-synced:
+		t.Fatalf("unexpected sync of: %v", paths)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// removing a tracked path syncs everything
+	require.NoError(t, os.Remove(applePath))
+
+	select {
+	case paths := <-synced:
+		assert.Empty(t, paths)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for sync")
+	}
+
+	close(stop)
+	assert.NoError(t, <-done)
+}
@@ -2,28 +2,41 @@ package sndotfiles
 
 import (
 	"fmt"
-	"github.com/briandowns/spinner"
 	"github.com/jonhadfield/gosn-v2"
 	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/ryanuber/columnize"
 	"os"
-	"time"
 )
 
+type WipeInput struct {
+	Session  *cache.Session
+	Home     string
+	Roots    *Roots
+	PageSize int
+	// DryRun reports the tags and notes that would be removed instead of removing them
+	DryRun bool
+}
+
+type WipeOutput struct {
+	NoRemoved int
+	Msg       string
+}
+
+// WipeDotfileTagsAndNotes removes all dotfile tags and notes from SN
 func WipeDotfileTagsAndNotes(session *cache.Session, pageSize int, useStdErr bool) (int, error) {
-	if session.Valid() && !session.Debug {
-		prefix := HiWhite("syncing ")
-		if _, err := os.Stat(session.CacheDBPath); os.IsNotExist(err) {
-			prefix = HiWhite("initializing ")
-		}
+	wo, err := Wipe(WipeInput{Session: session, PageSize: pageSize}, useStdErr)
 
-		s := spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stdout))
-		if useStdErr {
-			s = spinner.New(spinner.CharSets[SpinnerCharSet], SpinnerDelay*time.Millisecond, spinner.WithWriter(os.Stderr))
-		}
+	return wo.NoRemoved, err
+}
 
-		s.Prefix = prefix
-		s.Start()
-		defer s.Stop()
+// Wipe removes all dotfile tags and notes from SN
+// if DryRun is set, the paths of the tags and notes that would be removed are reported instead
+func Wipe(wi WipeInput, useStdErr bool) (wo WipeOutput, err error) {
+	session := wi.Session
+
+	if session.Valid() && !session.Debug {
+		stop := startSpinner(session, useStdErr)
+		defer stop()
 	}
 
 	// get populated db
@@ -32,40 +45,74 @@ func WipeDotfileTagsAndNotes(session *cache.Session, pageSize int, useStdErr boo
 		Close:   false,
 	}
 
-	var err error
 	var cso cache.SyncOutput
 	cso, err = cache.Sync(si)
 	if err != nil {
-		return 0, err
+		return
 	}
 
 	var remote tagsWithNotes
 
 	remote, err = getTagsWithNotes(cso.DB, session)
 	if err != nil {
-		return 0, err
-	}
-	if err = cso.DB.Close(); err != nil {
-		return 0, err
+		return
 	}
 
 	var itemsToRemove gosn.Items
 
+	var lines []string
+
 	for _, twn := range remote {
 		twn.tag.Deleted = true
 		t := twn.tag
 		itemsToRemove = append(itemsToRemove, &t)
+		lines = append(lines, fmt.Sprintf("%s | %s", bold(wipeLabel(twn, "", wi.Home, wi.Roots)), yellow("would remove tag")))
 
 		for n := range twn.notes {
 			twn.notes[n].Deleted = true
 			itemsToRemove = append(itemsToRemove, &twn.notes[n])
+			lines = append(lines, fmt.Sprintf("%s | %s", bold(wipeLabel(twn, twn.notes[n].Content.GetTitle(), wi.Home, wi.Roots)), yellow("would remove note")))
 		}
 	}
 
-	debugPrint(session.Debug, fmt.Sprintf("WipeDotfileTagsAndNotes | removing %d items", len(itemsToRemove)))
+	debugPrint(session.Debug, fmt.Sprintf("Wipe | removing %d items", len(itemsToRemove)))
+
+	if len(itemsToRemove) == 0 || wi.DryRun {
+		if err = cso.DB.Close(); err != nil {
+			return
+		}
+
+		if len(lines) == 0 {
+			wo.Msg = fmt.Sprint(bold("nothing to do"))
+			return
+		}
+
+		wo.NoRemoved = len(itemsToRemove)
+		wo.Msg = columnize.SimpleFormat(lines)
+
+		return
+	}
+
+	// forget all synced paths so sync doesn't treat them as deleted remotely
+	var bases syncBases
+
+	bases, err = loadSyncBases(cso.DB)
+	if err != nil {
+		return
+	}
+
+	var basePaths []string
+	for p := range bases {
+		basePaths = append(basePaths, p)
+	}
+
+	if err = forgetSyncBases(cso.DB, basePaths); err != nil {
+		return
+	}
 
-	if len(itemsToRemove) == 0 {
-		return 0, nil
+	// the items are only marked deleted in memory, so must be saved for the sync to push their deletion
+	if err = cache.SaveItems(cso.DB, session, itemsToRemove, true); err != nil {
+		return
 	}
 
 	pii := cache.SyncInput{
@@ -75,8 +122,35 @@ func WipeDotfileTagsAndNotes(session *cache.Session, pageSize int, useStdErr boo
 
 	_, err = cache.Sync(pii)
 	if err != nil {
-		return 0, err
+		return
+	}
+
+	wo.NoRemoved = len(itemsToRemove)
+	wo.Msg = fmt.Sprintf("%d removed", len(itemsToRemove))
+
+	return
+}
+
+// wipeLabel returns the home relative path of a tag's directory, or of a note in it if noteTitle is set
+// the tag title is used if its directory isn't known, e.g. for a root that isn't set, or home isn't
+func wipeLabel(twn tagWithNotes, noteTitle, home string, roots *Roots) string {
+	dir, err := tagTitleToFSDir(twn.title(), home, roots)
+	if err != nil || dir == "" {
+		if noteTitle == "" {
+			return twn.title()
+		}
+
+		return fmt.Sprintf("%s (%s)", noteTitle, twn.title())
+	}
+
+	if noteTitle == "" {
+		if rel := stripHome(dir, home, roots); rel != "" {
+			return rel
+		}
+
+		// the tag of files at the top of home
+		return "~" + string(os.PathSeparator)
 	}
 
-	return len(itemsToRemove), err
+	return stripHome(dir+noteTitle, home, roots)
 }
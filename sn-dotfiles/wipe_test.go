@@ -1,6 +1,8 @@
 package sndotfiles
 
 import (
+	"fmt"
+	"github.com/jonhadfield/gosn-v2"
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -19,3 +21,24 @@ func TestWipeNoItems(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 0, num)
 }
+
+func TestWipeLabel(t *testing.T) {
+	home := "/home/me"
+
+	fruit := tagWithNotes{tag: gosn.Tag{Content: gosn.TagContent{Title: fmt.Sprintf("%s.fruit", DotFilesTag)}}}
+	assert.Equal(t, ".fruit/", wipeLabel(fruit, "", home, nil))
+	assert.Equal(t, ".fruit/apple", wipeLabel(fruit, "apple", home, nil))
+
+	top := tagWithNotes{tag: gosn.Tag{Content: gosn.TagContent{Title: DotFilesTag}}}
+	assert.Equal(t, "~/", wipeLabel(top, "", home, nil))
+	assert.Equal(t, ".zshrc", wipeLabel(top, ".zshrc", home, nil))
+
+	// the directories of roots that aren't set aren't known
+	etc := tagWithNotes{tag: gosn.Tag{Content: gosn.TagContent{Title: fmt.Sprintf("%s.root:etc", DotFilesTag)}}}
+	assert.Equal(t, "dotfiles.root:etc", wipeLabel(etc, "", home, nil))
+	assert.Equal(t, "hosts (dotfiles.root:etc)", wipeLabel(etc, "hosts", home, nil))
+
+	roots, err := NewRoots(map[string]string{"etc": "/etc"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "root:etc/hosts", wipeLabel(etc, "hosts", home, roots))
+}